@@ -0,0 +1,92 @@
+package qafoia
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// AuditAction is the kind of action recorded in the audit log.
+type AuditAction string
+
+const (
+	AuditActionApply    AuditAction = "apply"
+	AuditActionRollback AuditAction = "rollback"
+	AuditActionClean    AuditAction = "clean"
+
+	// The actions below change the migration table without running any migration SQL.
+	AuditActionMarkApplied  AuditAction = "mark_applied"
+	AuditActionRename       AuditAction = "rename"
+	AuditActionRepair       AuditAction = "repair"
+	AuditActionRemoveRecord AuditAction = "remove_record"
+)
+
+// AuditRecord is a line of the audit log written to Config.AuditLogWriter, as a JSON object.
+type AuditRecord struct {
+	Time   time.Time   `json:"time"`
+	Action AuditAction `json:"action"`
+	// Migration is the name of the migration the action is about. It is empty for clean.
+	Migration string `json:"migration,omitempty"`
+	// PreviousName is the name a renamed migration was recorded under.
+	PreviousName string `json:"previous_name,omitempty"`
+	// Shard is the shard of a MultiDriver the action ran on, which gets a record of its own.
+	Shard   string `json:"shard,omitempty"`
+	Success bool   `json:"success"`
+	// Error is the error message of a failed action.
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	// Tables are the tables dropped by clean.
+	Tables []string `json:"tables,omitempty"`
+}
+
+// auditLog writes audit records as JSON lines. All methods are no-ops on a nil auditLog.
+type auditLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// newAuditLog returns an audit log writing to w, or nil if w is nil.
+func newAuditLog(w io.Writer) *auditLog {
+	if w == nil {
+		return nil
+	}
+	return &auditLog{w: w}
+}
+
+// record writes the record as one line. A failure to write is logged, but does not fail the
+// action being recorded, which has already happened.
+func (a *auditLog) record(record AuditRecord) {
+	if a == nil {
+		return
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("⚠️  Failed to encode audit record: %v\n", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.w.Write(append(line, '\n')); err != nil {
+		log.Printf("⚠️  Failed to write audit record: %v\n", err)
+	}
+}
+
+// recordAudit writes record to the audit log, completed with the time, outcome and duration
+// of an action that started at started and ended with err.
+func (q *Qafoia) recordAudit(record AuditRecord, started time.Time, err error) {
+	if q.audit == nil {
+		return
+	}
+
+	record.Time = clockNow(q.clock)
+	record.Success = err == nil
+	record.DurationMs = time.Since(started).Milliseconds()
+	if err != nil {
+		record.Error = err.Error()
+	}
+	q.audit.record(record)
+}
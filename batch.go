@@ -0,0 +1,41 @@
+package qafoia
+
+import (
+	"context"
+	"fmt"
+)
+
+// RunBatched runs stmt repeatedly until it affects no rows, for data backfills that would
+// hold locks for too long as a single statement. stmt must take the batch size as its only
+// query argument and only touch rows that still need changing, such as
+//
+//	UPDATE users SET status = 'active' WHERE status IS NULL LIMIT ?
+//
+// on MySQL, or on PostgreSQL, which has no LIMIT on UPDATE,
+//
+//	UPDATE users SET status = 'active' WHERE id IN (SELECT id FROM users WHERE status IS NULL LIMIT $1)
+//
+// Called with the *sql.DB passed to RunnableMigration.Run, each batch commits on its own, so
+// a failure leaves the batches before it applied and stmt must be safe to run again. It
+// returns the total number of affected rows.
+func RunBatched(ctx context.Context, db SQLExecutor, stmt string, size int) (int64, error) {
+	if size <= 0 {
+		return 0, fmt.Errorf("%w: %d", ErrInvalidBatchSize, size)
+	}
+
+	var total int64
+	for {
+		result, err := db.ExecContext(ctx, stmt, size)
+		if err != nil {
+			return total, fmt.Errorf("failed to run batch after %d rows: %w", total, err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return total, fmt.Errorf("failed to read affected rows: %w", err)
+		}
+		if affected == 0 {
+			return total, nil
+		}
+		total += affected
+	}
+}
@@ -0,0 +1,37 @@
+package qafoia
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunBatched(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	stmt := "UPDATE users SET status = 'active' WHERE status IS NULL LIMIT ?"
+	mock.ExpectExec("UPDATE users").WithArgs(100).WillReturnResult(sqlmock.NewResult(0, 100))
+	mock.ExpectExec("UPDATE users").WithArgs(100).WillReturnResult(sqlmock.NewResult(0, 42))
+	mock.ExpectExec("UPDATE users").WithArgs(100).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	total, err := RunBatched(context.Background(), db, stmt, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(142), total)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	mock.ExpectExec("UPDATE users").WithArgs(100).WillReturnResult(sqlmock.NewResult(0, 100))
+	mock.ExpectExec("UPDATE users").WithArgs(100).WillReturnError(errors.New("lock wait timeout"))
+
+	total, err = RunBatched(context.Background(), db, stmt, 100)
+	assert.ErrorContains(t, err, "lock wait timeout")
+	assert.Equal(t, int64(100), total)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = RunBatched(context.Background(), db, stmt, 0)
+	assert.ErrorIs(t, err, ErrInvalidBatchSize)
+}
@@ -2,7 +2,9 @@ package qafoia
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"os"
 	"strconv"
 
 	"github.com/spf13/cobra"
@@ -37,15 +39,62 @@ func (c *Cli) Execute(ctx context.Context) error {
 		Use:   "list",
 		Short: "List all migrations",
 		Run: func(cmd *cobra.Command, args []string) {
+			if byShard, _ := cmd.Flags().GetBool("by-shard"); byShard {
+				list, err := c.qafoia.ListSharded(ctx)
+				if err != nil {
+					log.Println("Error listing migrations:", err)
+					return
+				}
+				list.Print()
+				return
+			}
+
 			list, err := c.qafoia.List(ctx)
 			if err != nil {
 				log.Println("Error listing migrations:", err)
 				return
 			}
-			list.Print()
+			verbose, _ := cmd.Flags().GetBool("verbose")
+			names, _ := cmd.Flags().GetStringSlice("columns")
+			groupBy, _ := cmd.Flags().GetString("group-by")
+			if groupBy != "" && groupBy != "status" {
+				log.Println("Unknown grouping:", groupBy)
+				return
+			}
+			if len(names) == 0 && groupBy == "" {
+				if verbose {
+					list.PrintVerbose()
+					return
+				}
+				list.Print()
+				return
+			}
+
+			columns := make([]ListColumn, 0, len(names))
+			for _, name := range names {
+				column := ListColumn(name)
+				if _, ok := listColumns[column]; !ok {
+					log.Println("Unknown column:", name)
+					return
+				}
+				columns = append(columns, column)
+			}
+			if groupBy == "status" {
+				list.PrintGroupedByStatus(columns...)
+			} else {
+				list.PrintColumns(columns...)
+			}
+			if verbose {
+				list.fprintPendingScripts(os.Stdout)
+			}
 		},
 	}
 
+	listCmd.Flags().BoolP("verbose", "v", false, "Print the SQL of each pending migration")
+	listCmd.Flags().StringSlice("columns", nil, "Columns to show: name, status, executed_at, duration, description")
+	listCmd.Flags().String("group-by", "", "Print separate tables per group: status")
+	listCmd.Flags().Bool("by-shard", false, "Print the status of each migration on each shard of a sharded driver")
+
 	var migrateCmd = &cobra.Command{
 		Use:   "migrate",
 		Short: "Run all pending migrations",
@@ -60,23 +109,84 @@ func (c *Cli) Execute(ctx context.Context) error {
 					return
 				}
 			}
-			if fresh {
-				err = c.qafoia.Fresh(ctx)
+			step := 0
+			stepFlag := cmd.Flags().Lookup("step")
+			if stepFlag != nil && stepFlag.Changed {
+				step, err = strconv.Atoi(stepFlag.Value.String())
 				if err != nil {
-					log.Println("Error running fresh migrations:", err)
+					log.Println("Invalid step:", err)
+					return
+				}
+				if step < 1 {
+					log.Println("Step must be greater than 0")
+					return
+				}
+				if fresh {
+					log.Println("Step cannot be used with fresh")
+					return
+				}
+			}
+			to, _ := cmd.Flags().GetString("to")
+			if to != "" && (fresh || step > 0) {
+				log.Println("To cannot be used with fresh or step")
+				return
+			}
+			printSummary, _ := cmd.Flags().GetBool("summary")
+			if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+				if to != "" {
+					log.Println("Dry run cannot be used with to")
+					return
+				}
+				names, err := c.qafoia.RollbackPlan(ctx, step)
+				if err != nil {
+					log.Println("Error planning rollback:", err)
 					return
 				}
+				if len(names) == 0 {
+					log.Println("✅ No migrations to rollback")
+					return
+				}
+				for i, name := range names {
+					fmt.Printf("%d. %s\n", i+1, name)
+				}
+				return
+			}
+
+			c.enableProgress(cmd)
+			defer c.disableProgress()
+			var summary runSummary
+			if to != "" {
+				summary, err = c.qafoia.migrateTo(ctx, to)
+				if err != nil {
+					log.Println("Error running migrations:", err)
+				}
+			} else if fresh {
+				summary, err = c.qafoia.fresh(ctx)
+				if err != nil {
+					log.Println("Error running fresh migrations:", err)
+				}
+			} else if step > 0 {
+				summary, err = c.qafoia.migrateStep(ctx, step)
+				if err != nil {
+					log.Println("Error running migrations:", err)
+				}
 			} else {
-				err = c.qafoia.Migrate(ctx)
+				summary, err = c.qafoia.migrate(ctx)
 				if err != nil {
 					log.Println("Error running migrations:", err)
-					return
 				}
 			}
+			if printSummary {
+				fmt.Println(summary)
+			}
 		},
 	}
 
 	migrateCmd.Flags().BoolP("fresh", "f", false, "Run fresh migrations")
+	migrateCmd.Flags().IntP("step", "s", 0, "Number of pending migrations to apply, all if not set")
+	migrateCmd.Flags().String("to", "", "Apply pending migrations up to this migration, or \"latest\" for all")
+	migrateCmd.Flags().Bool("summary", false, "Print a machine-readable summary line at the end")
+	migrateCmd.Flags().Bool("no-progress", false, "Log each migration instead of showing a progress bar")
 
 	var rollbackCmd = &cobra.Command{
 		Use:   "rollback",
@@ -98,15 +208,34 @@ func (c *Cli) Execute(ctx context.Context) error {
 				}
 			}
 
-			err = c.qafoia.Rollback(ctx, step)
+			to, _ := cmd.Flags().GetString("to")
+			if to != "" && stepFlag != nil && stepFlag.Changed {
+				log.Println("To cannot be used with step")
+				return
+			}
+
+			c.enableProgress(cmd)
+			defer c.disableProgress()
+			var summary runSummary
+			if to != "" {
+				summary, err = c.qafoia.rollbackTo(ctx, to)
+			} else {
+				summary, err = c.qafoia.rollback(ctx, step)
+			}
 			if err != nil {
 				log.Println("Error rolling back migrations:", err)
-				return
+			}
+			if printSummary, _ := cmd.Flags().GetBool("summary"); printSummary {
+				fmt.Println(summary)
 			}
 		},
 	}
 
 	rollbackCmd.Flags().IntP("step", "s", 1, "Number of migrations to rollback")
+	rollbackCmd.Flags().String("to", "", "Roll back the migrations applied after this migration, or \"base\" for all")
+	rollbackCmd.Flags().Bool("dry-run", false, "List the migrations that would be rolled back, in order, without rolling back")
+	rollbackCmd.Flags().Bool("summary", false, "Print a machine-readable summary line at the end")
+	rollbackCmd.Flags().Bool("no-progress", false, "Log each migration instead of showing a progress bar")
 
 	var resetCmd = &cobra.Command{
 		Use:   "reset",
@@ -145,6 +274,162 @@ func (c *Cli) Execute(ctx context.Context) error {
 		},
 	}
 
+	var initCmd = &cobra.Command{
+		Use:   "init",
+		Short: "Create the migration table only",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := c.qafoia.Init(ctx)
+			if err != nil {
+				log.Println("Error initializing migration table:", err)
+				return
+			}
+		},
+	}
+
+	var orphansCmd = &cobra.Command{
+		Use:   "orphans",
+		Short: "List executed migrations that are not registered",
+		Run: func(cmd *cobra.Command, args []string) {
+			orphans, err := c.qafoia.Orphans(ctx)
+			if err != nil {
+				log.Println("Error listing orphaned migrations:", err)
+				return
+			}
+			if len(orphans) == 0 {
+				log.Println("✅ No orphaned migrations")
+				return
+			}
+			log.Printf("⚠️  Found %d orphaned migration(s):\n", len(orphans))
+			for _, name := range orphans {
+				fmt.Println(name)
+			}
+		},
+	}
+
+	var planCmd = &cobra.Command{
+		Use:   "plan",
+		Short: "List pending migrations in the order migrate would apply them",
+		Run: func(cmd *cobra.Command, args []string) {
+			names, err := c.qafoia.PlannedOrder(ctx)
+			if err != nil {
+				log.Println("Error planning migrations:", err)
+				return
+			}
+			if len(names) == 0 {
+				log.Println("✅ No migrations to run")
+				return
+			}
+			for i, name := range names {
+				fmt.Printf("%d. %s\n", i+1, name)
+			}
+		},
+	}
+
+	var preflightCmd = &cobra.Command{
+		Use:   "preflight",
+		Short: "Check that the database user can create, write to and drop tables",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := c.qafoia.Preflight(ctx)
+			if err != nil {
+				log.Println("Error running preflight:", err)
+				return
+			}
+		},
+	}
+
+	var prepareCmd = &cobra.Command{
+		Use:   "prepare",
+		Short: "Check that the SQL of pending migrations parses without running it",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := c.qafoia.PrepareAll(ctx)
+			if err != nil {
+				log.Printf("❌ Pending migrations are invalid:\n%s\n", err)
+				return
+			}
+			log.Println("✅ Pending migrations parse")
+		},
+	}
+
+	var fingerprintCmd = &cobra.Command{
+		Use:   "fingerprint",
+		Short: "Print a hash of the current schema for comparing against a known value",
+		Run: func(cmd *cobra.Command, args []string) {
+			fingerprint, err := c.qafoia.SchemaFingerprint(ctx)
+			if err != nil {
+				log.Println("Error fingerprinting schema:", err)
+				return
+			}
+			fmt.Println(fingerprint)
+		},
+	}
+
+	var markAppliedCmd = &cobra.Command{
+		Use:   "mark-applied <migration>...",
+		Short: "Record migrations as executed without running them",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := c.qafoia.MarkApplied(ctx, args...)
+			if err != nil {
+				log.Println("Error marking migrations as applied:", err)
+				return
+			}
+		},
+	}
+
+	var renameCmd = &cobra.Command{
+		Use:   "rename <old-migration> <new-migration>",
+		Short: "Rename an executed migration in the migration table",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := c.qafoia.Rename(ctx, args[0], args[1])
+			if err != nil {
+				log.Println("Error renaming migration:", err)
+				return
+			}
+		},
+	}
+
+	var repairCmd = &cobra.Command{
+		Use:   "repair",
+		Short: "Remove duplicate records and fill in missing execution times in the migration table",
+		Run: func(cmd *cobra.Command, args []string) {
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			err := c.qafoia.Repair(ctx, dryRun)
+			if err != nil {
+				log.Println("Error repairing migration table:", err)
+				return
+			}
+		},
+	}
+
+	repairCmd.Flags().Bool("dry-run", false, "Report the changes without making them")
+
+	var execCmd = &cobra.Command{
+		Use:   "exec <file>",
+		Short: "Execute an SQL file without recording it as a migration",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := c.qafoia.RunSQLFile(ctx, args[0])
+			if err != nil {
+				log.Println("Error executing SQL file:", err)
+				return
+			}
+		},
+	}
+
+	var verifyCmd = &cobra.Command{
+		Use:   "verify",
+		Short: "Check that the Go migration files parse and declare valid migrations",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := VerifyMigrationFiles(c.qafoia.migrationFilesDir)
+			if err != nil {
+				log.Printf("❌ Migration files are invalid:\n%s\n", err)
+				os.Exit(1)
+			}
+			log.Println("✅ Migration files are valid")
+		},
+	}
+
 	var rootCmd = &cobra.Command{
 		Use: c.cliName,
 		CompletionOptions: cobra.CompletionOptions{
@@ -163,7 +448,34 @@ func (c *Cli) Execute(ctx context.Context) error {
 		resetCmd,
 		cleanCmd,
 		createCmd,
+		orphansCmd,
+		planCmd,
+		preflightCmd,
+		prepareCmd,
+		fingerprintCmd,
+		initCmd,
+		verifyCmd,
+		markAppliedCmd,
+		renameCmd,
+		repairCmd,
+		execCmd,
 	)
 
 	return rootCmd.Execute()
 }
+
+// enableProgress shows a progress bar instead of per-migration log lines when stdout is a
+// terminal, unless disabled with --no-progress.
+func (c *Cli) enableProgress(cmd *cobra.Command) {
+	if noProgress, _ := cmd.Flags().GetBool("no-progress"); noProgress {
+		return
+	}
+	if isTerminal(os.Stdout) {
+		c.qafoia.progressOut = os.Stdout
+	}
+}
+
+// disableProgress restores line-by-line logging.
+func (c *Cli) disableProgress() {
+	c.qafoia.progressOut = nil
+}
@@ -2,6 +2,15 @@ package qafoia
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"time"
 )
 
 // Driver defines the contract for a migration driver implementation.
@@ -16,8 +25,9 @@ type Driver interface {
 	// If reverse is true, the list is returned in descending order (most recent first).
 	GetExecutedMigrations(ctx context.Context, reverse bool) ([]ExecutedMigration, error)
 
-	// CleanDatabase drops or truncates all user tables in the database.
-	CleanDatabase(ctx context.Context) error
+	// CleanDatabase drops or truncates all user tables in the database and returns the names
+	// of the tables it removed.
+	CleanDatabase(ctx context.Context) ([]string, error)
 
 	// ApplyMigrations applies a list of "up" migrations in sequence.
 	// The onRunning, onSuccess, and onFailed callbacks are triggered accordingly for each migration.
@@ -42,3 +52,676 @@ type Driver interface {
 	// Close gracefully closes the connection to the database or releases resources.
 	Close() error
 }
+
+// DiffMigrationGenerator is an optional interface implemented by drivers that can generate
+// a migration from the difference between the current database schema and a target database.
+type DiffMigrationGenerator interface {
+	// GenerateDiffMigration compares the current schema with the schema of the database
+	// at targetDSN and returns the SQL that migrates to the target and back.
+	GenerateDiffMigration(ctx context.Context, targetDSN string) (up string, down string, err error)
+}
+
+// DBProvider is an optional interface implemented by drivers backed by a single *sql.DB,
+// giving access to the connection pool the migrations run on.
+type DBProvider interface {
+	// DB returns the database handle of the driver. It is owned by the driver and must not
+	// be closed by the caller; use the driver's Close instead.
+	DB() *sql.DB
+}
+
+// DriverCapabilities describes the optional database features a driver supports, so behavior
+// that depends on them can be decided at runtime instead of per driver.
+type DriverCapabilities struct {
+	// TransactionalDDL reports whether schema changes can be rolled back with a transaction,
+	// which is what GroupedMigration relies on.
+	TransactionalDDL bool
+	// AdvisoryLocks reports whether the database offers locks that serialize concurrent runs.
+	AdvisoryLocks bool
+	// Copy reports whether CopyMigration data is loaded with a bulk COPY.
+	Copy bool
+	// StatementTimeouts reports whether a timeout can be set for the statements of a session.
+	StatementTimeouts bool
+	// CrossDatabase reports whether a DatabaseMigration can run on another database.
+	CrossDatabase bool
+	// SQLValidation reports whether SQL can be checked to parse without running it.
+	SQLValidation bool
+	// GTIDConsistency reports whether migrations run without mixing statements in one
+	// transaction or changing session-wide settings, as MySQL GTID replication requires.
+	GTIDConsistency bool
+}
+
+// CapabilityProvider is an optional interface implemented by drivers that advertise the
+// features they support. Drivers that do not implement it are assumed to support none.
+type CapabilityProvider interface {
+	Capabilities() DriverCapabilities
+}
+
+// driverCapabilities returns the capabilities advertised by driver, or none if it does not
+// implement CapabilityProvider.
+func driverCapabilities(driver Driver) DriverCapabilities {
+	if provider, ok := driver.(CapabilityProvider); ok {
+		return provider.Capabilities()
+	}
+	return DriverCapabilities{}
+}
+
+// DriverConfigurer is an optional interface implemented by drivers that accept the optional
+// settings of Config. New passes the settings to the driver only when it implements this
+// interface.
+type DriverConfigurer interface {
+	// SetNamespace sets the namespace that migration records are tracked under in the migration table.
+	// The empty namespace is the default one.
+	SetNamespace(namespace string)
+
+	// SetTwoPhaseRecording enables recording each migration that runs outside a transaction
+	// before it starts, with a null executed_at that is set once it succeeds.
+	SetTwoPhaseRecording(enabled bool)
+
+	// SetDelayBetweenMigrations sets how long ApplyMigrations waits between migrations.
+	// Zero disables the delay.
+	SetDelayBetweenMigrations(delay time.Duration)
+
+	// SetSQLTransform sets a function used to rewrite each migration script right before it
+	// is executed. A nil transform leaves scripts unchanged.
+	SetSQLTransform(transform SQLTransformFunc)
+
+	// SetStoreDownSQL enables saving the down script of each applied migration in the
+	// migration table, for rollbacks that must not depend on the current migration code.
+	SetStoreDownSQL(enabled bool)
+
+	// SetClock sets the clock used for the recorded execution time of migrations.
+	// A nil clock uses the system clock.
+	SetClock(clock Clock)
+
+	// SetRecordMigration sets a function called instead of the default insert that records
+	// a migration as executed. A nil function uses the default insert.
+	SetRecordMigration(record RecordMigrationFunc)
+
+	// SetRemoveMigration sets a function called instead of the default delete that removes
+	// the record of a rolled back migration. A nil function uses the default delete.
+	SetRemoveMigration(remove RemoveMigrationFunc)
+
+	// SetRecordDurations enables saving how long each migration took to apply in the
+	// migration table, returned as the Duration of executed migrations.
+	SetRecordDurations(enabled bool)
+
+	// SetCleanPrefix restricts CleanDatabase to the tables whose names start with prefix.
+	// An empty prefix cleans every table.
+	SetCleanPrefix(prefix string)
+}
+
+// ScriptExecutor is an optional interface implemented by drivers that can run an SQL script
+// that is not tracked as a migration, as used by PreMigrateSQL, PostMigrateSQL, hooks and
+// RunSQLFile.
+type ScriptExecutor interface {
+	// ExecuteSQL runs an arbitrary SQL script that is not tracked as a migration.
+	ExecuteSQL(ctx context.Context, sql string) error
+}
+
+// SchemaSnapshotter is an optional interface implemented by drivers that can take a snapshot
+// of the tables and columns of the current schema, as used by StrictReversibility.
+type SchemaSnapshotter interface {
+	// SnapshotCurrentSchema returns the columns of every table of the current schema,
+	// leaving out the migration table.
+	SnapshotCurrentSchema(ctx context.Context) (SchemaSnapshot, error)
+}
+
+// SchemaFingerprinter is an optional interface implemented by drivers that can hash the
+// table, column and index definitions of the current schema.
+type SchemaFingerprinter interface {
+	// SchemaFingerprint returns a hex-encoded hash of the current schema, leaving out the
+	// migration table.
+	SchemaFingerprint(ctx context.Context) (string, error)
+}
+
+// DriverCloner is an optional interface implemented by drivers that can be copied, so New
+// configures a copy and several Qafoia instances can share one driver.
+type DriverCloner interface {
+	// Clone returns a copy of the driver that shares its database connection but not the
+	// configuration set through the Driver setters.
+	Clone() Driver
+}
+
+// HistoryRecorder is an optional interface implemented by drivers that can change the
+// records of the migration table without running any migration SQL, as used by MarkApplied,
+// ImportHistory, Repair and MissingMigrationRemoveRecord.
+type HistoryRecorder interface {
+	// RecordExecutedMigration records the migration as executed at executedAt.
+	RecordExecutedMigration(ctx context.Context, name string, executedAt time.Time) error
+
+	// ForgetExecutedMigration removes the record of the migration.
+	ForgetExecutedMigration(ctx context.Context, name string) error
+
+	// SetExecutedAt changes the recorded execution time of the migration, such as to
+	// complete a record left in progress.
+	SetExecutedAt(ctx context.Context, name string, executedAt time.Time) error
+
+	// ReplaceExecutedMigration atomically replaces all records of the migration with a
+	// single one executed at executedAt.
+	ReplaceExecutedMigration(ctx context.Context, name string, executedAt time.Time) error
+}
+
+// HistoryRenamer is an optional interface implemented by drivers that can change the name a
+// migration is recorded under, as used by Rename.
+type HistoryRenamer interface {
+	// RenameExecutedMigration changes the name of the record of oldName to newName, keeping
+	// the rest of the record.
+	RenameExecutedMigration(ctx context.Context, oldName string, newName string) error
+}
+
+// SQLValidator is an optional interface implemented by drivers that can check that an SQL
+// script parses without running it, as used by PrepareAll.
+type SQLValidator interface {
+	// ValidateSQL returns an error describing the problems of the script of the named
+	// migration, or nil if the database accepts it.
+	ValidateSQL(ctx context.Context, name string, script string) error
+}
+
+// ReplicaReader is an optional interface implemented by drivers that can read the executed
+// migrations from a read replica, as used by List.
+type ReplicaReader interface {
+	// GetExecutedMigrationsFromReplica returns the executed migrations ordered by name, read
+	// from the replica, or from the primary when none is configured.
+	GetExecutedMigrationsFromReplica(ctx context.Context) ([]ExecutedMigration, error)
+}
+
+// HistoryReader is an optional interface implemented by drivers that can read every column
+// of the migration table, including optional metadata columns, as used by History.
+type HistoryReader interface {
+	// ReadHistory returns the records of the migration table ordered by name.
+	ReadHistory(ctx context.Context) (MigrationHistory, error)
+}
+
+// MigrationTableCreator is an optional interface implemented by drivers that can create the
+// migration table with a caller-supplied executor, such as a transaction, as used by InitTx.
+// It requires transactional DDL.
+type MigrationTableCreator interface {
+	// CreateMigrationsTableWith creates the migration table, if it does not exist, with exec.
+	CreateMigrationsTableWith(ctx context.Context, exec SQLExecutor) error
+}
+
+// ShardReader is an optional interface implemented by drivers over several shards that can
+// read the executed migrations of each shard separately.
+type ShardReader interface {
+	// ExecutedMigrationsByShard returns the shard names and, at the same index, the executed
+	// migrations of each shard.
+	ExecutedMigrationsByShard(ctx context.Context) ([]string, [][]ExecutedMigration, error)
+}
+
+// VersionReader is an optional interface implemented by drivers whose migration table
+// numbers executed migrations with an auto-incrementing version column.
+type VersionReader interface {
+	// ReadVersions returns the version of each executed migration by name.
+	ReadVersions(ctx context.Context) (map[string]int, error)
+}
+
+// MigrationLocker is an optional interface implemented by drivers that can hold a lock
+// serializing migration runs across processes, as used by Config.LockTimeout.
+type MigrationLocker interface {
+	// AcquireLock waits up to timeout for the lock and returns a function that releases it.
+	// It returns ErrMigrationLocked if the lock is not available in time.
+	AcquireLock(ctx context.Context, timeout time.Duration) (release func() error, err error)
+}
+
+// migrationLockName returns the name of the lock guarding the migration table, so runs on
+// different tables or namespaces do not wait for each other.
+func migrationLockName(tableName string, namespace string) string {
+	if namespace == "" {
+		return "qafoia:" + tableName
+	}
+	return "qafoia:" + tableName + ":" + namespace
+}
+
+// SQLExecutor is the subset of *sql.DB, *sql.Conn and *sql.Tx used by the drivers, which
+// allows the same code to run statements directly or inside a transaction.
+type SQLExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// driverOptions holds the settings applied by DriverOption values when constructing a driver.
+type driverOptions struct {
+	waitForDB    time.Duration
+	sessionSetup []string
+	replicaDSN   string
+	createDB     bool
+	gtidSafe     bool
+}
+
+// DriverOption configures optional behavior of the built-in drivers at construction time.
+type DriverOption func(options *driverOptions)
+
+// WaitForDB makes the driver constructor retry connecting, with backoff, until the
+// database is reachable or the timeout elapses.
+func WaitForDB(timeout time.Duration) DriverOption {
+	return func(options *driverOptions) {
+		options.waitForDB = timeout
+	}
+}
+
+// SessionSetup makes the driver run the given SQL statements on every new database
+// connection before it is used, such as SET ROLE or SET search_path, so that objects created
+// by migrations get the right owner and schema.
+func SessionSetup(statements ...string) DriverOption {
+	return func(options *driverOptions) {
+		options.sessionSetup = append(options.sessionSetup, statements...)
+	}
+}
+
+// ReadReplica makes the driver also connect to a read replica at dsn, in the format of the
+// driver's own DSN, and read the migration table from it for List and History. Migrate,
+// Rollback and every other operation keep reading from the primary, so replication lag never
+// makes a migration look pending again.
+func ReadReplica(dsn string) DriverOption {
+	return func(options *driverOptions) {
+		options.replicaDSN = dsn
+	}
+}
+
+// CreateDatabaseIfMissing makes the driver constructor connect to the server's default
+// database first and create the database named in the DSN if it does not exist yet. It is
+// meant for development and test setups; production databases should be provisioned on
+// their own, so nothing is ever created unless the option is given.
+func CreateDatabaseIfMissing() DriverOption {
+	return func(options *driverOptions) {
+		options.createDB = true
+	}
+}
+
+// GTIDSafe makes the MySQL driver run each migration on a dedicated connection from the pool
+// with autocommit enabled, so every statement commits on its own, and clean the database
+// without the session-wide SET FOREIGN_KEY_CHECKS, which servers enforcing GTID consistency
+// reject mixed with other statements. It is enabled automatically when the server has
+// enforce_gtid_consistency on; the option forces it for servers that only warn. The Postgres
+// driver ignores it.
+func GTIDSafe() DriverOption {
+	return func(options *driverOptions) {
+		options.gtidSafe = true
+	}
+}
+
+// newDriverOptions applies the given options on top of the defaults.
+func newDriverOptions(opts []DriverOption) driverOptions {
+	options := driverOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// pingDatabase pings the database, retrying with exponential backoff until it succeeds or
+// the timeout elapses. A zero timeout pings exactly once.
+func pingDatabase(db *sql.DB, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := 100 * time.Millisecond
+
+	for {
+		err := db.Ping()
+		if err == nil {
+			return nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return err
+		}
+
+		time.Sleep(min(backoff, remaining))
+		backoff = min(backoff*2, 2*time.Second)
+	}
+}
+
+// sleepContext waits for the given duration or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// ensureDatabase connects to the server at serverDSN and creates the database name when
+// existsQuery, which takes the name as its only argument, returns no row.
+func ensureDatabase(driverName string, serverDSN string, options driverOptions, name string, existsQuery string, createQuery string) error {
+	db, err := sql.Open(driverName, serverDSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := pingDatabase(db, options.waitForDB); err != nil {
+		return fmt.Errorf("failed to connect to the server to create database %s: %w", name, err)
+	}
+
+	return createDatabaseIfMissing(context.Background(), db, name, existsQuery, createQuery)
+}
+
+// createDatabaseIfMissing runs createQuery on db when existsQuery returns no row for name.
+func createDatabaseIfMissing(ctx context.Context, db *sql.DB, name string, existsQuery string, createQuery string) error {
+	var exists int
+	err := db.QueryRowContext(ctx, existsQuery, name).Scan(&exists)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, createQuery); err != nil {
+		return fmt.Errorf("failed to create database %s: %w", name, err)
+	}
+	log.Printf("🆕 Created database: %s\n", name)
+	return nil
+}
+
+// openReplica connects to the read replica configured in options, if any. A nil handle is
+// returned when no replica is configured.
+func openReplica(driverName string, dsn string, options driverOptions) (*sql.DB, error) {
+	if dsn == "" {
+		return nil, nil
+	}
+
+	replica, err := openDatabase(driverName, dsn, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pingDatabase(replica, options.waitForDB); err != nil {
+		replica.Close()
+		return nil, fmt.Errorf("failed to connect to read replica: %w", err)
+	}
+
+	return replica, nil
+}
+
+// scanMigrationHistory reads migration table rows selected with all their columns. The name,
+// executed_at and duration_ms columns fill the fields of ExecutedMigration, and every other
+// column except namespace is kept in Metadata, so columns added to the table are picked up
+// when present.
+func scanMigrationHistory(rows *sql.Rows) (MigrationHistory, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var history MigrationHistory
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		var m ExecutedMigration
+		for i, column := range columns {
+			value := values[i]
+			if b, ok := value.([]byte); ok {
+				value = string(b)
+			}
+
+			switch column {
+			case "name":
+				m.Name, _ = value.(string)
+			case "executed_at":
+				executedAt, ok := value.(time.Time)
+				m.ExecutedAt = executedAt
+				m.InProgress = !ok
+			case "duration_ms":
+				if ms, ok := value.(int64); ok {
+					m.Duration = time.Duration(ms) * time.Millisecond
+				}
+			case "namespace":
+			default:
+				if m.Metadata == nil {
+					m.Metadata = make(map[string]any)
+				}
+				m.Metadata[column] = value
+			}
+		}
+		history = append(history, m)
+	}
+
+	return history, rows.Err()
+}
+
+// selectCleanTables returns the tables of tables that CleanDatabase drops with the clean
+// prefix: those whose names start with it. When the migration table does not, it may be
+// shared with other applications, so clearRecords reports that only the records of the
+// namespace must be deleted from it. With an empty prefix every table is dropped.
+func selectCleanTables(tables []string, prefix string, migrationTableName string) (selected []string, clearRecords bool) {
+	if prefix == "" {
+		return tables, false
+	}
+
+	for _, table := range tables {
+		switch {
+		case strings.HasPrefix(table, prefix):
+			selected = append(selected, table)
+		case table == migrationTableName:
+			clearRecords = true
+		}
+	}
+	return selected, clearRecords
+}
+
+// migrationRecords builds the WHERE clauses that restrict statements on the migration table
+// to the records of one namespace. The empty namespace is a namespace of its own, so an
+// application without one never reads or changes the records of a namespaced application
+// sharing the table.
+type migrationRecords struct {
+	namespace   string
+	placeholder func(n int) string
+}
+
+// inNamespace returns the WHERE clause selecting every record of the namespace, bound to
+// placeholder n, and its argument.
+func (r migrationRecords) inNamespace(n int) (string, []any) {
+	return "WHERE namespace = " + r.placeholder(n), []any{r.namespace}
+}
+
+// named returns the WHERE clause selecting the record of the named migration in the
+// namespace, bound to placeholders n and n+1, and its arguments.
+func (r migrationRecords) named(n int, name string) (string, []any) {
+	return fmt.Sprintf("WHERE namespace = %s AND name = %s", r.placeholder(n), r.placeholder(n+1)), []any{r.namespace, name}
+}
+
+// checkMigrationTableColumns explains a failure to read the migration table named table. It
+// reads the columns of the table with columnsQuery and, if the table exists but lacks any of
+// the required columns, returns ErrInvalidMigrationTable naming them instead of cause, which
+// is otherwise returned as is.
+func checkMigrationTableColumns(ctx context.Context, db *sql.DB, columnsQuery string, table string, required []string, cause error) error {
+	rows, err := db.QueryContext(context.WithoutCancel(ctx), columnsQuery, table)
+	if err != nil {
+		return cause
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return cause
+		}
+		columns = append(columns, strings.ToLower(column))
+	}
+	if rows.Err() != nil || len(columns) == 0 {
+		return cause
+	}
+
+	var missing []string
+	for _, column := range required {
+		if !slices.Contains(columns, column) {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) == 0 {
+		return cause
+	}
+	return fmt.Errorf("%w: %s is missing columns %s; expected columns %s",
+		ErrInvalidMigrationTable, table, strings.Join(missing, ", "), strings.Join(required, ", "))
+}
+
+// scanMigrationVersions reads name and version rows into a map keyed by name. Rows without a
+// version are left out.
+func scanMigrationVersions(rows *sql.Rows) (map[string]int, error) {
+	versions := make(map[string]int)
+	for rows.Next() {
+		var name string
+		var version sql.NullInt64
+		if err := rows.Scan(&name, &version); err != nil {
+			return nil, err
+		}
+		if version.Valid {
+			versions[name] = int(version.Int64)
+		}
+	}
+	return versions, rows.Err()
+}
+
+// storedDownScriptsKey is the context key under which Qafoia passes the down scripts stored
+// in the migration table to UnapplyMigrations, for Config.RollbackFromStored.
+type storedDownScriptsKey struct{}
+
+// withStoredDownScripts returns ctx carrying the stored down scripts, by migration name.
+func withStoredDownScripts(ctx context.Context, scripts map[string]string) context.Context {
+	return context.WithValue(ctx, storedDownScriptsKey{}, scripts)
+}
+
+// downScript returns the down script to run for the migration: the one stored in the
+// migration table when ctx carries one for it, or its registered DownScript otherwise.
+// Passing the stored script this way, rather than wrapping the migration, keeps every
+// optional interface of the migration visible to the driver.
+func downScript(ctx context.Context, migration Migration) string {
+	if scripts, ok := ctx.Value(storedDownScriptsKey{}).(map[string]string); ok {
+		if script, stored := scripts[migration.Name()]; stored {
+			return script
+		}
+	}
+	return migration.DownScript()
+}
+
+// withMigrationTimeout returns ctx limited to the timeout of a TimeoutMigration, or ctx as is
+// for migrations without one. Canceling the context makes lib/pq cancel the statement on the
+// server, while go-sql-driver/mysql only closes the connection.
+func withMigrationTimeout(ctx context.Context, migration Migration) (context.Context, context.CancelFunc) {
+	if timed, ok := migration.(TimeoutMigration); ok && timed.Timeout() > 0 {
+		return context.WithTimeout(ctx, timed.Timeout())
+	}
+	return ctx, func() {}
+}
+
+// isNonTransactional reports whether the migration asks to run its script one statement at a
+// time, outside a transaction.
+func isNonTransactional(migration Migration) bool {
+	nonTransactional, ok := migration.(NonTransactionalMigration)
+	return ok && nonTransactional.NoTransaction()
+}
+
+// streamMigrationSQL opens a script of a StreamedMigration with open and runs each of its
+// statements with execute as it is read.
+func streamMigrationSQL(open func() (io.Reader, error), dialect sqlDialect, execute func(statement string) error) error {
+	r, err := open()
+	if err != nil {
+		return fmt.Errorf("failed to open migration script: %w", err)
+	}
+	if closer, ok := r.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	return splitSQLStatements(r, dialect, execute)
+}
+
+// openDatabase opens a database handle for the registered database/sql driver, running the
+// session setup statements of the options on every new connection.
+func openDatabase(driverName string, dsn string, options driverOptions) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil || len(options.sessionSetup) == 0 {
+		return db, err
+	}
+
+	connector := &sessionConnector{dsn: dsn, driver: db.Driver(), setup: options.sessionSetup}
+	if err := db.Close(); err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(connector), nil
+}
+
+// sessionConnector is a driver.Connector that runs setup statements on each new connection.
+type sessionConnector struct {
+	dsn    string
+	driver driver.Driver
+	setup  []string
+}
+
+func (c *sessionConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	var conn driver.Conn
+	var err error
+	if driverCtx, ok := c.driver.(driver.DriverContext); ok {
+		var connector driver.Connector
+		connector, err = driverCtx.OpenConnector(c.dsn)
+		if err != nil {
+			return nil, err
+		}
+		conn, err = connector.Connect(ctx)
+	} else {
+		conn, err = c.driver.Open(c.dsn)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, statement := range c.setup {
+		if err := execOnConn(ctx, conn, statement); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to run session setup %q: %w", statement, err)
+		}
+	}
+
+	return conn, nil
+}
+
+func (c *sessionConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// execOnConn executes a statement without arguments directly on a driver connection.
+func execOnConn(ctx context.Context, conn driver.Conn, statement string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(ctx, statement, nil)
+		if err != driver.ErrSkip {
+			return err
+		}
+	}
+
+	stmt, err := conn.Prepare(statement)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	if stmtCtx, ok := stmt.(driver.StmtExecContext); ok {
+		_, err = stmtCtx.ExecContext(ctx, nil)
+		return err
+	}
+	_, err = stmt.Exec(nil)
+	return err
+}
+
+// clockNow returns the current time of clock, or of the system clock if clock is nil.
+func clockNow(clock Clock) time.Time {
+	if clock == nil {
+		return time.Now()
+	}
+	return clock.Now()
+}
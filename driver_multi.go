@@ -0,0 +1,574 @@
+package qafoia
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Shard is a named database that a MultiDriver fans operations out to.
+type Shard struct {
+	Name   string
+	Driver Driver
+}
+
+// MultiDriver implements the Driver interface on top of several shards, so the same
+// migrations are applied to and rolled back from every shard. Each shard keeps its own
+// migration table: a migration is only applied to the shards where it has not been
+// executed yet, and only rolled back from the shards where it has been.
+type MultiDriver struct {
+	shards      []Shard
+	concurrency int
+}
+
+// NewMultiDriver creates a MultiDriver over the given shards. Up to concurrency shards are
+// migrated at the same time; a concurrency of 1 or less migrates them one after another.
+func NewMultiDriver(concurrency int, shards ...Shard) (*MultiDriver, error) {
+	if len(shards) == 0 {
+		return nil, ErrNoShards
+	}
+
+	return &MultiDriver{
+		shards:      shards,
+		concurrency: max(concurrency, 1),
+	}, nil
+}
+
+// Clone returns a MultiDriver over copies of the shard drivers that can be copied.
+func (d *MultiDriver) Clone() Driver {
+	shards := make([]Shard, len(d.shards))
+	for i, shard := range d.shards {
+		if cloner, ok := shard.Driver.(DriverCloner); ok {
+			shard.Driver = cloner.Clone()
+		}
+		shards[i] = shard
+	}
+	return &MultiDriver{shards: shards, concurrency: d.concurrency}
+}
+
+// AcquireLock takes the migration lock of every shard, in shard order, releasing the ones
+// already taken if a shard times out or does not support locking.
+func (d *MultiDriver) AcquireLock(ctx context.Context, timeout time.Duration) (func() error, error) {
+	var releases []func() error
+	release := func() error {
+		var errs []error
+		for i := len(releases) - 1; i >= 0; i-- {
+			errs = append(errs, releases[i]())
+		}
+		return errors.Join(errs...)
+	}
+
+	for _, shard := range d.shards {
+		locker, ok := shard.Driver.(MigrationLocker)
+		if !ok {
+			release()
+			return nil, &ShardError{Shard: shard.Name, Err: ErrLockingNotSupported}
+		}
+		r, err := locker.AcquireLock(ctx, timeout)
+		if err != nil {
+			release()
+			return nil, &ShardError{Shard: shard.Name, Err: err}
+		}
+		releases = append(releases, r)
+	}
+
+	return release, nil
+}
+
+// SetMigrationTableName sets the migration table name of every shard.
+func (d *MultiDriver) SetMigrationTableName(name string) {
+	for _, shard := range d.shards {
+		shard.Driver.SetMigrationTableName(name)
+	}
+}
+
+// SetNamespace sets the namespace of every shard.
+func (d *MultiDriver) SetNamespace(namespace string) {
+	for _, shard := range d.shards {
+		if configurer, ok := shard.Driver.(DriverConfigurer); ok {
+			configurer.SetNamespace(namespace)
+		}
+	}
+}
+
+// SetTwoPhaseRecording enables or disables two-phase recording on every shard.
+func (d *MultiDriver) SetTwoPhaseRecording(enabled bool) {
+	for _, shard := range d.shards {
+		if configurer, ok := shard.Driver.(DriverConfigurer); ok {
+			configurer.SetTwoPhaseRecording(enabled)
+		}
+	}
+}
+
+// SetDelayBetweenMigrations sets the delay between migrations of every shard.
+func (d *MultiDriver) SetDelayBetweenMigrations(delay time.Duration) {
+	for _, shard := range d.shards {
+		if configurer, ok := shard.Driver.(DriverConfigurer); ok {
+			configurer.SetDelayBetweenMigrations(delay)
+		}
+	}
+}
+
+// SetStoreDownSQL enables or disables storing down scripts on every shard.
+func (d *MultiDriver) SetStoreDownSQL(enabled bool) {
+	for _, shard := range d.shards {
+		if configurer, ok := shard.Driver.(DriverConfigurer); ok {
+			configurer.SetStoreDownSQL(enabled)
+		}
+	}
+}
+
+// SetRecordDurations enables recording durations on every shard.
+func (d *MultiDriver) SetRecordDurations(enabled bool) {
+	for _, shard := range d.shards {
+		if configurer, ok := shard.Driver.(DriverConfigurer); ok {
+			configurer.SetRecordDurations(enabled)
+		}
+	}
+}
+
+// SetClock sets the clock of every shard.
+func (d *MultiDriver) SetClock(clock Clock) {
+	for _, shard := range d.shards {
+		if configurer, ok := shard.Driver.(DriverConfigurer); ok {
+			configurer.SetClock(clock)
+		}
+	}
+}
+
+// SetRecordMigration sets the record function of every shard.
+func (d *MultiDriver) SetRecordMigration(record RecordMigrationFunc) {
+	for _, shard := range d.shards {
+		if configurer, ok := shard.Driver.(DriverConfigurer); ok {
+			configurer.SetRecordMigration(record)
+		}
+	}
+}
+
+// SetRemoveMigration sets the remove function of every shard.
+func (d *MultiDriver) SetRemoveMigration(remove RemoveMigrationFunc) {
+	for _, shard := range d.shards {
+		if configurer, ok := shard.Driver.(DriverConfigurer); ok {
+			configurer.SetRemoveMigration(remove)
+		}
+	}
+}
+
+// SetCleanPrefix sets the clean prefix of every shard.
+func (d *MultiDriver) SetCleanPrefix(prefix string) {
+	for _, shard := range d.shards {
+		if configurer, ok := shard.Driver.(DriverConfigurer); ok {
+			configurer.SetCleanPrefix(prefix)
+		}
+	}
+}
+
+// SetSQLTransform sets the SQL transform of every shard.
+func (d *MultiDriver) SetSQLTransform(transform SQLTransformFunc) {
+	for _, shard := range d.shards {
+		if configurer, ok := shard.Driver.(DriverConfigurer); ok {
+			configurer.SetSQLTransform(transform)
+		}
+	}
+}
+
+// CreateMigrationsTable creates the migration table on every shard.
+func (d *MultiDriver) CreateMigrationsTable(ctx context.Context) error {
+	return d.fanOut(ctx, "create migration table", func(shard Shard) error {
+		return shard.Driver.CreateMigrationsTable(ctx)
+	})
+}
+
+// GetExecutedMigrations returns the migrations executed on every shard, in the order of the
+// first shard. A migration missing from any shard is therefore reported as pending.
+func (d *MultiDriver) GetExecutedMigrations(ctx context.Context, reverse bool) ([]ExecutedMigration, error) {
+	var executed []ExecutedMigration
+	counts := make(map[string]int)
+	for i, shard := range d.shards {
+		migrations, err := shard.Driver.GetExecutedMigrations(ctx, reverse)
+		if err != nil {
+			return nil, &ShardError{Shard: shard.Name, Err: err}
+		}
+		if i == 0 {
+			executed = migrations
+		}
+		for _, m := range migrations {
+			counts[m.Name]++
+		}
+	}
+
+	common := make([]ExecutedMigration, 0, len(executed))
+	for _, m := range executed {
+		if counts[m.Name] == len(d.shards) {
+			common = append(common, m)
+		}
+	}
+
+	return common, nil
+}
+
+// ExecutedMigrationsByShard returns the shard names and the migrations executed on each
+// shard, in shard order.
+func (d *MultiDriver) ExecutedMigrationsByShard(ctx context.Context) ([]string, [][]ExecutedMigration, error) {
+	names := make([]string, len(d.shards))
+	executed := make([][]ExecutedMigration, len(d.shards))
+	for i, shard := range d.shards {
+		migrations, err := shard.Driver.GetExecutedMigrations(ctx, false)
+		if err != nil {
+			return nil, nil, &ShardError{Shard: shard.Name, Err: err}
+		}
+		names[i] = shard.Name
+		executed[i] = migrations
+	}
+	return names, executed, nil
+}
+
+// ExecuteSQL runs the SQL script on every shard.
+func (d *MultiDriver) ExecuteSQL(ctx context.Context, sql string) error {
+	return d.fanOut(ctx, "execute SQL", func(shard Shard) error {
+		executor, ok := shard.Driver.(ScriptExecutor)
+		if !ok {
+			return ErrExecuteSQLNotSupported
+		}
+		return executor.ExecuteSQL(ctx, sql)
+	})
+}
+
+// CleanDatabase cleans every shard. The dropped tables are returned in shard order, each
+// prefixed with the name of its shard and a slash.
+func (d *MultiDriver) CleanDatabase(ctx context.Context) ([]string, error) {
+	var mu sync.Mutex
+	droppedByShard := make(map[string][]string, len(d.shards))
+
+	err := d.fanOut(ctx, "clean database", func(shard Shard) error {
+		tables, err := shard.Driver.CleanDatabase(ctx)
+		mu.Lock()
+		defer mu.Unlock()
+		for _, table := range tables {
+			droppedByShard[shard.Name] = append(droppedByShard[shard.Name], shard.Name+"/"+table)
+		}
+		return err
+	})
+
+	var dropped []string
+	for _, shard := range d.shards {
+		dropped = append(dropped, droppedByShard[shard.Name]...)
+	}
+	return dropped, err
+}
+
+// ApplyMigrations applies the migrations that are pending on each shard. The callbacks are
+// called once per migration, never concurrently: onRunning when the first shard starts it,
+// and onSuccess or onFailed, with the errors of every failed shard joined, once every shard
+// running it has finished.
+func (d *MultiDriver) ApplyMigrations(
+	ctx context.Context,
+	migrations []Migration,
+	onRunning func(migration *Migration),
+	onSuccess func(migration *Migration),
+	onFailed func(migration *Migration, err error),
+) error {
+	return d.runOnShards(ctx, "migrate", migrations, false, newShardCallbacks(migrations, onRunning, onSuccess, onFailed),
+		func(shard Shard, pending []Migration, callbacks *shardCallbacks) error {
+			return shard.Driver.ApplyMigrations(ctx, pending,
+				callbacks.running(shard.Name), callbacks.succeeded(shard.Name), callbacks.failed(shard.Name))
+		})
+}
+
+// UnapplyMigrations rolls back the migrations that are executed on each shard. The callbacks
+// are called once per migration, as for ApplyMigrations.
+func (d *MultiDriver) UnapplyMigrations(
+	ctx context.Context,
+	migrations []Migration,
+	onRunning func(migration *Migration),
+	onSuccess func(migration *Migration),
+	onFailed func(migration *Migration, err error),
+) error {
+	return d.runOnShards(ctx, "rollback", migrations, true, newShardCallbacks(migrations, onRunning, onSuccess, onFailed),
+		func(shard Shard, executed []Migration, callbacks *shardCallbacks) error {
+			return shard.Driver.UnapplyMigrations(ctx, executed,
+				callbacks.running(shard.Name), callbacks.succeeded(shard.Name), callbacks.failed(shard.Name))
+		})
+}
+
+// runOnShards runs the migrations that are executed on each shard if executed is true, or
+// the ones that are not if it is false. Every shard is filtered before any migration runs,
+// so callbacks knows how many shards each migration runs on before the first one finishes.
+// The shardResultFunc in ctx, if any, receives the outcome on each shard.
+func (d *MultiDriver) runOnShards(
+	ctx context.Context,
+	operation string,
+	migrations []Migration,
+	executed bool,
+	callbacks *shardCallbacks,
+	run func(shard Shard, migrations []Migration, callbacks *shardCallbacks) error,
+) error {
+	callbacks.onShard, _ = ctx.Value(shardResultsKey{}).(shardResultFunc)
+
+	var mu sync.Mutex
+	filtered := make(map[string][]Migration, len(d.shards))
+	err := d.fanOut(ctx, operation, func(shard Shard) error {
+		selected, err := filterByExecution(ctx, shard.Driver, migrations, executed)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		filtered[shard.Name] = selected
+		callbacks.expect(selected)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = d.fanOut(ctx, operation, func(shard Shard) error {
+		if len(filtered[shard.Name]) == 0 {
+			return nil
+		}
+		return run(shard, filtered[shard.Name], callbacks)
+	})
+	callbacks.flush()
+	return err
+}
+
+// Capabilities reports the features supported by every shard.
+func (d *MultiDriver) Capabilities() DriverCapabilities {
+	capabilities := driverCapabilities(d.shards[0].Driver)
+	for _, shard := range d.shards[1:] {
+		c := driverCapabilities(shard.Driver)
+		capabilities.TransactionalDDL = capabilities.TransactionalDDL && c.TransactionalDDL
+		capabilities.AdvisoryLocks = capabilities.AdvisoryLocks && c.AdvisoryLocks
+		capabilities.Copy = capabilities.Copy && c.Copy
+		capabilities.StatementTimeouts = capabilities.StatementTimeouts && c.StatementTimeouts
+		capabilities.CrossDatabase = capabilities.CrossDatabase && c.CrossDatabase
+		capabilities.SQLValidation = capabilities.SQLValidation && c.SQLValidation
+		capabilities.GTIDConsistency = capabilities.GTIDConsistency && c.GTIDConsistency
+	}
+	return capabilities
+}
+
+// Close closes every shard.
+func (d *MultiDriver) Close() error {
+	var errs []error
+	for _, shard := range d.shards {
+		if err := shard.Driver.Close(); err != nil {
+			errs = append(errs, &ShardError{Shard: shard.Name, Err: err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// fanOut runs fn for every shard, up to the configured concurrency at a time, and logs which
+// shards succeeded and which failed. The errors of all failed shards are returned together
+// as ShardErrors.
+func (d *MultiDriver) fanOut(ctx context.Context, operation string, fn func(shard Shard) error) error {
+	errs := make([]error, len(d.shards))
+	semaphore := make(chan struct{}, d.concurrency)
+
+	var wg sync.WaitGroup
+	for i, shard := range d.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+				errs[i] = &ShardError{Shard: shard.Name, Err: ctx.Err()}
+				return
+			}
+
+			if err := fn(shard); err != nil {
+				errs[i] = &ShardError{Shard: shard.Name, Err: err}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var succeeded, failed []string
+	for i, shard := range d.shards {
+		if errs[i] != nil {
+			failed = append(failed, shard.Name)
+		} else {
+			succeeded = append(succeeded, shard.Name)
+		}
+	}
+	if len(failed) > 0 {
+		log.Printf("⚠️  %s succeeded on shards %v and failed on shards %v\n", operation, succeeded, failed)
+	}
+
+	return errors.Join(errs...)
+}
+
+// filterByExecution returns the migrations that are executed on the driver if executed is
+// true, or the ones that are not executed if it is false, preserving order.
+func filterByExecution(ctx context.Context, driver Driver, migrations []Migration, executed bool) ([]Migration, error) {
+	executedMigrations, err := driver.GetExecutedMigrations(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	executedMap := make(map[string]struct{}, len(executedMigrations))
+	for _, m := range executedMigrations {
+		executedMap[m.Name] = struct{}{}
+	}
+
+	filtered := make([]Migration, 0, len(migrations))
+	for _, m := range migrations {
+		if _, found := executedMap[m.Name()]; found == executed {
+			filtered = append(filtered, m)
+		}
+	}
+	return filtered, nil
+}
+
+// shardResultsKey is the context key of the shardResultFunc passed to MultiDriver.
+type shardResultsKey struct{}
+
+// shardResultFunc receives the outcome of a migration on a single shard, started at started,
+// for the callers that need more than the merged callbacks, such as the audit log.
+type shardResultFunc func(shard string, migration Migration, started time.Time, err error)
+
+// withShardResults returns ctx carrying fn, which MultiDriver calls with the outcome of each
+// migration on each shard.
+func withShardResults(ctx context.Context, fn shardResultFunc) context.Context {
+	return context.WithValue(ctx, shardResultsKey{}, fn)
+}
+
+// shardCallbacks merges the migration callbacks of several shards into one call per
+// migration. Its methods are safe for concurrent use and never call the callbacks
+// concurrently.
+type shardCallbacks struct {
+	mu           sync.Mutex
+	migrations   []Migration
+	remaining    map[string]int
+	started      map[string]*Migration
+	shardStarted map[[2]string]time.Time
+	errs         map[string][]error
+	onRunning    func(migration *Migration)
+	onSuccess    func(migration *Migration)
+	onFailed     func(migration *Migration, err error)
+	onShard      shardResultFunc
+}
+
+// newShardCallbacks creates a shardCallbacks for migrations, in the order they are reported
+// by flush.
+func newShardCallbacks(
+	migrations []Migration,
+	onRunning func(migration *Migration),
+	onSuccess func(migration *Migration),
+	onFailed func(migration *Migration, err error),
+) *shardCallbacks {
+	return &shardCallbacks{
+		migrations:   migrations,
+		remaining:    make(map[string]int),
+		started:      make(map[string]*Migration),
+		shardStarted: make(map[[2]string]time.Time),
+		errs:         make(map[string][]error),
+		onRunning:    onRunning,
+		onSuccess:    onSuccess,
+		onFailed:     onFailed,
+	}
+}
+
+// expect records that one more shard will run migrations.
+func (c *shardCallbacks) expect(migrations []Migration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, m := range migrations {
+		c.remaining[m.Name()]++
+	}
+}
+
+// running returns the onRunning callback of the named shard, which calls onRunning when the
+// first shard starts the migration.
+func (c *shardCallbacks) running(shard string) func(*Migration) {
+	return func(m *Migration) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.shardStarted[[2]string{shard, (*m).Name()}] = time.Now()
+		c.start(m)
+	}
+}
+
+// succeeded returns the onSuccess callback of the named shard.
+func (c *shardCallbacks) succeeded(shard string) func(*Migration) {
+	return func(m *Migration) {
+		c.finish(shard, m, nil)
+	}
+}
+
+// failed returns the onFailed callback of the named shard.
+func (c *shardCallbacks) failed(shard string) func(*Migration, error) {
+	return func(m *Migration, err error) {
+		c.finish(shard, m, err)
+	}
+}
+
+// finish records the outcome of the migration on a shard, and reports it once every shard
+// running it has finished.
+func (c *shardCallbacks) finish(shard string, m *Migration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	name := (*m).Name()
+	c.start(m)
+	if c.onShard != nil {
+		started, found := c.shardStarted[[2]string{shard, name}]
+		if !found {
+			started = time.Now()
+		}
+		c.onShard(shard, *m, started, err)
+	}
+	if err != nil {
+		c.errs[name] = append(c.errs[name], &ShardError{Shard: shard, Err: err})
+	}
+	c.remaining[name]--
+	if c.remaining[name] <= 0 {
+		c.report(name)
+	}
+}
+
+// flush reports the migrations that were started but will not be finished by every shard,
+// because a shard stopped at an earlier failure.
+func (c *shardCallbacks) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, m := range c.migrations {
+		if c.remaining[m.Name()] > 0 {
+			c.report(m.Name())
+		}
+	}
+}
+
+// start calls onRunning the first time the migration is started. c.mu must be held.
+func (c *shardCallbacks) start(m *Migration) {
+	name := (*m).Name()
+	if _, started := c.started[name]; started {
+		return
+	}
+	c.started[name] = m
+	if c.onRunning != nil {
+		c.onRunning(m)
+	}
+}
+
+// report calls onSuccess or onFailed for a started migration. c.mu must be held.
+func (c *shardCallbacks) report(name string) {
+	m, started := c.started[name]
+	if !started {
+		return
+	}
+	c.remaining[name] = 0
+
+	if errs := c.errs[name]; len(errs) > 0 {
+		if c.onFailed != nil {
+			c.onFailed(m, errors.Join(errs...))
+		}
+	} else if c.onSuccess != nil {
+		c.onSuccess(m)
+	}
+}
@@ -0,0 +1,196 @@
+package qafoia
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMultiDriver_NoShards(t *testing.T) {
+	_, err := NewMultiDriver(1)
+	assert.ErrorIs(t, err, ErrNoShards)
+}
+
+func TestMultiDriver_GetExecutedMigrations(t *testing.T) {
+	ctx := context.TODO()
+	first, second := new(mockDriver), new(mockDriver)
+	first.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{{Name: "001"}, {Name: "002"}}, nil)
+	second.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{{Name: "001"}}, nil)
+
+	d, err := NewMultiDriver(1, Shard{Name: "eu", Driver: first}, Shard{Name: "us", Driver: second})
+	assert.NoError(t, err)
+
+	executed, err := d.GetExecutedMigrations(ctx, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []ExecutedMigration{{Name: "001"}}, executed)
+}
+
+func TestQafoia_ListSharded(t *testing.T) {
+	ctx := context.TODO()
+	eu, us, asia := new(mockDriver), new(mockDriver), new(mockDriver)
+	for _, shard := range []*mockDriver{eu, us, asia} {
+		shard.On("CreateMigrationsTable", ctx).Return(nil)
+	}
+	eu.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{{Name: "001"}, {Name: "002"}}, nil)
+	us.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{{Name: "001"}, {Name: "002", InProgress: true}}, nil)
+	asia.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{{Name: "001"}, {Name: "002"}}, nil)
+
+	d, err := NewMultiDriver(1, Shard{Name: "eu", Driver: eu}, Shard{Name: "us", Driver: us}, Shard{Name: "asia", Driver: asia})
+	assert.NoError(t, err)
+
+	q := &Qafoia{driver: d, migrations: map[string]Migration{
+		"001": dummyMigration{name: "001"},
+		"002": dummyMigration{name: "002"},
+		"003": dummyMigration{name: "003"},
+	}}
+
+	list, err := q.ListSharded(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"eu", "us", "asia"}, list.Shards)
+	assert.Equal(t, []ShardedMigration{
+		{Name: "001", Applied: []bool{true, true, true}},
+		{Name: "002", Applied: []bool{true, false, true}},
+		{Name: "003", Applied: []bool{false, false, false}},
+	}, list.Migrations)
+	assert.Equal(t, []string{"us"}, list.OutOfSync())
+
+	var buf bytes.Buffer
+	list.Fprint(&buf)
+	assert.Contains(t, buf.String(), "| 002       | applied | pending ! | applied |")
+	assert.Contains(t, buf.String(), "Shards out of sync with the majority: us")
+
+	q.driver = new(mockDriver)
+	_, err = q.ListSharded(ctx)
+	assert.ErrorIs(t, err, ErrNotSharded)
+}
+
+func TestMultiDriver_ApplyMigrations(t *testing.T) {
+	ctx := context.TODO()
+	m1, m2 := dummyMigration{name: "001"}, dummyMigration{name: "002"}
+
+	eu, us, asia := new(mockDriver), new(mockDriver), new(mockDriver)
+	eu.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{{Name: "001"}}, nil)
+	eu.On("ApplyMigrations", ctx, []Migration{m2}).Return(nil)
+	us.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+	us.On("ApplyMigrations", ctx, []Migration{m1, m2}).Return(errors.New("syntax error"))
+	asia.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{{Name: "001"}, {Name: "002"}}, nil)
+
+	d, err := NewMultiDriver(2,
+		Shard{Name: "eu", Driver: eu},
+		Shard{Name: "us", Driver: us},
+		Shard{Name: "asia", Driver: asia},
+	)
+	assert.NoError(t, err)
+
+	err = d.ApplyMigrations(ctx, []Migration{m1, m2}, nil, nil, nil)
+
+	var shardErr *ShardError
+	assert.ErrorAs(t, err, &shardErr)
+	assert.Equal(t, "us", shardErr.Shard)
+	assert.ErrorContains(t, err, "shard us: syntax error")
+	assert.NotContains(t, err.Error(), "shard eu")
+	eu.AssertExpectations(t)
+	us.AssertExpectations(t)
+	asia.AssertNotCalled(t, "ApplyMigrations", ctx, []Migration{m1, m2})
+}
+
+// reportingDriver is a mockDriver whose ApplyMigrations reports every migration to the
+// callbacks, failing the ones listed in fail.
+type reportingDriver struct {
+	*mockDriver
+	fail map[string]error
+}
+
+func (d reportingDriver) ApplyMigrations(ctx context.Context, migrations []Migration, onRunning, onSuccess func(*Migration), onFailed func(*Migration, error)) error {
+	for _, m := range migrations {
+		onRunning(&m)
+		if err := d.fail[m.Name()]; err != nil {
+			onFailed(&m, err)
+			return err
+		}
+		onSuccess(&m)
+	}
+	return nil
+}
+
+func TestQafoia_Migrate_ShardsWithProgressBar(t *testing.T) {
+	ctx := context.TODO()
+	m1, m2 := dummyMigration{name: "001"}, dummyMigration{name: "002"}
+
+	eu := reportingDriver{mockDriver: new(mockDriver)}
+	us := reportingDriver{mockDriver: new(mockDriver), fail: map[string]error{}}
+	for _, shard := range []reportingDriver{eu, us} {
+		shard.On("CreateMigrationsTable", ctx).Return(nil)
+		shard.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+	}
+
+	d, err := NewMultiDriver(2, Shard{Name: "eu", Driver: eu}, Shard{Name: "us", Driver: us})
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	q := &Qafoia{driver: d, progressOut: &out, migrations: map[string]Migration{"001": m1, "002": m2}}
+
+	summary, err := q.migrate(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, summary.Applied)
+	assert.Contains(t, out.String(), "2/2 migrations")
+	assert.NotContains(t, out.String(), "3/2 migrations")
+
+	us.fail["001"] = errors.New("syntax error")
+	q.migrations = map[string]Migration{"001": m1}
+	summary, err = q.migrate(ctx)
+	assert.ErrorContains(t, err, "shard us: syntax error")
+	assert.Equal(t, 0, summary.Applied)
+	assert.Equal(t, 1, summary.Failed)
+}
+
+func TestMultiDriver_UnapplyMigrations(t *testing.T) {
+	ctx := context.TODO()
+	m1 := dummyMigration{name: "001"}
+
+	eu, us := new(mockDriver), new(mockDriver)
+	eu.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{{Name: "001"}}, nil)
+	eu.On("UnapplyMigrations", ctx, []Migration{m1}).Return(nil)
+	us.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+
+	d, err := NewMultiDriver(1, Shard{Name: "eu", Driver: eu}, Shard{Name: "us", Driver: us})
+	assert.NoError(t, err)
+
+	err = d.UnapplyMigrations(ctx, []Migration{m1}, nil, nil, nil)
+	assert.NoError(t, err)
+	eu.AssertExpectations(t)
+	us.AssertNotCalled(t, "UnapplyMigrations", ctx, []Migration{m1})
+}
+
+func TestMultiDriver_CleanDatabase(t *testing.T) {
+	ctx := context.TODO()
+	eu, us := new(mockDriver), new(mockDriver)
+	eu.On("CleanDatabase", ctx).Return([]string{"users", "orders"}, nil)
+	us.On("CleanDatabase", ctx).Return([]string{"users"}, nil)
+
+	d, err := NewMultiDriver(2, Shard{Name: "eu", Driver: eu}, Shard{Name: "us", Driver: us})
+	assert.NoError(t, err)
+
+	dropped, err := d.CleanDatabase(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"eu/users", "eu/orders", "us/users"}, dropped)
+}
+
+func TestMultiDriver_Capabilities(t *testing.T) {
+	d, err := NewMultiDriver(1,
+		Shard{Name: "eu", Driver: &PostgresDriver{}},
+		Shard{Name: "us", Driver: &PostgresDriver{}},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, DriverCapabilities{TransactionalDDL: true, AdvisoryLocks: true, Copy: true, SQLValidation: true}, d.Capabilities())
+
+	d, err = NewMultiDriver(1,
+		Shard{Name: "eu", Driver: &PostgresDriver{}},
+		Shard{Name: "us", Driver: &MySqlDriver{}},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, DriverCapabilities{AdvisoryLocks: true, SQLValidation: true}, d.Capabilities())
+}
@@ -2,21 +2,55 @@ package qafoia
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"slices"
 	"strings"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql" // Import MySQL driver for database/sql
+	"github.com/go-sql-driver/mysql"
 )
 
 // MySqlDriver implements the Driver interface for MySQL.
 type MySqlDriver struct {
 	db                 *sql.DB
+	replica            *sql.DB
 	migrationTableName string
+	namespace          string
+	twoPhaseRecording  bool
+	delay              time.Duration
+	storeDownSQL       bool
+	recordDurations    bool
+	cleanPrefix        string
+	gtidSafe           bool
+	clock              Clock
+	recordMigration    RecordMigrationFunc
+	removeMigration    RemoveMigrationFunc
+	sqlTransform       SQLTransformFunc
 }
 
+var (
+	_ Driver              = (*MySqlDriver)(nil)
+	_ DriverConfigurer    = (*MySqlDriver)(nil)
+	_ ScriptExecutor      = (*MySqlDriver)(nil)
+	_ HistoryRecorder     = (*MySqlDriver)(nil)
+	_ HistoryRenamer      = (*MySqlDriver)(nil)
+	_ HistoryReader       = (*MySqlDriver)(nil)
+	_ VersionReader       = (*MySqlDriver)(nil)
+	_ ReplicaReader       = (*MySqlDriver)(nil)
+	_ MigrationLocker     = (*MySqlDriver)(nil)
+	_ SchemaFingerprinter = (*MySqlDriver)(nil)
+	_ SQLValidator        = (*MySqlDriver)(nil)
+	_ DriverCloner        = (*MySqlDriver)(nil)
+)
+
 // NewMySqlDriver initializes a new MySqlDriver with the given DB config.
+// Options such as WaitForDB can be passed to customize how the connection is established.
 func NewMySqlDriver(
 	host string,
 	port string,
@@ -24,7 +58,10 @@ func NewMySqlDriver(
 	password string,
 	database string,
 	charset string,
+	opts ...DriverOption,
 ) (*MySqlDriver, error) {
+	options := newDriverOptions(opts)
+
 	if charset == "" {
 		charset = "utf8mb4"
 	}
@@ -35,32 +72,170 @@ func NewMySqlDriver(
 		user, password, host, port, database, charset,
 	)
 
+	return openMySqlDriver(dsn, options)
+}
+
+// newMySqlDriverFromDSN is the DriverFactory of the "mysql" driver kind. The DSN uses the
+// go-sql-driver/mysql format; parseTime is always enabled since the driver relies on it.
+func newMySqlDriverFromDSN(dsn string) (Driver, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ParseTime = true
+
+	d, err := openMySqlDriver(cfg.FormatDSN(), driverOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// openMySqlDriver connects to the database at dsn and returns a driver using it.
+func openMySqlDriver(dsn string, options driverOptions) (*MySqlDriver, error) {
+	if options.createDB {
+		if err := ensureMySqlDatabase(dsn, options); err != nil {
+			return nil, err
+		}
+	}
+
 	// Open a new DB connection
-	db, err := sql.Open("mysql", dsn)
+	db, err := openDatabase("mysql", dsn, options)
 	if err != nil {
 		return nil, err
 	}
 
 	// Test the DB connection
-	if err := db.Ping(); err != nil {
+	if err := pingDatabase(db, options.waitForDB); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	replicaDSN := options.replicaDSN
+	if replicaDSN != "" {
+		cfg, err := mysql.ParseDSN(replicaDSN)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		cfg.ParseTime = true
+		replicaDSN = cfg.FormatDSN()
+	}
+
+	replica, err := openReplica("mysql", replicaDSN, options)
+	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	// Return the driver with a default table name
 	return &MySqlDriver{
 		db:                 db,
+		replica:            replica,
 		migrationTableName: "migrations",
+		gtidSafe:           options.gtidSafe || enforcesGTIDConsistency(db),
 	}, nil
 }
 
-// Close closes the database connection.
+// enforcesGTIDConsistency reports whether the server rejects statements that are unsafe for
+// GTID replication. Servers without the variable do not support GTIDs and do not enforce it.
+func enforcesGTIDConsistency(db *sql.DB) bool {
+	var enforced string
+	if err := db.QueryRow("SELECT @@GLOBAL.enforce_gtid_consistency").Scan(&enforced); err != nil {
+		return false
+	}
+	return enforced == "ON" || enforced == "1"
+}
+
+// ensureMySqlDatabase creates the database named in dsn if it does not exist, connecting to
+// the server without selecting a database.
+func ensureMySqlDatabase(dsn string, options driverOptions) error {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return err
+	}
+	name := cfg.DBName
+	if name == "" {
+		return nil
+	}
+	cfg.DBName = ""
+
+	return ensureDatabase("mysql", cfg.FormatDSN(), options, name,
+		"SELECT 1 FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?",
+		"CREATE DATABASE "+quoteMySqlIdentifier(name),
+	)
+}
+
+// DB returns the database handle used by the driver, for running custom queries on the
+// same connection pool. The caller must not close it.
+func (m *MySqlDriver) DB() *sql.DB {
+	return m.db
+}
+
+// Capabilities reports the features of MySQL the driver supports. DDL statements commit
+// implicitly in MySQL, so they cannot be grouped in a transaction. GTIDConsistency is
+// reported when the driver runs in GTID-safe mode.
+func (m *MySqlDriver) Capabilities() DriverCapabilities {
+	return DriverCapabilities{AdvisoryLocks: true, CrossDatabase: true, SQLValidation: true, GTIDConsistency: m.gtidSafe}
+}
+
+// AcquireLock takes the migration lock with GET_LOCK on a dedicated connection, which holds
+// it until released. GET_LOCK waits for whole seconds, so the timeout is rounded up.
+func (m *MySqlDriver) AcquireLock(ctx context.Context, timeout time.Duration) (func() error, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var database sql.NullString
+	if err := conn.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&database); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	name := mysqlLockName(database.String, m.migrationTableName, m.namespace)
+	seconds := int64((timeout + time.Second - 1) / time.Second)
+
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, seconds).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if acquired.Int64 != 1 {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %s", ErrMigrationLocked, migrationLockName(m.migrationTableName, m.namespace))
+	}
+
+	return func() error {
+		defer conn.Close()
+		_, err := conn.ExecContext(context.Background(), "DO RELEASE_LOCK(?)", name)
+		return err
+	}, nil
+}
+
+// mysqlLockName returns the GET_LOCK name guarding the migration table of database. GET_LOCK
+// names are server-wide and limited to 64 characters, so the database is part of the name and
+// the whole name is hashed to a fixed length.
+func mysqlLockName(database string, tableName string, namespace string) string {
+	sum := sha256.Sum256([]byte(database + "\x00" + migrationLockName(tableName, namespace)))
+	return "qafoia:" + hex.EncodeToString(sum[:20])
+}
+
+// Close closes the database connection, and the read replica connection if any. Both are
+// closed even if one fails, and the errors are returned joined.
 func (m *MySqlDriver) Close() error {
+	var errs []error
+	if m.replica != nil {
+		if err := m.replica.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close read replica: %w", err))
+		}
+	}
 	if m.db != nil {
 		if err := m.db.Close(); err != nil {
-			return err
+			errs = append(errs, err)
 		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 // SetMigrationTableName sets the name of the migration tracking table.
@@ -71,12 +246,83 @@ func (m *MySqlDriver) SetMigrationTableName(name string) {
 	m.migrationTableName = name
 }
 
+// Clone returns a copy of the driver that shares its database connection.
+func (m *MySqlDriver) Clone() Driver {
+	c := *m
+	return &c
+}
+
+// records returns the WHERE clauses restricting statements to the namespace of the driver.
+func (m *MySqlDriver) records() migrationRecords {
+	return migrationRecords{namespace: m.namespace, placeholder: func(int) string { return "?" }}
+}
+
+// SetNamespace sets the namespace that migration records are tracked under, allowing several
+// logical databases to share one migration table. The empty namespace is the default one.
+func (m *MySqlDriver) SetNamespace(namespace string) {
+	m.namespace = namespace
+}
+
+// SetTwoPhaseRecording enables recording each migration with a null executed_at before it runs
+// and setting executed_at once it succeeds.
+func (m *MySqlDriver) SetTwoPhaseRecording(enabled bool) {
+	m.twoPhaseRecording = enabled
+}
+
+// SetDelayBetweenMigrations sets how long ApplyMigrations waits between migrations, giving
+// replicas time to catch up. Zero disables the delay.
+func (m *MySqlDriver) SetDelayBetweenMigrations(delay time.Duration) {
+	m.delay = delay
+}
+
+// SetStoreDownSQL enables saving the down script of each applied migration in the
+// down_sql column of the migration table.
+func (m *MySqlDriver) SetStoreDownSQL(enabled bool) {
+	m.storeDownSQL = enabled
+}
+
+// SetRecordDurations enables saving how long each migration took to apply in the
+// duration_ms column of the migration table.
+func (m *MySqlDriver) SetRecordDurations(enabled bool) {
+	m.recordDurations = enabled
+}
+
+// SetClock sets the clock used for the recorded execution time of migrations.
+func (m *MySqlDriver) SetClock(clock Clock) {
+	m.clock = clock
+}
+
+// SetRecordMigration sets a function called instead of the default insert into the migration table.
+func (m *MySqlDriver) SetRecordMigration(record RecordMigrationFunc) {
+	m.recordMigration = record
+}
+
+// SetRemoveMigration sets a function called instead of the default delete from the migration table.
+func (m *MySqlDriver) SetRemoveMigration(remove RemoveMigrationFunc) {
+	m.removeMigration = remove
+}
+
+// SetSQLTransform sets the function used to rewrite migration scripts before execution.
+func (m *MySqlDriver) SetSQLTransform(transform SQLTransformFunc) {
+	m.sqlTransform = transform
+}
+
+// SetCleanPrefix restricts CleanDatabase to the tables whose names start with prefix.
+func (m *MySqlDriver) SetCleanPrefix(prefix string) {
+	m.cleanPrefix = prefix
+}
+
 // CreateMigrationsTable creates the migration table if it doesn't exist.
 func (m *MySqlDriver) CreateMigrationsTable(ctx context.Context) error {
 	query := fmt.Sprintf(`
 		CREATE TABLE IF NOT EXISTS %s (
-			name VARCHAR(255) PRIMARY KEY NOT NULL,
-			executed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			namespace VARCHAR(255) NOT NULL DEFAULT '',
+			name VARCHAR(255) NOT NULL,
+			executed_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+			down_sql TEXT NULL,
+			duration_ms BIGINT NULL,
+			version BIGINT NOT NULL AUTO_INCREMENT UNIQUE,
+			PRIMARY KEY (namespace, name)
 		)
 	`, m.migrationTableName)
 	_, err := m.db.ExecContext(ctx, query)
@@ -85,80 +331,262 @@ func (m *MySqlDriver) CreateMigrationsTable(ctx context.Context) error {
 
 // GetExecutedMigrations returns a list of previously executed migrations, optionally in reverse order.
 func (m *MySqlDriver) GetExecutedMigrations(ctx context.Context, reverse bool) ([]ExecutedMigration, error) {
+	return m.queryExecutedMigrations(ctx, m.db, reverse)
+}
+
+// GetExecutedMigrationsFromReplica returns the executed migrations in ascending order, read
+// from the read replica if one is configured.
+func (m *MySqlDriver) GetExecutedMigrationsFromReplica(ctx context.Context) ([]ExecutedMigration, error) {
+	if m.replica == nil {
+		return m.GetExecutedMigrations(ctx, false)
+	}
+	return m.queryExecutedMigrations(ctx, m.replica, false)
+}
+
+// queryExecutedMigrations reads the executed migrations from db.
+func (m *MySqlDriver) queryExecutedMigrations(ctx context.Context, db *sql.DB, reverse bool) ([]ExecutedMigration, error) {
 	order := "ASC"
 	if reverse {
 		order = "DESC"
 	}
 
-	query := fmt.Sprintf(`SELECT name, executed_at FROM %s ORDER BY name %s`, m.migrationTableName, order)
-	rows, err := m.db.QueryContext(ctx, query)
+	where, args := m.records().inNamespace(1)
+
+	columns := "name, executed_at"
+	if m.recordDurations {
+		columns += ", duration_ms"
+	}
+	query := fmt.Sprintf(`SELECT %s FROM %s %s ORDER BY name %s`, columns, m.migrationTableName, where, order)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, m.checkMigrationTable(ctx, db, err)
 	}
 	defer rows.Close()
 
 	var migrations []ExecutedMigration
 	for rows.Next() {
 		var name string
-		var executedAt time.Time
-		if err := rows.Scan(&name, &executedAt); err != nil {
-			return nil, err
+		var executedAt sql.NullTime
+		var durationMs sql.NullInt64
+		dest := []any{&name, &executedAt}
+		if m.recordDurations {
+			dest = append(dest, &durationMs)
 		}
-		migrations = append(migrations, ExecutedMigration{Name: name, ExecutedAt: executedAt})
+		if err := rows.Scan(dest...); err != nil {
+			return nil, m.checkMigrationTable(ctx, db, err)
+		}
+		migrations = append(migrations, ExecutedMigration{
+			Name:       name,
+			ExecutedAt: executedAt.Time,
+			InProgress: !executedAt.Valid,
+			Duration:   time.Duration(durationMs.Int64) * time.Millisecond,
+		})
 	}
 
 	return migrations, rows.Err()
 }
 
+// checkMigrationTable replaces err, a failure to read the migration table, with a descriptive
+// ErrInvalidMigrationTable if the table lacks columns the driver reads.
+func (m *MySqlDriver) checkMigrationTable(ctx context.Context, db *sql.DB, err error) error {
+	required := []string{"namespace", "name", "executed_at"}
+	if m.recordDurations {
+		required = append(required, "duration_ms")
+	}
+	return checkMigrationTableColumns(ctx, db,
+		"SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?",
+		m.migrationTableName, required, err,
+	)
+}
+
+// ReadHistory returns the executed migrations with every column of the migration table.
+func (m *MySqlDriver) ReadHistory(ctx context.Context) (MigrationHistory, error) {
+	where, args := m.records().inNamespace(1)
+
+	query := fmt.Sprintf(`SELECT * FROM %s %s ORDER BY name ASC`, m.migrationTableName, where)
+	rows, err := m.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanMigrationHistory(rows)
+}
+
+// ReadVersions returns the version numbers recorded for the executed migrations, keyed by
+// migration name.
+func (m *MySqlDriver) ReadVersions(ctx context.Context) (map[string]int, error) {
+	where, args := m.records().inNamespace(1)
+
+	query := fmt.Sprintf(`SELECT name, version FROM %s %s`, m.migrationTableName, where)
+	rows, err := m.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanMigrationVersions(rows)
+}
+
+// ExecuteSQL runs an arbitrary SQL script without recording it in the migration table.
+func (m *MySqlDriver) ExecuteSQL(ctx context.Context, sql string) error {
+	if sql == "" {
+		return nil
+	}
+	_, err := m.db.ExecContext(ctx, sql)
+	return err
+}
+
 // CleanDatabase drops all tables from the current database.
-func (m *MySqlDriver) CleanDatabase(ctx context.Context) error {
+// Foreign key checks are disabled on a dedicated connection and always re-enabled
+// before that connection is returned to the pool. In GTID-safe mode the foreign keys of the
+// tables are dropped first instead. The names of the dropped tables are returned.
+func (m *MySqlDriver) CleanDatabase(ctx context.Context) (dropped []string, err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	if m.gtidSafe {
+		return m.cleanTables(ctx, conn, true)
+	}
+
 	// Disable FK checks temporarily
-	_, err := m.db.ExecContext(ctx, `SET FOREIGN_KEY_CHECKS = 0;`)
+	_, err = conn.ExecContext(ctx, `SET FOREIGN_KEY_CHECKS = 0;`)
 	if err != nil {
-		return fmt.Errorf("failed to disable FK checks: %w", err)
+		return nil, fmt.Errorf("failed to disable FK checks: %w", err)
 	}
 
+	// Re-enable FK checks in every code path. If that fails, the connection is
+	// discarded so the altered session is never reused.
+	defer func() {
+		_, enableErr := conn.ExecContext(context.WithoutCancel(ctx), `SET FOREIGN_KEY_CHECKS = 1;`)
+		if enableErr == nil {
+			return
+		}
+		_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		if err == nil {
+			err = fmt.Errorf("failed to re-enable FK checks: %w", enableErr)
+		}
+	}()
+
+	return m.cleanTables(ctx, conn, false)
+}
+
+// cleanTables drops the tables selected for cleaning on conn, first dropping their foreign
+// keys if dropForeignKeys is set, and returns their names.
+func (m *MySqlDriver) cleanTables(ctx context.Context, conn *sql.Conn, dropForeignKeys bool) ([]string, error) {
 	// Get all user-defined table names
-	rows, err := m.db.QueryContext(ctx, `
+	rows, err := conn.QueryContext(ctx, `
 		SELECT table_name 
 		FROM information_schema.tables 
 		WHERE table_schema = DATABASE();
 	`)
 	if err != nil {
-		return fmt.Errorf("failed to query tables: %w", err)
+		return nil, fmt.Errorf("failed to query tables: %w", err)
 	}
 	defer rows.Close()
 
-	var tableNames []string
+	var tables []string
 	for rows.Next() {
 		var table string
 		if err := rows.Scan(&table); err != nil {
-			return fmt.Errorf("failed to scan table name: %w", err)
+			return nil, fmt.Errorf("failed to scan table name: %w", err)
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read table names: %w", err)
+	}
+
+	tables, clearRecords := selectCleanTables(tables, m.cleanPrefix, m.migrationTableName)
+	if clearRecords {
+		where, args := m.records().inNamespace(1)
+		query := fmt.Sprintf("DELETE FROM %s %s", m.migrationTableName, where)
+		if _, err := conn.ExecContext(ctx, query, args...); err != nil {
+			return nil, fmt.Errorf("failed to delete migration records: %w", err)
 		}
+	}
+
+	tableNames := make([]string, 0, len(tables))
+	for _, table := range tables {
 		tableNames = append(tableNames, fmt.Sprintf("`%s`", table))
 	}
 
 	// No tables to drop
 	if len(tableNames) == 0 {
-		return nil
+		return nil, nil
+	}
+
+	if dropForeignKeys {
+		if err := dropMySqlForeignKeys(ctx, conn, tables); err != nil {
+			return nil, err
+		}
 	}
 
 	// Drop all tables in one statement
 	dropSQL := fmt.Sprintf("DROP TABLE %s;", strings.Join(tableNames, ", "))
-	_, err = m.db.ExecContext(ctx, dropSQL)
-	if err != nil {
-		return fmt.Errorf("failed to drop tables: %w", err)
+	if _, err := conn.ExecContext(ctx, dropSQL); err != nil {
+		return nil, fmt.Errorf("failed to drop tables: %w", err)
 	}
 
-	// Re-enable FK checks
-	_, err = m.db.ExecContext(ctx, `SET FOREIGN_KEY_CHECKS = 1;`)
+	return tables, nil
+}
+
+// dropMySqlForeignKeys drops the foreign keys declared by the given tables, so they can be
+// dropped in any order without disabling foreign key checks.
+func dropMySqlForeignKeys(ctx context.Context, conn *sql.Conn, tables []string) error {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT TABLE_NAME, CONSTRAINT_NAME
+		FROM information_schema.REFERENTIAL_CONSTRAINTS
+		WHERE CONSTRAINT_SCHEMA = DATABASE()
+		ORDER BY TABLE_NAME, CONSTRAINT_NAME;
+	`)
 	if err != nil {
-		return fmt.Errorf("failed to re-enable FK checks: %w", err)
+		return fmt.Errorf("failed to query foreign keys: %w", err)
+	}
+	defer rows.Close()
+
+	var statements []string
+	for rows.Next() {
+		var table, constraint string
+		if err := rows.Scan(&table, &constraint); err != nil {
+			return fmt.Errorf("failed to scan foreign key: %w", err)
+		}
+		if slices.Contains(tables, table) {
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s;",
+				quoteMySqlIdentifier(table), quoteMySqlIdentifier(constraint)))
+		}
 	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read foreign keys: %w", err)
+	}
+	rows.Close()
 
+	for _, statement := range statements {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to drop foreign key: %w", err)
+		}
+	}
 	return nil
 }
 
+// SchemaFingerprint hashes the columns and indexes of the database the driver is connected to.
+func (m *MySqlDriver) SchemaFingerprint(ctx context.Context) (string, error) {
+	return fingerprintSchema(ctx, m.db, m.migrationTableName, `
+		SELECT TABLE_NAME, COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, COLUMN_DEFAULT, EXTRA
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE()
+		ORDER BY TABLE_NAME, ORDINAL_POSITION;
+	`, `
+		SELECT TABLE_NAME, INDEX_NAME, NON_UNIQUE, SEQ_IN_INDEX, COLUMN_NAME
+		FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE()
+		ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX;
+	`)
+}
+
 // ApplyMigrations applies a batch of "up" migrations with optional callbacks.
 func (m *MySqlDriver) ApplyMigrations(
 	ctx context.Context,
@@ -170,12 +598,33 @@ func (m *MySqlDriver) ApplyMigrations(
 	for i := range migrations {
 		mig := migrations[i]
 
+		if i > 0 {
+			if err := sleepContext(ctx, m.delay); err != nil {
+				return err
+			}
+		}
+
 		if onRunning != nil {
 			onRunning(&mig)
 		}
 
-		// Execute the migration SQL
-		if err := m.executeMigrationSQL(ctx, mig.UpScript()); err != nil {
+		if m.recordsInTwoPhases() {
+			if err := m.startExecutedMigration(ctx, m.db, mig.Name()); err != nil {
+				if onFailed != nil {
+					onFailed(&mig, err)
+				}
+				return fmt.Errorf("failed to record start of migration %s: %w", mig.Name(), err)
+			}
+		}
+
+		// Run the migration SQL or Go code
+		started := time.Now()
+		if err := m.onMigrationDatabase(ctx, mig, func(exec SQLExecutor) error {
+			return m.runUp(ctx, exec, mig)
+		}); err != nil {
+			if m.recordsInTwoPhases() {
+				_ = m.removeExecutedMigration(context.WithoutCancel(ctx), m.db, mig.Name())
+			}
 			if onFailed != nil {
 				onFailed(&mig, err)
 			}
@@ -183,13 +632,27 @@ func (m *MySqlDriver) ApplyMigrations(
 		}
 
 		// Record the migration
-		if err := m.insertExecutedMigration(ctx, mig.Name(), time.Now()); err != nil {
+		if err := m.completeExecutedMigration(ctx, m.db, mig.Name(), clockNow(m.clock)); err != nil {
 			if onFailed != nil {
 				onFailed(&mig, err)
 			}
 			return fmt.Errorf("failed to record migration %s: %w", mig.Name(), err)
 		}
 
+		if err := m.storeDownScript(ctx, m.db, mig); err != nil {
+			if onFailed != nil {
+				onFailed(&mig, err)
+			}
+			return fmt.Errorf("failed to store down script of migration %s: %w", mig.Name(), err)
+		}
+
+		if err := m.storeDuration(ctx, m.db, mig.Name(), time.Since(started)); err != nil {
+			if onFailed != nil {
+				onFailed(&mig, err)
+			}
+			return fmt.Errorf("failed to store duration of migration %s: %w", mig.Name(), err)
+		}
+
 		if onSuccess != nil {
 			onSuccess(&mig)
 		}
@@ -212,8 +675,10 @@ func (m *MySqlDriver) UnapplyMigrations(
 			onRunning(&mig)
 		}
 
-		// Execute the down migration SQL
-		if err := m.executeMigrationSQL(ctx, mig.DownScript()); err != nil {
+		// Run the down migration SQL or Go code
+		if err := m.onMigrationDatabase(ctx, mig, func(exec SQLExecutor) error {
+			return m.runDown(ctx, exec, mig)
+		}); err != nil {
 			if onFailed != nil {
 				onFailed(&mig, err)
 			}
@@ -221,7 +686,7 @@ func (m *MySqlDriver) UnapplyMigrations(
 		}
 
 		// Remove migration record from tracking table
-		if err := m.removeExecutedMigration(ctx, mig.Name()); err != nil {
+		if err := m.removeExecutedMigration(ctx, m.db, mig.Name()); err != nil {
 			if onFailed != nil {
 				onFailed(&mig, err)
 			}
@@ -235,25 +700,294 @@ func (m *MySqlDriver) UnapplyMigrations(
 	return nil
 }
 
-// executeMigrationSQL runs a raw SQL migration script.
-func (m *MySqlDriver) executeMigrationSQL(ctx context.Context, sql string) error {
+// onMigrationDatabase calls fn with a connection switched to the database declared by the
+// migration through DatabaseMigration, restoring the previous database afterward, or with the
+// connection pool if it declares none. A connection whose database cannot be restored is
+// discarded instead of being returned to the pool. In GTID-safe mode fn always gets a
+// dedicated connection with autocommit enabled.
+func (m *MySqlDriver) onMigrationDatabase(ctx context.Context, migration Migration, fn func(exec SQLExecutor) error) error {
+	target, ok := migration.(DatabaseMigration)
+	switchDatabase := ok && target.Database() != ""
+	if !switchDatabase && !m.gtidSafe {
+		return fn(m.db)
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.gtidSafe {
+		if _, err := conn.ExecContext(ctx, "SET autocommit = 1"); err != nil {
+			return fmt.Errorf("failed to enable autocommit: %w", err)
+		}
+	}
+	if !switchDatabase {
+		return fn(conn)
+	}
+
+	var previous sql.NullString
+	if err := conn.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&previous); err != nil {
+		return fmt.Errorf("failed to read current database: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, "USE "+quoteMySqlIdentifier(target.Database())); err != nil {
+		return fmt.Errorf("failed to switch to database %s: %w", target.Database(), err)
+	}
+
+	runErr := fn(conn)
+
+	restored := false
+	if previous.Valid {
+		_, err := conn.ExecContext(context.WithoutCancel(ctx), "USE "+quoteMySqlIdentifier(previous.String))
+		restored = err == nil
+	}
+	if !restored {
+		_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+
+	return runErr
+}
+
+// quoteMySqlIdentifier quotes a MySQL identifier with backticks.
+func quoteMySqlIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// runUp applies a migration, calling its Run method if it implements RunnableMigration
+// or executing its up script otherwise. Migrations implementing ConditionalMigration
+// are skipped when ShouldRun returns false.
+func (m *MySqlDriver) runUp(ctx context.Context, exec SQLExecutor, migration Migration) error {
+	ctx, cancel := withMigrationTimeout(ctx, migration)
+	defer cancel()
+	if conditional, ok := migration.(ConditionalMigration); ok {
+		shouldRun, err := conditional.ShouldRun(ctx, m.db)
+		if err != nil {
+			return fmt.Errorf("failed to check whether migration should run: %w", err)
+		}
+		if !shouldRun {
+			return nil
+		}
+	}
+	if runnable, ok := migration.(RunnableMigration); ok {
+		return runnable.Run(ctx, m.db)
+	}
+	if streamed, ok := migration.(StreamedMigration); ok {
+		return m.streamMigrationSQL(ctx, exec, migration.Name(), streamed.UpReader)
+	}
+	var args []any
+	if parameterized, ok := migration.(ParameterizedMigration); ok {
+		args = parameterized.UpArgs()
+	}
+	return m.executeMigrationSQL(ctx, exec, migration.Name(), migration.UpScript(), args...)
+}
+
+// runDown reverts a migration, calling its Rollback method if it implements RunnableMigration
+// or executing its down script otherwise.
+func (m *MySqlDriver) runDown(ctx context.Context, exec SQLExecutor, migration Migration) error {
+	ctx, cancel := withMigrationTimeout(ctx, migration)
+	defer cancel()
+	if runnable, ok := migration.(RunnableMigration); ok {
+		return runnable.Rollback(ctx, m.db)
+	}
+	if streamed, ok := migration.(StreamedMigration); ok {
+		return m.streamMigrationSQL(ctx, exec, migration.Name(), streamed.DownReader)
+	}
+	var args []any
+	if parameterized, ok := migration.(ParameterizedMigration); ok {
+		args = parameterized.DownArgs()
+	}
+	return m.executeMigrationSQL(ctx, exec, migration.Name(), downScript(ctx, migration), args...)
+}
+
+// streamMigrationSQL executes the statements of a StreamedMigration script one at a time.
+func (m *MySqlDriver) streamMigrationSQL(ctx context.Context, exec SQLExecutor, name string, open func() (io.Reader, error)) error {
+	return streamMigrationSQL(open, mysqlDialect, func(statement string) error {
+		return m.executeMigrationSQL(ctx, exec, name, statement)
+	})
+}
+
+// ValidateSQL checks that the script of the named migration parses without running it, by
+// preparing each of its statements on the server. Only syntax errors are reported: statements
+// that cannot be prepared, or that refer to tables an earlier pending migration creates, are
+// accepted.
+func (m *MySqlDriver) ValidateSQL(ctx context.Context, name string, script string) error {
+	if m.sqlTransform != nil {
+		transformed, err := m.sqlTransform(name, script)
+		if err != nil {
+			return fmt.Errorf("failed to transform SQL: %w", err)
+		}
+		script = transformed
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return splitSQLStatements(strings.NewReader(script), mysqlDialect, func(statement string) error {
+		stmt, err := conn.PrepareContext(ctx, statement)
+		if err == nil {
+			return stmt.Close()
+		}
+
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number != mysqlParseError {
+			return nil
+		}
+		return &MigrationSQLError{Migration: name, SQL: statement, Err: err}
+	})
+}
+
+// mysqlParseError is the MySQL error number of a syntax error (ER_PARSE_ERROR).
+const mysqlParseError = 1064
+
+// executeMigrationSQL runs a raw SQL migration script with optional query arguments,
+// applying the SQL transform first if one is set.
+func (m *MySqlDriver) executeMigrationSQL(ctx context.Context, exec SQLExecutor, name string, sql string, args ...any) error {
+	if m.sqlTransform != nil {
+		transformed, err := m.sqlTransform(name, sql)
+		if err != nil {
+			return fmt.Errorf("failed to transform SQL: %w", err)
+		}
+		sql = transformed
+	}
 	if sql == "" {
 		return nil
 	}
-	_, err := m.db.ExecContext(ctx, sql)
+	if _, err := exec.ExecContext(ctx, sql, args...); err != nil {
+		return &MigrationSQLError{Migration: name, SQL: sql, Err: err}
+	}
+	return nil
+}
+
+// RecordExecutedMigration records the migration as executed without running its SQL.
+func (m *MySqlDriver) RecordExecutedMigration(ctx context.Context, name string, executedAt time.Time) error {
+	return m.insertExecutedMigration(ctx, m.db, name, executedAt)
+}
+
+// ForgetExecutedMigration removes the record of the migration without running its SQL.
+func (m *MySqlDriver) ForgetExecutedMigration(ctx context.Context, name string) error {
+	return m.removeExecutedMigration(ctx, m.db, name)
+}
+
+// SetExecutedAt changes the recorded execution time of a migration.
+func (m *MySqlDriver) SetExecutedAt(ctx context.Context, name string, executedAt time.Time) error {
+	return m.updateExecutedAt(ctx, m.db, name, executedAt)
+}
+
+// ReplaceExecutedMigration replaces all records of a migration with a single one in a
+// transaction, so a failure leaves the records as they were.
+func (m *MySqlDriver) ReplaceExecutedMigration(ctx context.Context, name string, executedAt time.Time) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := m.removeExecutedMigration(ctx, tx, name); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := m.insertExecutedMigration(ctx, tx, name, executedAt); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// RenameExecutedMigration changes the name a migration is recorded under, keeping the rest
+// of its record.
+func (m *MySqlDriver) RenameExecutedMigration(ctx context.Context, oldName string, newName string) error {
+	where, args := m.records().named(2, oldName)
+	query := fmt.Sprintf(`UPDATE %s SET name = ? %s`, m.migrationTableName, where)
+	_, err := m.db.ExecContext(ctx, query, append([]any{newName}, args...)...)
+	return err
+}
+
+// insertExecutedMigration logs a migration into the migration tracking table. A migration
+// that is already recorded is left as is, so recording is idempotent when a migration is
+// retried after its DDL succeeded but the process stopped before the insert committed.
+func (m *MySqlDriver) insertExecutedMigration(ctx context.Context, exec SQLExecutor, name string, executedAt time.Time) error {
+	if m.recordMigration != nil {
+		return m.recordMigration(ctx, exec, name, executedAt)
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s (namespace, name, executed_at) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE name = name`, m.migrationTableName)
+	_, err := exec.ExecContext(ctx, query, m.namespace, name, executedAt)
+	return err
+}
+
+// recordsInTwoPhases reports whether migrations are recorded before they run and completed
+// after. Custom record and remove functions disable it, as the start marker is written with
+// the default statements.
+func (m *MySqlDriver) recordsInTwoPhases() bool {
+	return m.twoPhaseRecording && m.recordMigration == nil && m.removeMigration == nil
+}
+
+// startExecutedMigration records a migration with a null executed_at before it runs, leaving
+// a visible marker if the process stops before the migration finishes.
+func (m *MySqlDriver) startExecutedMigration(ctx context.Context, exec SQLExecutor, name string) error {
+	query := fmt.Sprintf(`INSERT INTO %s (namespace, name, executed_at) VALUES (?, ?, NULL)`, m.migrationTableName)
+	_, err := exec.ExecContext(ctx, query, m.namespace, name)
+	return err
+}
+
+// completeExecutedMigration records a migration that ran outside a transaction as executed,
+// setting executed_at on the row written by startExecutedMigration with two-phase recording.
+func (m *MySqlDriver) completeExecutedMigration(ctx context.Context, exec SQLExecutor, name string, executedAt time.Time) error {
+	if !m.recordsInTwoPhases() {
+		return m.insertExecutedMigration(ctx, exec, name, executedAt)
+	}
+	return m.updateExecutedAt(ctx, exec, name, executedAt)
+}
+
+// updateExecutedAt sets executed_at on the record of the migration.
+func (m *MySqlDriver) updateExecutedAt(ctx context.Context, exec SQLExecutor, name string, executedAt time.Time) error {
+	where, args := m.records().named(2, name)
+	query := fmt.Sprintf(`UPDATE %s SET executed_at = ? %s`, m.migrationTableName, where)
+	_, err := exec.ExecContext(ctx, query, append([]any{executedAt}, args...)...)
 	return err
 }
 
-// insertExecutedMigration logs a migration into the migration tracking table.
-func (m *MySqlDriver) insertExecutedMigration(ctx context.Context, name string, executedAt time.Time) error {
-	query := fmt.Sprintf(`INSERT INTO %s (name, executed_at) VALUES (?, ?)`, m.migrationTableName)
-	_, err := m.db.ExecContext(ctx, query, name, executedAt)
+// storeDownScript saves the down script of the migration in the migration table when
+// storing down scripts is enabled. Migrations implementing RunnableMigration have no script
+// to store.
+func (m *MySqlDriver) storeDownScript(ctx context.Context, exec SQLExecutor, migration Migration) error {
+	if !m.storeDownSQL {
+		return nil
+	}
+	if _, ok := migration.(RunnableMigration); ok {
+		return nil
+	}
+
+	where, args := m.records().named(2, migration.Name())
+	query := fmt.Sprintf(`UPDATE %s SET down_sql = ? %s`, m.migrationTableName, where)
+	_, err := exec.ExecContext(ctx, query, append([]any{migration.DownScript()}, args...)...)
+	return err
+}
+
+// storeDuration saves how long the migration took to apply in the migration table when
+// recording durations is enabled.
+func (m *MySqlDriver) storeDuration(ctx context.Context, exec SQLExecutor, name string, duration time.Duration) error {
+	if !m.recordDurations {
+		return nil
+	}
+
+	where, args := m.records().named(2, name)
+	query := fmt.Sprintf(`UPDATE %s SET duration_ms = ? %s`, m.migrationTableName, where)
+	_, err := exec.ExecContext(ctx, query, append([]any{duration.Milliseconds()}, args...)...)
 	return err
 }
 
 // removeExecutedMigration deletes a migration record from the migration table.
-func (m *MySqlDriver) removeExecutedMigration(ctx context.Context, name string) error {
-	query := fmt.Sprintf(`DELETE FROM %s WHERE name = ?`, m.migrationTableName)
-	_, err := m.db.ExecContext(ctx, query, name)
+func (m *MySqlDriver) removeExecutedMigration(ctx context.Context, exec SQLExecutor, name string) error {
+	if m.removeMigration != nil {
+		return m.removeMigration(ctx, exec, name)
+	}
+
+	where, args := m.records().named(1, name)
+	query := fmt.Sprintf(`DELETE FROM %s %s`, m.migrationTableName, where)
+	_, err := exec.ExecContext(ctx, query, args...)
 	return err
 }
@@ -3,10 +3,15 @@ package qafoia
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -36,6 +41,14 @@ func TestNewMySqlDriver(t *testing.T) {
 	assert.NotNil(t, driver)
 }
 
+func TestDBMySqlDriver(t *testing.T) {
+	db, _, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	var provider DBProvider = driver
+	assert.Same(t, db, provider.DB())
+}
+
 func TestCreateMigrationsTableMySqlDriver(t *testing.T) {
 	// Create a mock database connection
 	db, mock, driver := setupMockDBMySql(t)
@@ -81,6 +94,30 @@ func TestGetExecutedMigrations(t *testing.T) {
 	assert.Equal(t, "migration_1", migrations[0].Name)
 }
 
+func TestNamespacedTrackingMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	driver.SetNamespace("tenant_a")
+
+	mock.ExpectQuery(`SELECT name, executed_at FROM migrations WHERE namespace = \? ORDER BY name ASC`).
+		WithArgs("tenant_a").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "executed_at"}).AddRow("migration_1", time.Now()))
+	mock.ExpectExec(`INSERT INTO migrations \(namespace, name, executed_at\)`).
+		WithArgs("tenant_a", "migration_2", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`DELETE FROM migrations WHERE namespace = \? AND name = \?`).
+		WithArgs("tenant_a", "migration_2").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	migrations, err := driver.GetExecutedMigrations(context.Background(), false)
+	assert.NoError(t, err)
+	assert.Len(t, migrations, 1)
+	assert.NoError(t, driver.insertExecutedMigration(context.Background(), db, "migration_2", time.Now()))
+	assert.NoError(t, driver.removeExecutedMigration(context.Background(), db, "migration_2"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestCleanDatabaseMySqlDriver(t *testing.T) {
 	db, mock, driver := setupMockDBMySql(t)
 	defer db.Close()
@@ -105,9 +142,10 @@ func TestCleanDatabaseMySqlDriver(t *testing.T) {
 	mock.ExpectExec(`SET FOREIGN_KEY_CHECKS = 1;`).WillReturnResult(sqlmock.NewResult(0, 0))
 
 	// Act
-	err := driver.CleanDatabase(ctx)
+	dropped, err := driver.CleanDatabase(ctx)
 
 	assert.NoError(t, err)
+	assert.Equal(t, []string{"users", "products"}, dropped)
 
 	// Assert all expectations were met
 	err = mock.ExpectationsWereMet()
@@ -115,6 +153,102 @@ func TestCleanDatabaseMySqlDriver(t *testing.T) {
 	assert.NoError(t, err, "there were unfulfilled expectations")
 }
 
+func TestCleanDatabasePrefixMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+	driver.SetCleanPrefix("myapp_")
+	driver.SetNamespace("myapp")
+
+	mock.ExpectExec(`SET FOREIGN_KEY_CHECKS = 0;`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT table_name FROM information_schema\.tables`).
+		WillReturnRows(sqlmock.NewRows([]string{"table_name"}).
+			AddRow("myapp_users").
+			AddRow("otherapp_users").
+			AddRow("migrations").
+			AddRow("myapp_orders"))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM migrations WHERE namespace = ?")).
+		WithArgs("myapp").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE `myapp_users`, `myapp_orders`;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SET FOREIGN_KEY_CHECKS = 1;`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	dropped, err := driver.CleanDatabase(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"myapp_users", "myapp_orders"}, dropped)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCleanDatabaseNoTablesMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	mock.ExpectExec(`SET FOREIGN_KEY_CHECKS = 0;`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT table_name FROM information_schema\.tables`).
+		WillReturnRows(sqlmock.NewRows([]string{"table_name"}))
+
+	// FK checks must be re-enabled even when there is nothing to drop
+	mock.ExpectExec(`SET FOREIGN_KEY_CHECKS = 1;`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	dropped, err := driver.CleanDatabase(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, dropped)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCleanDatabaseDropErrorMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	mock.ExpectExec(`SET FOREIGN_KEY_CHECKS = 0;`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT table_name FROM information_schema\.tables`).
+		WillReturnRows(sqlmock.NewRows([]string{"table_name"}).AddRow("users"))
+	mock.ExpectExec("DROP TABLE `users`;").WillReturnError(errors.New("drop denied"))
+	mock.ExpectExec(`SET FOREIGN_KEY_CHECKS = 1;`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	dropped, err := driver.CleanDatabase(context.Background())
+	assert.ErrorContains(t, err, "drop denied")
+	assert.Empty(t, dropped)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCleanDatabaseGTIDSafeMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+	driver.gtidSafe = true
+
+	mock.ExpectQuery(`SELECT table_name FROM information_schema\.tables`).
+		WillReturnRows(sqlmock.NewRows([]string{"table_name"}).AddRow("users").AddRow("orders"))
+	mock.ExpectQuery(`SELECT TABLE_NAME, CONSTRAINT_NAME FROM information_schema\.REFERENTIAL_CONSTRAINTS`).
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "CONSTRAINT_NAME"}).
+			AddRow("orders", "fk_orders_user").
+			AddRow("other_app", "fk_other"))
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE `orders` DROP FOREIGN KEY `fk_orders_user`;")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE `users`, `orders`;")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	dropped, err := driver.CleanDatabase(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"users", "orders"}, dropped)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.True(t, driver.Capabilities().GTIDConsistency)
+}
+
+func TestApplyMigrationsGTIDSafeMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+	driver.gtidSafe = true
+
+	migrations := []Migration{&mockMigrationMySqlDriver{name: "001_create_users", up: "CREATE TABLE users (id INT);"}}
+
+	mock.ExpectExec("SET autocommit = 1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE users").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO migrations").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := driver.ApplyMigrations(context.Background(), migrations, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestApplyMigrationsMySqlDriver(t *testing.T) {
 	db, mock, driver := setupMockDBMySql(t)
 	defer db.Close()
@@ -126,11 +260,242 @@ func TestApplyMigrationsMySqlDriver(t *testing.T) {
 	}
 
 	mock.ExpectExec("CREATE TABLE test \\(id INT\\);").WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("migration1", sqlmock.AnyArg()).
+	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("", "migration1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := driver.ApplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// streamedMigrationMySqlDriver is a migration that provides its scripts as readers.
+type streamedMigrationMySqlDriver struct {
+	mockMigrationMySqlDriver
+}
+
+func (m *streamedMigrationMySqlDriver) UpReader() (io.Reader, error) {
+	return io.NopCloser(strings.NewReader("INSERT INTO seeds VALUES (1);\nINSERT INTO seeds VALUES (2);\n" +
+		"CREATE TRIGGER seeds_defaults BEFORE INSERT ON seeds FOR EACH ROW BEGIN SET NEW.a = 1; SET NEW.b = 2; END;\n")), nil
+}
+
+func (m *streamedMigrationMySqlDriver) DownReader() (io.Reader, error) {
+	return nil, errors.New("dump not found")
+}
+
+func TestApplyStreamedMigrationMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	mig := &streamedMigrationMySqlDriver{mockMigrationMySqlDriver{name: "migration1"}}
+
+	mock.ExpectExec(`^INSERT INTO seeds VALUES \(1\)$`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`^INSERT INTO seeds VALUES \(2\)$`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`^CREATE TRIGGER seeds_defaults .* BEGIN SET NEW.a = 1; SET NEW.b = 2; END$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("", "migration1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := driver.ApplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil)
+	assert.NoError(t, err)
+
+	err = driver.UnapplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil)
+	assert.ErrorContains(t, err, "failed to open migration script: dump not found")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyMigrationsDelayCancelledMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	driver.SetDelayBetweenMigrations(time.Hour)
+	first := &mockMigrationMySqlDriver{name: "migration1", up: "CREATE TABLE a (id INT);"}
+	second := &mockMigrationMySqlDriver{name: "migration2", up: "CREATE TABLE b (id INT);"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mock.ExpectExec("CREATE TABLE a").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("", "migration1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := driver.ApplyMigrations(ctx, []Migration{first, second}, nil, func(*Migration) { cancel() }, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyMigrationsRecordDurationsMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	driver.SetRecordDurations(true)
+	mig := &mockMigrationMySqlDriver{name: "migration1", up: "CREATE TABLE test (id INT);"}
+
+	mock.ExpectExec("CREATE TABLE test").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("", "migration1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE migrations SET duration_ms = \? WHERE namespace = \? AND name = \?`).WithArgs(sqlmock.AnyArg(), "", "migration1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := driver.ApplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+type databaseMigrationMySqlDriver struct {
+	mockMigrationMySqlDriver
+	database string
+}
+
+func (m *databaseMigrationMySqlDriver) Database() string { return m.database }
+
+func TestApplyMigrationsOtherDatabaseMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	mig := &databaseMigrationMySqlDriver{
+		mockMigrationMySqlDriver{name: "migration1", up: "CREATE TABLE events (id INT);"},
+		"analytics",
+	}
+
+	mock.ExpectQuery(`SELECT DATABASE\(\)`).WillReturnRows(sqlmock.NewRows([]string{"DATABASE()"}).AddRow("app"))
+	mock.ExpectExec("USE `analytics`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE events").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("USE `app`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("", "migration1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := driver.ApplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnapplyMigrationsStoredDownSQLOtherDatabaseMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	mig := &databaseMigrationMySqlDriver{
+		mockMigrationMySqlDriver{name: "migration1", down: "DROP TABLE events;"},
+		"analytics",
+	}
+	ctx := withStoredDownScripts(context.Background(), map[string]string{"migration1": "DROP TABLE IF EXISTS events;"})
+
+	mock.ExpectQuery(`SELECT DATABASE\(\)`).WillReturnRows(sqlmock.NewRows([]string{"DATABASE()"}).AddRow("app"))
+	mock.ExpectExec("USE `analytics`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DROP TABLE IF EXISTS events").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("USE `app`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM migrations`).WithArgs("", "migration1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := driver.UnapplyMigrations(ctx, []Migration{mig}, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyMigrationsStoreDownSQLMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	driver.SetStoreDownSQL(true)
+	mig := &mockMigrationMySqlDriver{
+		name: "migration1",
+		up:   "CREATE TABLE test (id INT);",
+		down: "DROP TABLE test;",
+	}
+
+	mock.ExpectExec("CREATE TABLE test").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("", "migration1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE migrations SET down_sql = \? WHERE namespace = \? AND name = \?`).WithArgs("DROP TABLE test;", "", "migration1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := driver.ApplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyMigrationsTwoPhaseRecordingMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	driver.SetTwoPhaseRecording(true)
+	mig := &mockMigrationMySqlDriver{
+		name: "migration1",
+		up:   "CREATE TABLE test (id INT);",
+		down: "DROP TABLE test;",
+	}
+
+	mock.ExpectExec(`INSERT INTO migrations \(namespace, name, executed_at\) VALUES \(\?, \?, NULL\)`).WithArgs("", "migration1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("CREATE TABLE test \\(id INT\\);").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE migrations SET executed_at = \? WHERE namespace = \? AND name = \?`).WithArgs(sqlmock.AnyArg(), "", "migration1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := driver.ApplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyAndUnapplyMigrationsCustomRecordingMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	driver.SetTwoPhaseRecording(true)
+	driver.SetRecordMigration(func(ctx context.Context, exec SQLExecutor, name string, executedAt time.Time) error {
+		_, err := exec.ExecContext(ctx, `INSERT INTO migrations (name, executed_at, git_sha) VALUES (?, ?, ?)`, name, executedAt, "abc123")
+		return err
+	})
+	driver.SetRemoveMigration(func(ctx context.Context, exec SQLExecutor, name string) error {
+		_, err := exec.ExecContext(ctx, `UPDATE migrations SET rolled_back = 1 WHERE name = ?`, name)
+		return err
+	})
+	mig := &mockMigrationMySqlDriver{
+		name: "migration1",
+		up:   "CREATE TABLE test (id INT);",
+		down: "DROP TABLE test;",
+	}
+
+	mock.ExpectExec("CREATE TABLE test \\(id INT\\);").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO migrations \(name, executed_at, git_sha\)`).WithArgs("migration1", sqlmock.AnyArg(), "abc123").
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DROP TABLE test;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE migrations SET rolled_back = 1 WHERE name = \?`).WithArgs("migration1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
 
 	err := driver.ApplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil)
 	assert.NoError(t, err)
+	err = driver.UnapplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetExecutedMigrationsInProgressMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"name", "executed_at"}).AddRow("migration_1", nil)
+	mock.ExpectQuery("SELECT name, executed_at FROM migrations").WillReturnRows(rows)
+
+	migrations, err := driver.GetExecutedMigrations(context.Background(), false)
+	assert.NoError(t, err)
+	assert.Len(t, migrations, 1)
+	assert.True(t, migrations[0].InProgress)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReadHistoryMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	executedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"namespace", "name", "executed_at", "applied_by"}).
+		AddRow("", "migration_1", executedAt, []byte("deploy-bot")).
+		AddRow("", "migration_2", nil, nil)
+	mock.ExpectQuery(`SELECT \* FROM migrations WHERE namespace = \? ORDER BY name ASC`).WithArgs("").WillReturnRows(rows)
+
+	history, err := driver.ReadHistory(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, MigrationHistory{
+		{Name: "migration_1", ExecutedAt: executedAt, Metadata: map[string]any{"applied_by": "deploy-bot"}},
+		{Name: "migration_2", InProgress: true, Metadata: map[string]any{"applied_by": nil}},
+	}, history)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -145,7 +510,7 @@ func TestUnapplyMigrationsMySqlDriver(t *testing.T) {
 	}
 
 	mock.ExpectExec(mig.down).WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectExec(`DELETE FROM migrations WHERE name = ?`).WithArgs(mig.name).
+	mock.ExpectExec(`DELETE FROM migrations WHERE namespace = \? AND name = \?`).WithArgs("", mig.name).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	err := driver.UnapplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil)
@@ -153,25 +518,69 @@ func TestUnapplyMigrationsMySqlDriver(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestApplyRunnableMigrationMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	mig := &mockRunnableMigrationMySqlDriver{
+		mockMigrationMySqlDriver: mockMigrationMySqlDriver{
+			name: "migration1",
+			up:   "CREATE TABLE test (id INT);",
+			down: "DROP TABLE test;",
+		},
+	}
+
+	// The up script must not be executed; only the tracking records are written
+	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("", "migration1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`DELETE FROM migrations WHERE namespace = \? AND name = \?`).WithArgs("", "migration1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	assert.NoError(t, driver.ApplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil))
+	assert.NoError(t, driver.UnapplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil))
+	assert.True(t, mig.ran)
+	assert.True(t, mig.rolledBack)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestExecuteMigrationSQLMySqlDriver(t *testing.T) {
 	db, mock, driver := setupMockDBMySql(t)
 	defer db.Close()
 
 	mock.ExpectExec(`SOME SQL STATEMENT`).WillReturnResult(sqlmock.NewResult(0, 0))
 
-	err := driver.executeMigrationSQL(context.Background(), "SOME SQL STATEMENT")
+	err := driver.executeMigrationSQL(context.Background(), db, "migration_name", "SOME SQL STATEMENT")
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestExecuteMigrationSQLErrorIncludesSQLMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	dbErr := errors.New("syntax error")
+	mock.ExpectExec(`CREATE TABEL users`).WillReturnError(dbErr)
+
+	err := driver.executeMigrationSQL(context.Background(), db, "migration_name", "CREATE TABEL users (id INT);")
+
+	var sqlErr *MigrationSQLError
+	assert.ErrorAs(t, err, &sqlErr)
+	assert.Equal(t, "migration_name", sqlErr.Migration)
+	assert.Equal(t, "CREATE TABEL users (id INT);", sqlErr.SQL)
+	assert.ErrorIs(t, err, dbErr)
+	assert.Contains(t, err.Error(), "failing SQL: CREATE TABEL users (id INT);")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestInsertExecutedMigrationMySqlDriver(t *testing.T) {
 	db, mock, driver := setupMockDBMySql(t)
 	defer db.Close()
 
-	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("migration_name", sqlmock.AnyArg()).
+	mock.ExpectExec(`INSERT INTO migrations \(namespace, name, executed_at\) VALUES \(\?, \?, \?\) ON DUPLICATE KEY UPDATE name = name`).
+		WithArgs("", "migration_name", sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err := driver.insertExecutedMigration(context.Background(), "migration_name", time.Now())
+	err := driver.insertExecutedMigration(context.Background(), db, "migration_name", time.Now())
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -180,14 +589,118 @@ func TestRemoveExecutedMigrationMySqlDriver(t *testing.T) {
 	db, mock, driver := setupMockDBMySql(t)
 	defer db.Close()
 
-	mock.ExpectExec(`DELETE FROM migrations WHERE name = ?`).WithArgs("migration_name").
+	mock.ExpectExec(`DELETE FROM migrations WHERE namespace = \? AND name = \?`).WithArgs("", "migration_name").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err := driver.removeExecutedMigration(context.Background(), "migration_name")
+	err := driver.removeExecutedMigration(context.Background(), db, "migration_name")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRenameExecutedMigrationMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	mock.ExpectExec(`UPDATE migrations SET name = \? WHERE namespace = \? AND name = \?`).WithArgs("new_name", "", "old_name").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := driver.RenameExecutedMigration(context.Background(), "old_name", "new_name")
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestSetExecutedAtMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	executedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectExec(`UPDATE migrations SET executed_at = \? WHERE namespace = \? AND name = \?`).WithArgs(executedAt, "", "migration_name").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := driver.SetExecutedAt(context.Background(), "migration_name", executedAt)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReplaceExecutedMigrationMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	executedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM migrations WHERE namespace = \? AND name = \?`).WithArgs("", "migration_name").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO migrations").WithArgs("", "migration_name", executedAt).
+		WillReturnError(errors.New("connection lost"))
+	mock.ExpectRollback()
+
+	err := driver.ReplaceExecutedMigration(context.Background(), "migration_name", executedAt)
+	assert.ErrorContains(t, err, "connection lost")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM migrations WHERE namespace = \? AND name = \?`).WithArgs("", "migration_name").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO migrations").WithArgs("", "migration_name", executedAt).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = driver.ReplaceExecutedMigration(context.Background(), "migration_name", executedAt)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetExecutedMigrationsInvalidTableMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT name, executed_at FROM migrations").
+		WillReturnError(errors.New("Unknown column 'executed_at' in 'field list'"))
+	mock.ExpectQuery(`SELECT COLUMN_NAME FROM information_schema\.COLUMNS`).
+		WithArgs("migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}).AddRow("id").AddRow("name"))
+
+	_, err := driver.GetExecutedMigrations(context.Background(), false)
+	assert.ErrorIs(t, err, ErrInvalidMigrationTable)
+	assert.EqualError(t, err, "migration table has unexpected schema: migrations is missing columns namespace, executed_at; expected columns namespace, name, executed_at")
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// A table with the expected columns keeps the original error
+	mock.ExpectQuery("SELECT name, executed_at FROM migrations").WillReturnError(errors.New("connection reset"))
+	mock.ExpectQuery(`SELECT COLUMN_NAME FROM information_schema\.COLUMNS`).
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}).AddRow("namespace").AddRow("name").AddRow("executed_at"))
+
+	_, err = driver.GetExecutedMigrations(context.Background(), false)
+	assert.EqualError(t, err, "connection reset")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetExecutedMigrationsReadReplicaMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	replica, replicaMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer replica.Close()
+	driver.replica = replica
+
+	executedAt := time.Now()
+	replicaMock.ExpectQuery("SELECT name, executed_at FROM migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "executed_at"}).AddRow("from_replica", executedAt))
+	mock.ExpectQuery("SELECT name, executed_at FROM migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "executed_at"}).AddRow("from_primary", executedAt))
+
+	migrations, err := driver.GetExecutedMigrationsFromReplica(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "from_replica", migrations[0].Name)
+
+	migrations, err = driver.GetExecutedMigrations(context.Background(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, "from_primary", migrations[0].Name)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.NoError(t, replicaMock.ExpectationsWereMet())
+}
+
 // --- Supporting mock types ---
 
 type mockMigrationMySqlDriver struct {
@@ -199,3 +712,94 @@ type mockMigrationMySqlDriver struct {
 func (m *mockMigrationMySqlDriver) Name() string       { return m.name }
 func (m *mockMigrationMySqlDriver) UpScript() string   { return m.up }
 func (m *mockMigrationMySqlDriver) DownScript() string { return m.down }
+
+type mockRunnableMigrationMySqlDriver struct {
+	mockMigrationMySqlDriver
+	ran        bool
+	rolledBack bool
+}
+
+func (m *mockRunnableMigrationMySqlDriver) Run(ctx context.Context, db *sql.DB) error {
+	m.ran = true
+	return nil
+}
+
+func (m *mockRunnableMigrationMySqlDriver) Rollback(ctx context.Context, db *sql.DB) error {
+	m.rolledBack = true
+	return nil
+}
+
+func TestAcquireLockMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	name := mysqlLockName("app", "migrations", "")
+	assert.Len(t, name, 47)
+	assert.NotEqual(t, name, mysqlLockName("other", "migrations", ""))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT DATABASE()")).
+		WillReturnRows(sqlmock.NewRows([]string{"database"}).AddRow("app"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT GET_LOCK(?, ?)")).
+		WithArgs(name, int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta("DO RELEASE_LOCK(?)")).
+		WithArgs(name).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	release, err := driver.AcquireLock(context.Background(), 1500*time.Millisecond)
+	assert.NoError(t, err)
+	assert.NoError(t, release())
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT DATABASE()")).
+		WillReturnRows(sqlmock.NewRows([]string{"database"}).AddRow("app"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT GET_LOCK(?, ?)")).
+		WithArgs(name, int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(0))
+
+	_, err = driver.AcquireLock(context.Background(), time.Second)
+	assert.ErrorIs(t, err, ErrMigrationLocked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestValidateSQLMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	mock.ExpectPrepare("CREATE TABLE roles").WillBeClosed()
+	mock.ExpectPrepare("INSERT INTO roles").WillReturnError(&mysql.MySQLError{Number: 1146, Message: "Table 'qafoia.roles' doesn't exist"})
+
+	err := driver.ValidateSQL(context.Background(), "migration1", "CREATE TABLE roles (id INT);\nINSERT INTO roles VALUES (1);")
+	assert.NoError(t, err)
+
+	mock.ExpectPrepare("CREAT TABLE roles").WillReturnError(&mysql.MySQLError{Number: 1064, Message: "You have an error in your SQL syntax"})
+
+	err = driver.ValidateSQL(context.Background(), "migration1", "CREAT TABLE roles (id INT);")
+	var sqlErr *MigrationSQLError
+	assert.ErrorAs(t, err, &sqlErr)
+	assert.Equal(t, "CREAT TABLE roles (id INT)", sqlErr.SQL)
+
+	trigger := "CREATE TRIGGER roles_defaults BEFORE INSERT ON roles FOR EACH ROW BEGIN SET NEW.a = 1; SET NEW.b = 2; END"
+	mock.ExpectPrepare(regexp.QuoteMeta(trigger)).
+		WillReturnError(&mysql.MySQLError{Number: 1295, Message: "This command is not supported in the prepared statement protocol yet"})
+
+	err = driver.ValidateSQL(context.Background(), "migration1", trigger+";")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReadVersionsMySqlDriver(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+	driver.SetNamespace("billing")
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name, version FROM migrations WHERE namespace = ?")).
+		WithArgs("billing").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "version"}).
+			AddRow("001_create_users", 1).
+			AddRow("002_create_roles", 2))
+
+	versions, err := driver.ReadVersions(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"001_create_users": 1, "002_create_roles": 2}, versions)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -4,22 +4,55 @@ package qafoia
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 // PostgresDriver manages database connections and migration operations for PostgreSQL.
 type PostgresDriver struct {
 	db                 *sql.DB
+	replica            *sql.DB
 	migrationTableName string
+	namespace          string
+	twoPhaseRecording  bool
+	delay              time.Duration
+	storeDownSQL       bool
+	recordDurations    bool
+	cleanPrefix        string
+	clock              Clock
+	recordMigration    RecordMigrationFunc
+	removeMigration    RemoveMigrationFunc
+	sqlTransform       SQLTransformFunc
 }
 
+var (
+	_ Driver                = (*PostgresDriver)(nil)
+	_ DriverConfigurer      = (*PostgresDriver)(nil)
+	_ ScriptExecutor        = (*PostgresDriver)(nil)
+	_ HistoryRecorder       = (*PostgresDriver)(nil)
+	_ HistoryRenamer        = (*PostgresDriver)(nil)
+	_ HistoryReader         = (*PostgresDriver)(nil)
+	_ VersionReader         = (*PostgresDriver)(nil)
+	_ ReplicaReader         = (*PostgresDriver)(nil)
+	_ MigrationLocker       = (*PostgresDriver)(nil)
+	_ MigrationTableCreator = (*PostgresDriver)(nil)
+	_ SchemaSnapshotter     = (*PostgresDriver)(nil)
+	_ SchemaFingerprinter   = (*PostgresDriver)(nil)
+	_ SQLValidator          = (*PostgresDriver)(nil)
+	_ DriverCloner          = (*PostgresDriver)(nil)
+)
+
 // NewPostgresDriver creates and returns a new instance of PostgresDriver.
 // It opens a connection to the given PostgreSQL database using the provided credentials and schema.
+// Options such as WaitForDB can be passed to customize how the connection is established.
 func NewPostgresDriver(
 	host string,
 	port string,
@@ -27,31 +60,166 @@ func NewPostgresDriver(
 	password string,
 	database string,
 	schema string,
+	opts ...DriverOption,
 ) (*PostgresDriver, error) {
+	options := newDriverOptions(opts)
+
 	dsn := "host=%s port=%s user=%s password=%s dbname=%s sslmode=disable search_path=%s"
 	dsn = fmt.Sprintf(dsn, host, port, user, password, database, schema)
 
-	db, err := sql.Open("postgres", dsn)
+	return openPostgresDriver(dsn, options)
+}
+
+// newPostgresDriverFromDSN is the DriverFactory of the "postgres" driver kind. The DSN may
+// be a URL or a lib/pq keyword/value connection string.
+func newPostgresDriverFromDSN(dsn string) (Driver, error) {
+	d, err := openPostgresDriver(dsn, driverOptions{})
 	if err != nil {
 		return nil, err
 	}
+	return d, nil
+}
 
-	if err := db.Ping(); err != nil {
+// openPostgresDriver connects to the database at dsn and returns a driver using it.
+func openPostgresDriver(dsn string, options driverOptions) (*PostgresDriver, error) {
+	if options.createDB {
+		if err := ensurePostgresDatabase(dsn, options); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := openDatabase("postgres", dsn, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pingDatabase(db, options.waitForDB); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	replica, err := openReplica("postgres", options.replicaDSN, options)
+	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return &PostgresDriver{
 		db:                 db,
+		replica:            replica,
 		migrationTableName: "migrations",
 	}, nil
 }
 
-// Close closes the database connection.
+// ensurePostgresDatabase creates the database named in dsn if it does not exist, connecting
+// to the server's default postgres database.
+func ensurePostgresDatabase(dsn string, options driverOptions) error {
+	serverDSN, name, err := postgresServerDSN(dsn)
+	if err != nil || name == "" {
+		return err
+	}
+
+	return ensureDatabase("postgres", serverDSN, options, name,
+		"SELECT 1 FROM pg_database WHERE datname = $1",
+		"CREATE DATABASE "+pq.QuoteIdentifier(name),
+	)
+}
+
+// postgresDBNamePattern matches the dbname setting of a keyword/value connection string.
+var postgresDBNamePattern = regexp.MustCompile(`(?:^|\s)dbname\s*=\s*('(?:[^'\\]|\\.)*'|[^\s']\S*)`)
+
+// postgresServerDSN returns dsn, a URL or keyword/value connection string, rewritten to
+// connect to the postgres database, along with the name of the database it named. The name
+// is empty when the DSN does not set one.
+func postgresServerDSN(dsn string) (string, string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		converted, err := pq.ParseURL(dsn)
+		if err != nil {
+			return "", "", err
+		}
+		dsn = converted
+	}
+
+	match := postgresDBNamePattern.FindStringSubmatchIndex(dsn)
+	if match == nil {
+		return dsn, "", nil
+	}
+
+	name := dsn[match[2]:match[3]]
+	if strings.HasPrefix(name, "'") {
+		name = strings.NewReplacer(`\'`, `'`, `\\`, `\`).Replace(name[1 : len(name)-1])
+	}
+
+	return dsn[:match[2]] + "postgres" + dsn[match[3]:], name, nil
+}
+
+// DB returns the database handle used by the driver, for running custom queries on the
+// same connection pool. The caller must not close it.
+func (p *PostgresDriver) DB() *sql.DB {
+	return p.db
+}
+
+// Capabilities reports the features of PostgreSQL the driver supports.
+func (p *PostgresDriver) Capabilities() DriverCapabilities {
+	return DriverCapabilities{TransactionalDDL: true, AdvisoryLocks: true, Copy: true, SQLValidation: true}
+}
+
+// AcquireLock takes the migration lock with pg_try_advisory_lock on a dedicated connection,
+// which holds it until released, retrying with backoff until the timeout elapses.
+func (p *PostgresDriver) AcquireLock(ctx context.Context, timeout time.Duration) (func() error, error) {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := migrationLockName(p.migrationTableName, p.namespace)
+	deadline := time.Now().Add(timeout)
+	backoff := 100 * time.Millisecond
+
+	for {
+		var acquired bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", name).Scan(&acquired); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if acquired {
+			break
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			conn.Close()
+			return nil, fmt.Errorf("%w: %s", ErrMigrationLocked, name)
+		}
+		if err := sleepContext(ctx, min(backoff, remaining)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		backoff = min(backoff*2, 2*time.Second)
+	}
+
+	return func() error {
+		defer conn.Close()
+		_, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", name)
+		return err
+	}, nil
+}
+
+// Close closes the database connection, and the read replica connection if any. Both are
+// closed even if one fails, and the errors are returned joined.
 func (p *PostgresDriver) Close() error {
+	var errs []error
+	if p.replica != nil {
+		if err := p.replica.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close read replica: %w", err))
+		}
+	}
 	if p.db != nil {
-		return p.db.Close()
+		if err := p.db.Close(); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 // SetMigrationTableName sets the name of the table used to track executed migrations.
@@ -63,30 +231,126 @@ func (p *PostgresDriver) SetMigrationTableName(name string) {
 	p.migrationTableName = name
 }
 
+// Clone returns a copy of the driver that shares its database connection.
+func (p *PostgresDriver) Clone() Driver {
+	c := *p
+	return &c
+}
+
+// records returns the WHERE clauses restricting statements to the namespace of the driver.
+func (p *PostgresDriver) records() migrationRecords {
+	return migrationRecords{namespace: p.namespace, placeholder: func(n int) string { return "$" + strconv.Itoa(n) }}
+}
+
+// SetNamespace sets the namespace that migration records are tracked under, allowing several
+// logical databases to share one migration table. The empty namespace is the default one.
+func (p *PostgresDriver) SetNamespace(namespace string) {
+	p.namespace = namespace
+}
+
+// SetTwoPhaseRecording enables recording each migration with a null executed_at before it runs
+// and setting executed_at once it succeeds.
+func (p *PostgresDriver) SetTwoPhaseRecording(enabled bool) {
+	p.twoPhaseRecording = enabled
+}
+
+// SetDelayBetweenMigrations sets how long ApplyMigrations waits between migrations, giving
+// replicas time to catch up. Zero disables the delay.
+func (p *PostgresDriver) SetDelayBetweenMigrations(delay time.Duration) {
+	p.delay = delay
+}
+
+// SetStoreDownSQL enables saving the down script of each applied migration in the
+// down_sql column of the migration table.
+func (p *PostgresDriver) SetStoreDownSQL(enabled bool) {
+	p.storeDownSQL = enabled
+}
+
+// SetRecordDurations enables saving how long each migration took to apply in the
+// duration_ms column of the migration table.
+func (p *PostgresDriver) SetRecordDurations(enabled bool) {
+	p.recordDurations = enabled
+}
+
+// SetClock sets the clock used for the recorded execution time of migrations.
+func (p *PostgresDriver) SetClock(clock Clock) {
+	p.clock = clock
+}
+
+// SetRecordMigration sets a function called instead of the default insert into the migration table.
+func (p *PostgresDriver) SetRecordMigration(record RecordMigrationFunc) {
+	p.recordMigration = record
+}
+
+// SetRemoveMigration sets a function called instead of the default delete from the migration table.
+func (p *PostgresDriver) SetRemoveMigration(remove RemoveMigrationFunc) {
+	p.removeMigration = remove
+}
+
+// SetSQLTransform sets the function used to rewrite migration scripts before execution.
+func (p *PostgresDriver) SetSQLTransform(transform SQLTransformFunc) {
+	p.sqlTransform = transform
+}
+
+// SetCleanPrefix restricts CleanDatabase to the tables whose names start with prefix.
+func (p *PostgresDriver) SetCleanPrefix(prefix string) {
+	p.cleanPrefix = prefix
+}
+
 // CreateMigrationsTable creates the migration tracking table if it does not exist.
 func (p *PostgresDriver) CreateMigrationsTable(ctx context.Context) error {
+	return p.CreateMigrationsTableWith(ctx, p.db)
+}
+
+// CreateMigrationsTableWith creates the migration tracking table with exec, which may be a
+// transaction of the caller since DDL is transactional in PostgreSQL.
+func (p *PostgresDriver) CreateMigrationsTableWith(ctx context.Context, exec SQLExecutor) error {
 	query := fmt.Sprintf(`
 		CREATE TABLE IF NOT EXISTS %s (
-			name VARCHAR(255) PRIMARY KEY NOT NULL,
-			executed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			namespace VARCHAR(255) NOT NULL DEFAULT '',
+			name VARCHAR(255) NOT NULL,
+			executed_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP,
+			down_sql TEXT NULL,
+			duration_ms BIGINT NULL,
+			version BIGSERIAL,
+			PRIMARY KEY (namespace, name)
 		);
 	`, p.migrationTableName)
-	_, err := p.db.ExecContext(ctx, query)
+	_, err := exec.ExecContext(ctx, query)
 	return err
 }
 
 // GetExecutedMigrations returns a list of executed migrations from the tracking table.
 // If reverse is true, the list is ordered descending by name.
 func (p *PostgresDriver) GetExecutedMigrations(ctx context.Context, reverse bool) ([]ExecutedMigration, error) {
+	return p.queryExecutedMigrations(ctx, p.db, reverse)
+}
+
+// GetExecutedMigrationsFromReplica returns the executed migrations in ascending order, read
+// from the read replica if one is configured.
+func (p *PostgresDriver) GetExecutedMigrationsFromReplica(ctx context.Context) ([]ExecutedMigration, error) {
+	if p.replica == nil {
+		return p.GetExecutedMigrations(ctx, false)
+	}
+	return p.queryExecutedMigrations(ctx, p.replica, false)
+}
+
+// queryExecutedMigrations reads the executed migrations from db.
+func (p *PostgresDriver) queryExecutedMigrations(ctx context.Context, db *sql.DB, reverse bool) ([]ExecutedMigration, error) {
 	order := "ASC"
 	if reverse {
 		order = "DESC"
 	}
-	query := fmt.Sprintf(`SELECT name, executed_at FROM %s ORDER BY name %s;`, p.migrationTableName, order)
+	where, args := p.records().inNamespace(1)
+	columns := "name, executed_at"
+	if p.recordDurations {
+		columns += ", duration_ms"
+	}
+	query := fmt.Sprintf(`SELECT %s FROM %s %s ORDER BY name %s;`, columns, p.migrationTableName, where, order)
 
-	rows, err := p.db.QueryContext(ctx, query)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, p.checkMigrationTable(ctx, db, err)
 	}
 	defer rows.Close()
 
@@ -94,13 +358,20 @@ func (p *PostgresDriver) GetExecutedMigrations(ctx context.Context, reverse bool
 
 	for rows.Next() {
 		var name string
-		var executedAt time.Time
-		if err := rows.Scan(&name, &executedAt); err != nil {
-			return nil, err
+		var executedAt sql.NullTime
+		var durationMs sql.NullInt64
+		dest := []any{&name, &executedAt}
+		if p.recordDurations {
+			dest = append(dest, &durationMs)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, p.checkMigrationTable(ctx, db, err)
 		}
 		migrations = append(migrations, ExecutedMigration{
 			Name:       name,
-			ExecutedAt: executedAt,
+			ExecutedAt: executedAt.Time,
+			InProgress: !executedAt.Valid,
+			Duration:   time.Duration(durationMs.Int64) * time.Millisecond,
 		})
 	}
 
@@ -111,15 +382,70 @@ func (p *PostgresDriver) GetExecutedMigrations(ctx context.Context, reverse bool
 	return migrations, nil
 }
 
-// CleanDatabase drops all tables in the "public" schema.
-func (p *PostgresDriver) CleanDatabase(ctx context.Context) error {
+// checkMigrationTable replaces err, a failure to read the migration table, with a descriptive
+// ErrInvalidMigrationTable if the table lacks columns the driver reads.
+func (p *PostgresDriver) checkMigrationTable(ctx context.Context, db *sql.DB, err error) error {
+	required := []string{"namespace", "name", "executed_at"}
+	if p.recordDurations {
+		required = append(required, "duration_ms")
+	}
+	return checkMigrationTableColumns(ctx, db,
+		"SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1",
+		p.migrationTableName, required, err,
+	)
+}
+
+// ReadHistory returns the executed migrations with every column of the migration table.
+func (p *PostgresDriver) ReadHistory(ctx context.Context) (MigrationHistory, error) {
+	where, args := p.records().inNamespace(1)
+
+	query := fmt.Sprintf(`SELECT * FROM %s %s ORDER BY name ASC`, p.migrationTableName, where)
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanMigrationHistory(rows)
+}
+
+// ReadVersions returns the version numbers recorded for the executed migrations, keyed by
+// migration name.
+func (p *PostgresDriver) ReadVersions(ctx context.Context) (map[string]int, error) {
+	where, args := p.records().inNamespace(1)
+
+	query := fmt.Sprintf(`SELECT name, version FROM %s %s`, p.migrationTableName, where)
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanMigrationVersions(rows)
+}
+
+// ExecuteSQL runs an arbitrary SQL script without recording it in the migration table.
+func (p *PostgresDriver) ExecuteSQL(ctx context.Context, sql string) error {
+	if sql == "" {
+		return nil
+	}
+
+	_, err := p.db.ExecContext(ctx, sql)
+	return err
+}
+
+// CleanDatabase drops all tables in the "public" schema and returns their names. With a clean
+// prefix, only the prefixed tables are dropped, and without CASCADE, so a table of another
+// application that depends on them makes the drop fail instead of losing its constraints
+// or views.
+func (p *PostgresDriver) CleanDatabase(ctx context.Context) ([]string, error) {
 	rows, err := p.db.QueryContext(ctx, `
 		SELECT tablename
 		FROM pg_tables
 		WHERE schemaname = 'public';
 	`)
 	if err != nil {
-		return fmt.Errorf("query table names: %w", err)
+		return nil, fmt.Errorf("query table names: %w", err)
 	}
 	defer rows.Close()
 
@@ -127,27 +453,143 @@ func (p *PostgresDriver) CleanDatabase(ctx context.Context) error {
 	for rows.Next() {
 		var table string
 		if err := rows.Scan(&table); err != nil {
-			return fmt.Errorf("scan table name: %w", err)
+			return nil, fmt.Errorf("scan table name: %w", err)
 		}
-		tables = append(tables, fmt.Sprintf(`"%s"`, table)) // safely quote identifiers
+		tables = append(tables, table)
+	}
+
+	tables, clearRecords := selectCleanTables(tables, p.cleanPrefix, p.migrationTableName)
+	if clearRecords {
+		where, args := p.records().inNamespace(1)
+		query := fmt.Sprintf(`DELETE FROM %s %s`, p.migrationTableName, where)
+		if _, err := p.db.ExecContext(ctx, query, args...); err != nil {
+			return nil, fmt.Errorf("delete migration records: %w", err)
+		}
+	}
+
+	// pg_tables returns names as stored, so quoting them exactly keeps mixed-case names intact
+	quoted := make([]string, 0, len(tables))
+	for _, table := range tables {
+		quoted = append(quoted, pq.QuoteIdentifier(table))
 	}
 
 	if len(tables) == 0 {
 		log.Println("no tables to drop")
-		return nil
+		return nil, nil
 	}
 
-	query := fmt.Sprintf(`DROP TABLE IF EXISTS %s CASCADE;`, strings.Join(tables, ", "))
+	behavior := "CASCADE"
+	if p.cleanPrefix != "" {
+		behavior = "RESTRICT"
+	}
+	query := fmt.Sprintf(`DROP TABLE IF EXISTS %s %s;`, strings.Join(quoted, ", "), behavior)
 	if _, err := p.db.ExecContext(ctx, query); err != nil {
-		return fmt.Errorf("drop tables: %w", err)
+		return nil, fmt.Errorf("drop tables: %w", err)
 	}
 
-	log.Println("all public tables dropped")
-	return nil
+	if p.cleanPrefix != "" {
+		log.Printf("public tables starting with %q dropped\n", p.cleanPrefix)
+	} else {
+		log.Println("all public tables dropped")
+	}
+	return tables, nil
+}
+
+// GenerateDiffMigration compares the tables and columns of the current schema with those of
+// the database at targetDSN and returns the SQL that migrates to the target schema and back.
+// The migration tracking table is ignored.
+func (p *PostgresDriver) GenerateDiffMigration(ctx context.Context, targetDSN string) (string, string, error) {
+	target, err := sql.Open("postgres", targetDSN)
+	if err != nil {
+		return "", "", fmt.Errorf("open target database: %w", err)
+	}
+	defer target.Close()
+
+	currentSchema, err := p.snapshotSchema(ctx, p.db)
+	if err != nil {
+		return "", "", fmt.Errorf("snapshot current schema: %w", err)
+	}
+
+	targetSchema, err := p.snapshotSchema(ctx, target)
+	if err != nil {
+		return "", "", fmt.Errorf("snapshot target schema: %w", err)
+	}
+
+	up, down := diffSchemas(currentSchema, targetSchema, quotePostgresIdentifier)
+	return up, down, nil
+}
+
+// SnapshotCurrentSchema reads the tables and columns of the schema the driver is connected to.
+func (p *PostgresDriver) SnapshotCurrentSchema(ctx context.Context) (SchemaSnapshot, error) {
+	return p.snapshotSchema(ctx, p.db)
+}
+
+// SchemaFingerprint hashes the columns and indexes of the schema the driver is connected to.
+// Indexes are taken from pg_indexes, since information_schema does not describe them.
+func (p *PostgresDriver) SchemaFingerprint(ctx context.Context) (string, error) {
+	return fingerprintSchema(ctx, p.db, p.migrationTableName, `
+		SELECT table_name, column_name, data_type, character_maximum_length, numeric_precision,
+			numeric_scale, is_nullable, column_default
+		FROM information_schema.columns
+		WHERE table_schema = current_schema()
+		ORDER BY table_name, ordinal_position;
+	`, `
+		SELECT tablename, indexname, indexdef
+		FROM pg_indexes
+		WHERE schemaname = current_schema()
+		ORDER BY tablename, indexname;
+	`)
+}
+
+// snapshotSchema reads the tables and columns of the current schema from information_schema.
+func (p *PostgresDriver) snapshotSchema(ctx context.Context, db *sql.DB) (SchemaSnapshot, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT table_name, column_name, data_type, character_maximum_length, is_nullable
+		FROM information_schema.columns
+		WHERE table_schema = current_schema()
+		ORDER BY table_name, ordinal_position;
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshot := make(SchemaSnapshot)
+	for rows.Next() {
+		var table, column, dataType, isNullable string
+		var maxLength sql.NullInt64
+		if err := rows.Scan(&table, &column, &dataType, &maxLength, &isNullable); err != nil {
+			return nil, err
+		}
+		if table == p.migrationTableName {
+			continue
+		}
+		if maxLength.Valid {
+			dataType = fmt.Sprintf("%s(%d)", dataType, maxLength.Int64)
+		}
+		snapshot[table] = append(snapshot[table], SchemaColumn{
+			Name:     column,
+			Type:     dataType,
+			Nullable: isNullable == "YES",
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// quotePostgresIdentifier quotes an identifier, escaping embedded double quotes.
+func quotePostgresIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
 }
 
 // ApplyMigrations runs the "up" SQL scripts for the given migrations.
 // Optional callbacks can be provided to track the progress of each migration.
+// Consecutive migrations sharing a transaction group are applied in a single transaction,
+// and migrations providing COPY data are each applied in their own transaction.
 func (p *PostgresDriver) ApplyMigrations(
 	ctx context.Context,
 	migrations []Migration,
@@ -155,27 +597,83 @@ func (p *PostgresDriver) ApplyMigrations(
 	onSuccess func(migration *Migration),
 	onFailed func(migration *Migration, err error),
 ) error {
-	for i := range migrations {
+	for i := 0; i < len(migrations); {
+		if i > 0 {
+			if err := sleepContext(ctx, p.delay); err != nil {
+				return err
+			}
+		}
+
+		if group := transactionGroup(migrations[i]); group != "" {
+			end := i + 1
+			for end < len(migrations) && transactionGroup(migrations[end]) == group {
+				end++
+			}
+			label := fmt.Sprintf("transaction group %s", group)
+			if err := p.applyInTransaction(ctx, label, migrations[i:end], onRunning, onSuccess, onFailed); err != nil {
+				return err
+			}
+			i = end
+			continue
+		}
+
 		m := migrations[i]
+		i++
+
+		// COPY must run inside a transaction together with the migration's SQL
+		if _, ok := m.(CopyMigration); ok {
+			label := fmt.Sprintf("migration %s", m.Name())
+			if err := p.applyInTransaction(ctx, label, []Migration{m}, onRunning, onSuccess, onFailed); err != nil {
+				return err
+			}
+			continue
+		}
 
 		if onRunning != nil {
 			onRunning(&m)
 		}
 
-		if err := p.executeMigrationSQL(ctx, m.UpScript()); err != nil {
+		if p.recordsInTwoPhases() {
+			if err := p.startExecutedMigration(ctx, p.db, m.Name()); err != nil {
+				if onFailed != nil {
+					onFailed(&m, err)
+				}
+				return fmt.Errorf("failed to record start of migration %s: %w", m.Name(), err)
+			}
+		}
+
+		started := time.Now()
+		if err := p.runUp(ctx, p.db, m); err != nil {
+			if p.recordsInTwoPhases() {
+				_ = p.removeExecutedMigration(context.WithoutCancel(ctx), p.db, m.Name())
+			}
 			if onFailed != nil {
 				onFailed(&m, err)
 			}
 			return fmt.Errorf("failed to apply migration %s: %w", m.Name(), err)
 		}
 
-		if err := p.insertExecutedMigration(ctx, m.Name(), time.Now()); err != nil {
+		if err := p.completeExecutedMigration(ctx, p.db, m.Name(), clockNow(p.clock)); err != nil {
 			if onFailed != nil {
 				onFailed(&m, err)
 			}
 			return fmt.Errorf("failed to record migration %s: %w", m.Name(), err)
 		}
 
+		if err := p.storeDownScript(ctx, p.db, m); err != nil {
+			if onFailed != nil {
+				onFailed(&m, err)
+			}
+			return fmt.Errorf("failed to store down script of migration %s: %w", m.Name(), err)
+		}
+
+		if err := p.storeDuration(ctx, p.db, m.Name(), time.Since(started)); err != nil {
+			if onFailed != nil {
+				onFailed(&m, err)
+			}
+			return fmt.Errorf("failed to store duration of migration %s: %w", m.Name(), err)
+		}
+
 		if onSuccess != nil {
 			onSuccess(&m)
 		}
@@ -184,6 +682,76 @@ func (p *PostgresDriver) ApplyMigrations(
 	return nil
 }
 
+// applyInTransaction applies the given migrations, such as the members of a transaction group,
+// in a single transaction. The transaction is committed only after the last migration succeeds.
+// If any migration fails, all of them are rolled back and reported as failed.
+func (p *PostgresDriver) applyInTransaction(
+	ctx context.Context,
+	label string,
+	migrations []Migration,
+	onRunning func(migration *Migration),
+	onSuccess func(migration *Migration),
+	onFailed func(migration *Migration, err error),
+) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin %s: %w", label, err)
+	}
+
+	fail := func(failed int, err error) error {
+		_ = tx.Rollback()
+		if onFailed != nil {
+			for i := range migrations {
+				m := migrations[i]
+				if i == failed {
+					onFailed(&m, err)
+				} else {
+					onFailed(&m, fmt.Errorf("rolled back with %s: %w", label, err))
+				}
+			}
+		}
+		return fmt.Errorf("failed to apply %s: %w", label, err)
+	}
+
+	for i := range migrations {
+		m := migrations[i]
+
+		if onRunning != nil {
+			onRunning(&m)
+		}
+
+		started := time.Now()
+		if err := p.runUp(ctx, tx, m); err != nil {
+			return fail(i, fmt.Errorf("failed to apply migration %s: %w", m.Name(), err))
+		}
+
+		if err := p.insertExecutedMigration(ctx, tx, m.Name(), clockNow(p.clock)); err != nil {
+			return fail(i, fmt.Errorf("failed to record migration %s: %w", m.Name(), err))
+		}
+
+		if err := p.storeDownScript(ctx, tx, m); err != nil {
+			return fail(i, fmt.Errorf("failed to store down script of migration %s: %w", m.Name(), err))
+		}
+
+		if err := p.storeDuration(ctx, tx, m.Name(), time.Since(started)); err != nil {
+			return fail(i, fmt.Errorf("failed to store duration of migration %s: %w", m.Name(), err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fail(len(migrations)-1, fmt.Errorf("failed to commit: %w", err))
+	}
+
+	if onSuccess != nil {
+		for i := range migrations {
+			m := migrations[i]
+			onSuccess(&m)
+		}
+	}
+
+	return nil
+}
+
 // UnapplyMigrations runs the "down" SQL scripts for the given migrations in reverse order.
 // Optional callbacks can be provided to track the progress of each migration.
 func (p *PostgresDriver) UnapplyMigrations(
@@ -200,14 +768,14 @@ func (p *PostgresDriver) UnapplyMigrations(
 			onRunning(&mig)
 		}
 
-		if err := p.executeMigrationSQL(ctx, mig.DownScript()); err != nil {
+		if err := p.runDown(ctx, p.db, mig); err != nil {
 			if onFailed != nil {
 				onFailed(&mig, err)
 			}
 			return fmt.Errorf("failed to unapply migration %s: %w", mig.Name(), err)
 		}
 
-		if err := p.removeExecutedMigration(ctx, mig.Name()); err != nil {
+		if err := p.removeExecutedMigration(ctx, p.db, mig.Name()); err != nil {
 			if onFailed != nil {
 				onFailed(&mig, err)
 			}
@@ -222,26 +790,300 @@ func (p *PostgresDriver) UnapplyMigrations(
 	return nil
 }
 
-// executeMigrationSQL runs a given SQL script as part of a migration.
-func (p *PostgresDriver) executeMigrationSQL(ctx context.Context, sql string) error {
+// runUp applies a migration, calling its Run method if it implements RunnableMigration
+// or executing its up script otherwise. Migrations implementing ConditionalMigration
+// are skipped when ShouldRun returns false. Both receive the connection pool rather than
+// exec, so they are refused inside a transaction group or COPY transaction, where they would
+// commit outside of it.
+func (p *PostgresDriver) runUp(ctx context.Context, exec SQLExecutor, migration Migration) error {
+	if target, ok := migration.(DatabaseMigration); ok && target.Database() != "" {
+		return fmt.Errorf("%w: %s", ErrDatabaseNotSupported, target.Database())
+	}
+	if _, inTransaction := exec.(*sql.Tx); inTransaction && usesOwnConnection(migration) {
+		return fmt.Errorf("%w: %s", ErrMigrationNotTransactional, migration.Name())
+	}
+	if _, inTransaction := exec.(*sql.Tx); inTransaction && isNonTransactional(migration) {
+		return fmt.Errorf("migration %s asks to run without a transaction and cannot be applied in one", migration.Name())
+	}
+	ctx, cancel := withMigrationTimeout(ctx, migration)
+	defer cancel()
+	if conditional, ok := migration.(ConditionalMigration); ok {
+		shouldRun, err := conditional.ShouldRun(ctx, p.db)
+		if err != nil {
+			return fmt.Errorf("failed to check whether migration should run: %w", err)
+		}
+		if !shouldRun {
+			return nil
+		}
+	}
+	if runnable, ok := migration.(RunnableMigration); ok {
+		return runnable.Run(ctx, p.db)
+	}
+	if streamed, ok := migration.(StreamedMigration); ok {
+		if err := p.streamMigrationSQL(ctx, exec, migration.Name(), streamed.UpReader); err != nil {
+			return err
+		}
+	} else {
+		var args []any
+		if parameterized, ok := migration.(ParameterizedMigration); ok {
+			args = parameterized.UpArgs()
+		}
+		if err := p.executeScript(ctx, exec, migration, migration.UpScript(), args...); err != nil {
+			return err
+		}
+	}
+	if copyMigration, ok := migration.(CopyMigration); ok {
+		tx, ok := exec.(*sql.Tx)
+		if !ok {
+			return fmt.Errorf("COPY data of migration %s must be loaded inside a transaction", migration.Name())
+		}
+		return p.copyData(ctx, tx, copyMigration)
+	}
+	return nil
+}
+
+// usesOwnConnection reports whether the migration runs Go code with the connection pool,
+// which cannot take part in a transaction of the driver.
+func usesOwnConnection(migration Migration) bool {
+	_, runnable := migration.(RunnableMigration)
+	_, conditional := migration.(ConditionalMigration)
+	return runnable || conditional
+}
+
+// copyData bulk-loads the rows of a CopyMigration using the COPY protocol.
+func (p *PostgresDriver) copyData(ctx context.Context, tx *sql.Tx, migration CopyMigration) error {
+	table, columns, rows := migration.CopyData()
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table, columns...))
+	if err != nil {
+		return fmt.Errorf("failed to start COPY into %s: %w", table, err)
+	}
+	defer stmt.Close()
+
+	for _, row := range rows {
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			return fmt.Errorf("failed to COPY row into %s: %w", table, err)
+		}
+	}
+
+	// An Exec without arguments flushes the buffered rows
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("failed to complete COPY into %s: %w", table, err)
+	}
+
+	return nil
+}
+
+// runDown reverts a migration, calling its Rollback method if it implements RunnableMigration
+// or executing its down script otherwise.
+func (p *PostgresDriver) runDown(ctx context.Context, exec SQLExecutor, migration Migration) error {
+	if target, ok := migration.(DatabaseMigration); ok && target.Database() != "" {
+		return fmt.Errorf("%w: %s", ErrDatabaseNotSupported, target.Database())
+	}
+	ctx, cancel := withMigrationTimeout(ctx, migration)
+	defer cancel()
+	if runnable, ok := migration.(RunnableMigration); ok {
+		return runnable.Rollback(ctx, p.db)
+	}
+	if streamed, ok := migration.(StreamedMigration); ok {
+		return p.streamMigrationSQL(ctx, exec, migration.Name(), streamed.DownReader)
+	}
+	var args []any
+	if parameterized, ok := migration.(ParameterizedMigration); ok {
+		args = parameterized.DownArgs()
+	}
+	return p.executeScript(ctx, exec, migration, downScript(ctx, migration), args...)
+}
+
+// executeScript runs an up or down script of the migration. The script of a
+// NonTransactionalMigration without query arguments is run one statement at a time, so each
+// statement commits on its own instead of the whole script running in one implicit
+// transaction.
+func (p *PostgresDriver) executeScript(ctx context.Context, exec SQLExecutor, migration Migration, script string, args ...any) error {
+	if len(args) == 0 && isNonTransactional(migration) {
+		return p.streamMigrationSQL(ctx, exec, migration.Name(), func() (io.Reader, error) {
+			return strings.NewReader(script), nil
+		})
+	}
+	return p.executeMigrationSQL(ctx, exec, migration.Name(), script, args...)
+}
+
+// streamMigrationSQL executes the statements of a StreamedMigration script one at a time.
+func (p *PostgresDriver) streamMigrationSQL(ctx context.Context, exec SQLExecutor, name string, open func() (io.Reader, error)) error {
+	return streamMigrationSQL(open, sqlDialect{dollarQuotes: true, escapeStrings: true}, func(statement string) error {
+		return p.executeMigrationSQL(ctx, exec, name, statement)
+	})
+}
+
+// executeMigrationSQL runs a given SQL script with optional query arguments as part of a migration.
+// If an SQL transform is set, it is applied to the script before execution.
+func (p *PostgresDriver) executeMigrationSQL(ctx context.Context, exec SQLExecutor, name string, sql string, args ...any) error {
+	if p.sqlTransform != nil {
+		transformed, err := p.sqlTransform(name, sql)
+		if err != nil {
+			return fmt.Errorf("failed to transform SQL: %w", err)
+		}
+		sql = transformed
+	}
 	if sql == "" {
 		return nil
 	}
 
-	_, err := p.db.ExecContext(ctx, sql)
+	if _, err := exec.ExecContext(ctx, sql, args...); err != nil {
+		return &MigrationSQLError{Migration: name, SQL: sql, Err: err}
+	}
+	return nil
+}
+
+// ValidateSQL checks that the script of the named migration parses without running it, by
+// compiling it as the body of a PL/pgSQL block that returns before reaching it. The SQL
+// transform is applied first, as it would be before execution.
+func (p *PostgresDriver) ValidateSQL(ctx context.Context, name string, script string) error {
+	if p.sqlTransform != nil {
+		transformed, err := p.sqlTransform(name, script)
+		if err != nil {
+			return fmt.Errorf("failed to transform SQL: %w", err)
+		}
+		script = transformed
+	}
+
+	script = strings.TrimSpace(script)
+	if !strings.HasSuffix(script, ";") {
+		script += ";"
+	}
+
+	query := fmt.Sprintf("DO $qafoia_validate$ BEGIN RETURN;\n%s\nEND $qafoia_validate$", script)
+	if _, err := p.db.ExecContext(ctx, query); err != nil {
+		return &MigrationSQLError{Migration: name, SQL: script, Err: err}
+	}
+	return nil
+}
+
+// RecordExecutedMigration records the migration as executed without running its SQL.
+func (p *PostgresDriver) RecordExecutedMigration(ctx context.Context, name string, executedAt time.Time) error {
+	return p.insertExecutedMigration(ctx, p.db, name, executedAt)
+}
+
+// ForgetExecutedMigration removes the record of the migration without running its SQL.
+func (p *PostgresDriver) ForgetExecutedMigration(ctx context.Context, name string) error {
+	return p.removeExecutedMigration(ctx, p.db, name)
+}
+
+// SetExecutedAt changes the recorded execution time of a migration.
+func (p *PostgresDriver) SetExecutedAt(ctx context.Context, name string, executedAt time.Time) error {
+	return p.updateExecutedAt(ctx, p.db, name, executedAt)
+}
+
+// ReplaceExecutedMigration replaces all records of a migration with a single one in a
+// transaction, so a failure leaves the records as they were.
+func (p *PostgresDriver) ReplaceExecutedMigration(ctx context.Context, name string, executedAt time.Time) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := p.removeExecutedMigration(ctx, tx, name); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := p.insertExecutedMigration(ctx, tx, name, executedAt); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// RenameExecutedMigration changes the name a migration is recorded under, keeping the rest
+// of its record.
+func (p *PostgresDriver) RenameExecutedMigration(ctx context.Context, oldName string, newName string) error {
+	where, args := p.records().named(2, oldName)
+	query := fmt.Sprintf(`UPDATE %s SET name = $1 %s`, p.migrationTableName, where)
+	_, err := p.db.ExecContext(ctx, query, append([]any{newName}, args...)...)
 	return err
 }
 
 // insertExecutedMigration records the given migration name and execution time in the tracking table.
-func (p *PostgresDriver) insertExecutedMigration(ctx context.Context, name string, executedAt time.Time) error {
-	query := fmt.Sprintf(`INSERT INTO %s (name, executed_at) VALUES ($1, $2)`, p.migrationTableName)
-	_, err := p.db.ExecContext(ctx, query, name, executedAt)
+// A migration that is already recorded is left as is, so recording is idempotent.
+func (p *PostgresDriver) insertExecutedMigration(ctx context.Context, exec SQLExecutor, name string, executedAt time.Time) error {
+	if p.recordMigration != nil {
+		return p.recordMigration(ctx, exec, name, executedAt)
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s (namespace, name, executed_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`, p.migrationTableName)
+	_, err := exec.ExecContext(ctx, query, p.namespace, name, executedAt)
+	return err
+}
+
+// recordsInTwoPhases reports whether migrations are recorded before they run and completed
+// after. Custom record and remove functions disable it, as the start marker is written with
+// the default statements.
+func (p *PostgresDriver) recordsInTwoPhases() bool {
+	return p.twoPhaseRecording && p.recordMigration == nil && p.removeMigration == nil
+}
+
+// startExecutedMigration records a migration with a null executed_at before it runs, leaving
+// a visible marker if the process stops before the migration finishes.
+func (p *PostgresDriver) startExecutedMigration(ctx context.Context, exec SQLExecutor, name string) error {
+	query := fmt.Sprintf(`INSERT INTO %s (namespace, name, executed_at) VALUES ($1, $2, NULL)`, p.migrationTableName)
+	_, err := exec.ExecContext(ctx, query, p.namespace, name)
+	return err
+}
+
+// completeExecutedMigration records a migration that ran outside a transaction as executed,
+// setting executed_at on the row written by startExecutedMigration with two-phase recording.
+func (p *PostgresDriver) completeExecutedMigration(ctx context.Context, exec SQLExecutor, name string, executedAt time.Time) error {
+	if !p.recordsInTwoPhases() {
+		return p.insertExecutedMigration(ctx, exec, name, executedAt)
+	}
+	return p.updateExecutedAt(ctx, exec, name, executedAt)
+}
+
+// updateExecutedAt sets executed_at on the record of the migration.
+func (p *PostgresDriver) updateExecutedAt(ctx context.Context, exec SQLExecutor, name string, executedAt time.Time) error {
+	where, args := p.records().named(2, name)
+	query := fmt.Sprintf(`UPDATE %s SET executed_at = $1 %s`, p.migrationTableName, where)
+	_, err := exec.ExecContext(ctx, query, append([]any{executedAt}, args...)...)
+	return err
+}
+
+// storeDownScript saves the down script of the migration in the migration table when
+// storing down scripts is enabled. Migrations implementing RunnableMigration have no script
+// to store.
+func (p *PostgresDriver) storeDownScript(ctx context.Context, exec SQLExecutor, migration Migration) error {
+	if !p.storeDownSQL {
+		return nil
+	}
+	if _, ok := migration.(RunnableMigration); ok {
+		return nil
+	}
+
+	where, args := p.records().named(2, migration.Name())
+	query := fmt.Sprintf(`UPDATE %s SET down_sql = $1 %s`, p.migrationTableName, where)
+	_, err := exec.ExecContext(ctx, query, append([]any{migration.DownScript()}, args...)...)
+	return err
+}
+
+// storeDuration saves how long the migration took to apply in the migration table when
+// recording durations is enabled.
+func (p *PostgresDriver) storeDuration(ctx context.Context, exec SQLExecutor, name string, duration time.Duration) error {
+	if !p.recordDurations {
+		return nil
+	}
+
+	where, args := p.records().named(2, name)
+	query := fmt.Sprintf(`UPDATE %s SET duration_ms = $1 %s`, p.migrationTableName, where)
+	_, err := exec.ExecContext(ctx, query, append([]any{duration.Milliseconds()}, args...)...)
 	return err
 }
 
 // removeExecutedMigration deletes the record of the given migration from the tracking table.
-func (p *PostgresDriver) removeExecutedMigration(ctx context.Context, name string) error {
-	query := fmt.Sprintf(`DELETE FROM %s WHERE name = $1`, p.migrationTableName)
-	_, err := p.db.ExecContext(ctx, query, name)
+func (p *PostgresDriver) removeExecutedMigration(ctx context.Context, exec SQLExecutor, name string) error {
+	if p.removeMigration != nil {
+		return p.removeMigration(ctx, exec, name)
+	}
+
+	where, args := p.records().named(1, name)
+	query := fmt.Sprintf(`DELETE FROM %s %s`, p.migrationTableName, where)
+	_, err := exec.ExecContext(ctx, query, args...)
 	return err
 }
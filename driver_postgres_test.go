@@ -3,6 +3,9 @@ package qafoia
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -36,6 +39,14 @@ func TestNewPostgresDriver(t *testing.T) {
 	assert.NotNil(t, driver)
 }
 
+func TestDBPostgresDriver(t *testing.T) {
+	db, _, driver := setupMockDBPostgres(t)
+	defer db.Close()
+
+	var provider DBProvider = driver
+	assert.Same(t, db, provider.DB())
+}
+
 func TestCreateMigrationsTablePostgresDriver(t *testing.T) {
 	db, mock, driver := setupMockDBPostgres(t)
 	defer db.Close()
@@ -47,6 +58,30 @@ func TestCreateMigrationsTablePostgresDriver(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestInitTxPostgresDriver(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TABLE users`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	assert.NoError(t, err)
+	_, err = tx.ExecContext(ctx, "CREATE TABLE users (id INT)")
+	assert.NoError(t, err)
+
+	q := &Qafoia{driver: driver}
+	assert.NoError(t, q.InitTx(ctx, tx))
+	assert.NoError(t, tx.Rollback())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	q.driver = new(mockDriver)
+	assert.ErrorIs(t, q.InitTx(ctx, nil), ErrTransactionNotSupported)
+}
+
 func TestSetMigrationTableNamePostgresDriver(t *testing.T) {
 	driver := &PostgresDriver{}
 
@@ -57,6 +92,24 @@ func TestSetMigrationTableNamePostgresDriver(t *testing.T) {
 	assert.Equal(t, "custom_migrations", driver.migrationTableName)
 }
 
+func TestGetExecutedMigrationsRecordDurationsPostgresDriver(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+	driver.SetRecordDurations(true)
+
+	rows := sqlmock.NewRows([]string{"name", "executed_at", "duration_ms"}).
+		AddRow("migration_1", time.Now(), int64(1500)).
+		AddRow("migration_2", time.Now(), nil)
+	mock.ExpectQuery(`SELECT name, executed_at, duration_ms FROM migrations WHERE namespace = \$1 ORDER BY name ASC;`).WithArgs("").
+		WillReturnRows(rows)
+
+	migrations, err := driver.GetExecutedMigrations(context.Background(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1500*time.Millisecond, migrations[0].Duration)
+	assert.Zero(t, migrations[1].Duration)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestGetExecutedMigrationsPostgresDriver(t *testing.T) {
 	db, mock, driver := setupMockDBPostgres(t)
 	defer db.Close()
@@ -65,7 +118,7 @@ func TestGetExecutedMigrationsPostgresDriver(t *testing.T) {
 		AddRow("migration_1", time.Now()).
 		AddRow("migration_2", time.Now())
 
-	mock.ExpectQuery(`SELECT name, executed_at FROM migrations ORDER BY name ASC;`).
+	mock.ExpectQuery(`SELECT name, executed_at FROM migrations WHERE namespace = \$1 ORDER BY name ASC;`).WithArgs("").
 		WillReturnRows(rows)
 
 	migrations, err := driver.GetExecutedMigrations(context.Background(), false)
@@ -90,8 +143,52 @@ func TestCleanDatabasePostgresDriver(t *testing.T) {
 	mock.ExpectExec(`DROP TABLE IF EXISTS "table1", "table2" CASCADE;`).
 		WillReturnResult(sqlmock.NewResult(0, 0))
 
-	err := driver.CleanDatabase(context.Background())
+	dropped, err := driver.CleanDatabase(context.Background())
 	assert.NoError(t, err)
+	assert.Equal(t, []string{"table1", "table2"}, dropped)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCleanDatabaseCaseSensitiveTablesPostgresDriver(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+
+	tableRows := sqlmock.NewRows([]string{"tablename"}).
+		AddRow("UserAccounts").
+		AddRow(`odd"name`)
+
+	mock.ExpectQuery(`SELECT tablename FROM pg_tables WHERE schemaname = 'public';`).
+		WillReturnRows(tableRows)
+	mock.ExpectExec(regexp.QuoteMeta(`DROP TABLE IF EXISTS "UserAccounts", "odd""name" CASCADE;`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	dropped, err := driver.CleanDatabase(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"UserAccounts", `odd"name`}, dropped)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCleanDatabaseWithPrefixPostgresDriver(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+	driver.SetCleanPrefix("myapp_")
+
+	tableRows := sqlmock.NewRows([]string{"tablename"}).
+		AddRow("myapp_users").
+		AddRow("other_orders").
+		AddRow("migrations")
+
+	mock.ExpectQuery(`SELECT tablename FROM pg_tables WHERE schemaname = 'public';`).
+		WillReturnRows(tableRows)
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM migrations WHERE namespace = $1`)).
+		WithArgs("").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`DROP TABLE IF EXISTS "myapp_users" RESTRICT;`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	dropped, err := driver.CleanDatabase(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"myapp_users"}, dropped)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -106,7 +203,28 @@ func TestApplyMigrationsPostgresDriver(t *testing.T) {
 	}
 
 	mock.ExpectExec("CREATE TABLE test \\(id INT\\);").WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("migration1", sqlmock.AnyArg()).
+	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("", "migration1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := driver.ApplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyMigrationsNoTransactionPostgresDriver(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+
+	mig := FileMigration(MigrationFile{
+		Name:          "migration1",
+		UpSql:         []byte("CREATE INDEX CONCURRENTLY users_email ON users (email);\nCREATE INDEX CONCURRENTLY users_name ON users (name);"),
+		NoTransaction: true,
+		Timeout:       time.Minute,
+	})
+
+	mock.ExpectExec("CREATE INDEX CONCURRENTLY users_email").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE INDEX CONCURRENTLY users_name").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("", "migration1", sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	err := driver.ApplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil)
@@ -125,7 +243,7 @@ func TestUnapplyMigrationsPostgresDriver(t *testing.T) {
 	}
 
 	mock.ExpectExec(mig.down).WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectExec(`DELETE FROM migrations WHERE name = \$1`).WithArgs(mig.name).
+	mock.ExpectExec(`DELETE FROM migrations WHERE namespace = \$1 AND name = \$2`).WithArgs("", mig.name).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	err := driver.UnapplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil)
@@ -133,25 +251,288 @@ func TestUnapplyMigrationsPostgresDriver(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestSnapshotSchemaPostgresDriver(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT table_name, column_name, data_type, character_maximum_length, is_nullable FROM information_schema\.columns`).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"table_name", "column_name", "data_type", "character_maximum_length", "is_nullable"}).
+				AddRow("migrations", "name", "character varying", 255, "NO").
+				AddRow("users", "id", "integer", nil, "NO").
+				AddRow("users", "email", "character varying", 255, "YES"),
+		)
+
+	snapshot, err := driver.snapshotSchema(context.Background(), db)
+	assert.NoError(t, err)
+	assert.Equal(t, SchemaSnapshot{
+		"users": {
+			{Name: "id", Type: "integer"},
+			{Name: "email", Type: "character varying(255)", Nullable: true},
+		},
+	}, snapshot)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyConditionalMigrationSkippedPostgresDriver(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+
+	mig := &mockConditionalMigrationPostgresDriver{
+		mockMigrationPostgresDriver: mockMigrationPostgresDriver{
+			name: "migration1",
+			up:   "ALTER TABLE users ADD COLUMN email TEXT;",
+			down: "ALTER TABLE users DROP COLUMN email;",
+		},
+		shouldRun: false,
+	}
+
+	// The up script is skipped but the migration is still recorded
+	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("", "migration1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := driver.ApplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyConditionalMigrationRunPostgresDriver(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+
+	mig := &mockConditionalMigrationPostgresDriver{
+		mockMigrationPostgresDriver: mockMigrationPostgresDriver{
+			name: "migration1",
+			up:   "ALTER TABLE users ADD COLUMN email TEXT;",
+			down: "ALTER TABLE users DROP COLUMN email;",
+		},
+		shouldRun: true,
+	}
+
+	mock.ExpectExec(`ALTER TABLE users ADD COLUMN email TEXT;`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("", "migration1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := driver.ApplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyTransactionGroupPostgresDriver(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+
+	first := &mockGroupedMigrationPostgresDriver{
+		mockMigrationPostgresDriver: mockMigrationPostgresDriver{name: "migration1", up: "CREATE TABLE a (id INT);"},
+		group:                       "billing",
+	}
+	second := &mockGroupedMigrationPostgresDriver{
+		mockMigrationPostgresDriver: mockMigrationPostgresDriver{name: "migration2", up: "CREATE TABLE b (id INT);"},
+		group:                       "billing",
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TABLE a`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("", "migration1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`CREATE TABLE b`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("", "migration2", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	var succeeded []string
+	err := driver.ApplyMigrations(context.Background(), []Migration{first, second}, nil, func(m *Migration) {
+		succeeded = append(succeeded, (*m).Name())
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"migration1", "migration2"}, succeeded)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// mockGroupedRunnableMigrationPostgresDriver is a Go migration in a transaction group.
+type mockGroupedRunnableMigrationPostgresDriver struct {
+	mockGroupedMigrationPostgresDriver
+	ran bool
+}
+
+func (m *mockGroupedRunnableMigrationPostgresDriver) Run(ctx context.Context, db *sql.DB) error {
+	m.ran = true
+	return nil
+}
+
+func (m *mockGroupedRunnableMigrationPostgresDriver) Rollback(ctx context.Context, db *sql.DB) error {
+	return nil
+}
+
+func TestApplyTransactionGroupRunnablePostgresDriver(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+
+	first := &mockGroupedMigrationPostgresDriver{
+		mockMigrationPostgresDriver: mockMigrationPostgresDriver{name: "migration1", up: "CREATE TABLE a (id INT);"},
+		group:                       "billing",
+	}
+	second := &mockGroupedRunnableMigrationPostgresDriver{mockGroupedMigrationPostgresDriver: mockGroupedMigrationPostgresDriver{
+		mockMigrationPostgresDriver: mockMigrationPostgresDriver{name: "migration2"},
+		group:                       "billing",
+	}}
+
+	// The Go migration would commit on its own connection, so the whole group is refused
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TABLE a`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("", "migration1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectRollback()
+
+	err := driver.ApplyMigrations(context.Background(), []Migration{first, second}, nil, nil, nil)
+	assert.ErrorIs(t, err, ErrMigrationNotTransactional)
+	assert.False(t, second.ran)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyTransactionGroupRollbackPostgresDriver(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+
+	first := &mockGroupedMigrationPostgresDriver{
+		mockMigrationPostgresDriver: mockMigrationPostgresDriver{name: "migration1", up: "CREATE TABLE a (id INT);"},
+		group:                       "billing",
+	}
+	second := &mockGroupedMigrationPostgresDriver{
+		mockMigrationPostgresDriver: mockMigrationPostgresDriver{name: "migration2", up: "CREATE TABLE b (id INT);"},
+		group:                       "billing",
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TABLE a`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("", "migration1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`CREATE TABLE b`).WillReturnError(errors.New("boom"))
+	mock.ExpectRollback()
+
+	var failed []string
+	err := driver.ApplyMigrations(context.Background(), []Migration{first, second}, nil, nil, func(m *Migration, err error) {
+		failed = append(failed, (*m).Name())
+	})
+	assert.ErrorContains(t, err, "transaction group billing")
+	assert.Equal(t, []string{"migration1", "migration2"}, failed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyParameterizedMigrationPostgresDriver(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+
+	mig := &mockParameterizedMigrationPostgresDriver{
+		mockMigrationPostgresDriver: mockMigrationPostgresDriver{
+			name: "migration1",
+			up:   "INSERT INTO settings (key, value) VALUES ($1, $2);",
+			down: "DELETE FROM settings WHERE key = $1;",
+		},
+		upArgs:   []any{"region", "eu-west-1"},
+		downArgs: []any{"region"},
+	}
+
+	mock.ExpectExec(`INSERT INTO settings`).WithArgs("region", "eu-west-1").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("", "migration1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`DELETE FROM settings`).WithArgs("region").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`DELETE FROM migrations WHERE namespace = \$1 AND name = \$2`).WithArgs("", "migration1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	assert.NoError(t, driver.ApplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil))
+	assert.NoError(t, driver.UnapplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyCopyMigrationPostgresDriver(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+
+	mig := &mockCopyMigrationPostgresDriver{
+		mockMigrationPostgresDriver: mockMigrationPostgresDriver{
+			name: "migration1",
+			up:   "CREATE TABLE countries (code TEXT, name TEXT);",
+		},
+		table:   "countries",
+		columns: []string{"code", "name"},
+		rows:    [][]any{{"ID", "Indonesia"}, {"NL", "Netherlands"}},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TABLE countries`).WillReturnResult(sqlmock.NewResult(0, 0))
+	copyStmt := mock.ExpectPrepare(`COPY "countries" \("code", "name"\) FROM STDIN`)
+	copyStmt.ExpectExec().WithArgs("ID", "Indonesia").WillReturnResult(sqlmock.NewResult(0, 1))
+	copyStmt.ExpectExec().WithArgs("NL", "Netherlands").WillReturnResult(sqlmock.NewResult(0, 1))
+	copyStmt.ExpectExec().WithoutArgs().WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("", "migration1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := driver.ApplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestExecuteMigrationSQLPostgresDriver(t *testing.T) {
 	db, mock, driver := setupMockDBPostgres(t)
 	defer db.Close()
 
 	mock.ExpectExec(`SOME SQL STATEMENT`).WillReturnResult(sqlmock.NewResult(0, 0))
 
-	err := driver.executeMigrationSQL(context.Background(), "SOME SQL STATEMENT")
+	err := driver.executeMigrationSQL(context.Background(), db, "migration_name", "SOME SQL STATEMENT")
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestExecuteMigrationSQLWithTransformPostgresDriver(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+
+	driver.SetSQLTransform(func(name, sql string) (string, error) {
+		return strings.ReplaceAll(sql, "{{.Schema}}", "tenant"), nil
+	})
+
+	mig := &mockMigrationPostgresDriver{
+		name: "migration1",
+		up:   "CREATE TABLE {{.Schema}}.test (id INT);",
+		down: "DROP TABLE {{.Schema}}.test;",
+	}
+
+	mock.ExpectExec(`CREATE TABLE tenant\.test \(id INT\);`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("", "migration1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`DROP TABLE tenant\.test;`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM migrations WHERE namespace = \$1 AND name = \$2`).WithArgs("", "migration1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	assert.NoError(t, driver.ApplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil))
+	assert.NoError(t, driver.UnapplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExecuteMigrationSQLTransformErrorPostgresDriver(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+
+	driver.SetSQLTransform(func(name, sql string) (string, error) {
+		return "", errors.New("unknown placeholder")
+	})
+
+	err := driver.executeMigrationSQL(context.Background(), db, "migration_name", "SOME SQL STATEMENT")
+	assert.ErrorContains(t, err, "unknown placeholder")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestInsertExecutedMigrationPostgresDriver(t *testing.T) {
 	db, mock, driver := setupMockDBPostgres(t)
 	defer db.Close()
 
-	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("migration_name", sqlmock.AnyArg()).
+	mock.ExpectExec(`INSERT INTO migrations \(namespace, name, executed_at\) VALUES \(\$1, \$2, \$3\) ON CONFLICT DO NOTHING`).
+		WithArgs("", "migration_name", sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err := driver.insertExecutedMigration(context.Background(), "migration_name", time.Now())
+	err := driver.insertExecutedMigration(context.Background(), db, "migration_name", time.Now())
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -160,12 +541,105 @@ func TestRemoveExecutedMigrationPostgresDriver(t *testing.T) {
 	db, mock, driver := setupMockDBPostgres(t)
 	defer db.Close()
 
-	mock.ExpectExec(`DELETE FROM migrations WHERE name = \$1`).WithArgs("migration_name").
+	mock.ExpectExec(`DELETE FROM migrations WHERE namespace = \$1 AND name = \$2`).WithArgs("", "migration_name").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err := driver.removeExecutedMigration(context.Background(), "migration_name")
+	err := driver.removeExecutedMigration(context.Background(), db, "migration_name")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRenameExecutedMigrationPostgresDriver(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+	driver.SetNamespace("tenant_a")
+
+	mock.ExpectExec(`UPDATE migrations SET name = \$1 WHERE namespace = \$2 AND name = \$3`).
+		WithArgs("new_name", "tenant_a", "old_name").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := driver.RenameExecutedMigration(context.Background(), "old_name", "new_name")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestValidateSQLPostgresDriver(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("DO $qafoia_validate$ BEGIN RETURN;\nDROP TABLE users;\nEND $qafoia_validate$")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DO $qafoia_validate$ BEGIN RETURN;\nDROP TABEL users;\nEND $qafoia_validate$")).
+		WillReturnError(errors.New(`syntax error at or near "TABEL"`))
+
+	err := driver.ValidateSQL(context.Background(), "migration1", "DROP TABLE users")
+	assert.NoError(t, err)
+
+	err = driver.ValidateSQL(context.Background(), "migration1", "DROP TABEL users;")
+	var sqlErr *MigrationSQLError
+	assert.ErrorAs(t, err, &sqlErr)
+	assert.Equal(t, "DROP TABEL users;", sqlErr.SQL)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+type databaseMigrationPostgresDriver struct {
+	mockMigrationPostgresDriver
+}
+
+func (m *databaseMigrationPostgresDriver) Database() string { return "analytics" }
+
+func TestApplyMigrationsOtherDatabasePostgresDriver(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+
+	mig := &databaseMigrationPostgresDriver{mockMigrationPostgresDriver{name: "migration1", up: "CREATE TABLE events (id INT);"}}
+
+	err := driver.ApplyMigrations(context.Background(), []Migration{mig}, nil, nil, nil)
+	assert.ErrorIs(t, err, ErrDatabaseNotSupported)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetExecutedMigrationsReadReplicaPostgresDriver(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+
+	replica, replicaMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer replica.Close()
+	driver.replica = replica
+
+	executedAt := time.Now()
+	replicaMock.ExpectQuery("SELECT name, executed_at FROM migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "executed_at"}).AddRow("from_replica", executedAt))
+	mock.ExpectQuery("SELECT name, executed_at FROM migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "executed_at"}).AddRow("from_primary", executedAt))
+
+	migrations, err := driver.GetExecutedMigrationsFromReplica(context.Background())
 	assert.NoError(t, err)
+	assert.Equal(t, "from_replica", migrations[0].Name)
+
+	migrations, err = driver.GetExecutedMigrations(context.Background(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, "from_primary", migrations[0].Name)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.NoError(t, replicaMock.ExpectationsWereMet())
+}
+
+func TestCloseReadReplicaFailsPostgresDriver(t *testing.T) {
+	_, mock, driver := setupMockDBPostgres(t)
+
+	replica, replicaMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	driver.replica = replica
+
+	replicaMock.ExpectClose().WillReturnError(errors.New("replica gone"))
+	mock.ExpectClose()
+
+	err = driver.Close()
+	assert.ErrorContains(t, err, "replica gone")
 	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.NoError(t, replicaMock.ExpectationsWereMet())
 }
 
 // --- Supporting mock types ---
@@ -179,3 +653,111 @@ type mockMigrationPostgresDriver struct {
 func (m *mockMigrationPostgresDriver) Name() string       { return m.name }
 func (m *mockMigrationPostgresDriver) UpScript() string   { return m.up }
 func (m *mockMigrationPostgresDriver) DownScript() string { return m.down }
+
+type mockConditionalMigrationPostgresDriver struct {
+	mockMigrationPostgresDriver
+	shouldRun bool
+}
+
+func (m *mockConditionalMigrationPostgresDriver) ShouldRun(ctx context.Context, db *sql.DB) (bool, error) {
+	return m.shouldRun, nil
+}
+
+type mockGroupedMigrationPostgresDriver struct {
+	mockMigrationPostgresDriver
+	group string
+}
+
+func (m *mockGroupedMigrationPostgresDriver) TransactionGroup() string {
+	return m.group
+}
+
+type mockParameterizedMigrationPostgresDriver struct {
+	mockMigrationPostgresDriver
+	upArgs   []any
+	downArgs []any
+}
+
+func (m *mockParameterizedMigrationPostgresDriver) UpArgs() []any   { return m.upArgs }
+func (m *mockParameterizedMigrationPostgresDriver) DownArgs() []any { return m.downArgs }
+
+type mockCopyMigrationPostgresDriver struct {
+	mockMigrationPostgresDriver
+	table   string
+	columns []string
+	rows    [][]any
+}
+
+func (m *mockCopyMigrationPostgresDriver) CopyData() (string, []string, [][]any) {
+	return m.table, m.columns, m.rows
+}
+
+func TestPostgresServerDSN(t *testing.T) {
+	tests := []struct {
+		dsn       string
+		serverDSN string
+		database  string
+	}{
+		{"host=localhost dbname=qafoia sslmode=disable", "host=localhost dbname=postgres sslmode=disable", "qafoia"},
+		{`host=localhost dbname='my \'db\''`, "host=localhost dbname=postgres", "my 'db'"},
+		{"host=localhost user=root", "host=localhost user=root", ""},
+		{"postgres://root@localhost:5432/qafoia?sslmode=disable", "dbname=postgres host='localhost' port='5432' sslmode='disable' user='root'", "qafoia"},
+	}
+
+	for _, tt := range tests {
+		serverDSN, database, err := postgresServerDSN(tt.dsn)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.serverDSN, serverDSN, tt.dsn)
+		assert.Equal(t, tt.database, database, tt.dsn)
+	}
+}
+
+func TestCreateDatabaseIfMissingPostgresDriver(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT 1 FROM pg_database WHERE datname = $1")).
+		WithArgs("qafoia").
+		WillReturnRows(sqlmock.NewRows([]string{"?column?"}))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE DATABASE "qafoia"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT 1 FROM pg_database WHERE datname = $1")).
+		WithArgs("qafoia").
+		WillReturnRows(sqlmock.NewRows([]string{"?column?"}).AddRow(1))
+
+	for range 2 {
+		err = createDatabaseIfMissing(context.Background(), db, "qafoia",
+			"SELECT 1 FROM pg_database WHERE datname = $1", `CREATE DATABASE "qafoia"`)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAcquireLockPostgresDriver(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+	driver.SetNamespace("billing")
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_try_advisory_lock(hashtext($1))")).
+		WithArgs("qafoia:migrations:billing").
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(false))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_try_advisory_lock(hashtext($1))")).
+		WithArgs("qafoia:migrations:billing").
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(true))
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_unlock(hashtext($1))")).
+		WithArgs("qafoia:migrations:billing").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	release, err := driver.AcquireLock(context.Background(), time.Second)
+	assert.NoError(t, err)
+	assert.NoError(t, release())
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_try_advisory_lock(hashtext($1))")).
+		WithArgs("qafoia:migrations:billing").
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(false))
+
+	_, err = driver.AcquireLock(context.Background(), 0)
+	assert.ErrorIs(t, err, ErrMigrationLocked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
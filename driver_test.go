@@ -0,0 +1,85 @@
+package qafoia
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPingDatabase_RetriesUntilReachable(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	mock.ExpectPing()
+
+	err = pingDatabase(db, 5*time.Second)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPingDatabase_NoTimeoutPingsOnce(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	err = pingDatabase(db, 0)
+	assert.EqualError(t, err, "connection refused")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNewDriverOptions(t *testing.T) {
+	options := newDriverOptions([]DriverOption{WaitForDB(30 * time.Second)})
+	assert.Equal(t, 30*time.Second, options.waitForDB)
+}
+
+func TestOpenDatabase_SessionSetup(t *testing.T) {
+	mockDB, mock, err := sqlmock.NewWithDSN("session_setup_test")
+	assert.NoError(t, err)
+	defer mockDB.Close()
+
+	mock.ExpectExec("SET ROLE app_owner").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SET search_path TO app").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE users").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	options := newDriverOptions([]DriverOption{SessionSetup("SET ROLE app_owner", "SET search_path TO app")})
+	db, err := openDatabase("sqlmock", "session_setup_test", options)
+	assert.NoError(t, err)
+
+	_, err = db.Exec("CREATE TABLE users (id INT)")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSleepContext(t *testing.T) {
+	assert.NoError(t, sleepContext(context.Background(), 0))
+	assert.NoError(t, sleepContext(context.Background(), time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, sleepContext(ctx, time.Hour), context.Canceled)
+}
+
+func TestSelectCleanTables(t *testing.T) {
+	tables := []string{"myapp_users", "otherapp_users", "migrations"}
+
+	selected, clearRecords := selectCleanTables(tables, "", "migrations")
+	assert.Equal(t, tables, selected)
+	assert.False(t, clearRecords)
+
+	selected, clearRecords = selectCleanTables(tables, "myapp_", "migrations")
+	assert.Equal(t, []string{"myapp_users"}, selected)
+	assert.True(t, clearRecords)
+
+	selected, clearRecords = selectCleanTables([]string{"myapp_users", "myapp_migrations"}, "myapp_", "myapp_migrations")
+	assert.Equal(t, []string{"myapp_users", "myapp_migrations"}, selected)
+	assert.False(t, clearRecords)
+}
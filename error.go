@@ -1,16 +1,86 @@
 package qafoia
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrConfigNotProvided          = errors.New("config not provided")
 	ErrDriverNotProvided          = errors.New("driver not provided")
 	ErrMigrationDirNotProvided    = errors.New("migration directory not provided")
 	ErrMigrationDirNotExists      = errors.New("migration directory does not exist")
+	ErrMigrationDirNotDirectory   = errors.New("migration directory path is not a directory")
 	ErrMigrationNameNotProvided   = errors.New("migration name not provided")
 	ErrMigrationFileAlreadyExists = errors.New("migration file already exists")
 	ErrMigrationFileNotFound      = errors.New("migration file not found")
 	ErrInvalidRollbackStep        = errors.New("invalid rollback step")
+	ErrInvalidMigrateStep         = errors.New("invalid migrate step")
+	ErrInvalidRollbackPattern     = errors.New("invalid rollback pattern")
 	ErrEmbeddedFSNotProvided      = errors.New("embedded fs not provided")
 	ErrQafoiaNotProvided          = errors.New("qafoia instance not provided")
+	ErrMigrationNotRegistered     = errors.New("migration not registered")
+	ErrMigrationNotExecuted       = errors.New("migration not executed")
+	ErrDiffNotSupported           = errors.New("driver does not support schema diff migrations")
+	ErrSnapshotNotSupported       = errors.New("driver does not support schema snapshots")
+	ErrMigrationNotReversible     = errors.New("migration is not reversible")
+	ErrMigrationInProgress        = errors.New("migration was started but not finished")
+	ErrDestructiveMigration       = errors.New("destructive migration not acknowledged")
+	ErrEmptyMigration             = errors.New("migration has an empty up script")
+	ErrNoShards                   = errors.New("no shards provided")
+	ErrUnknownDriver              = errors.New("unknown driver")
+	ErrRecordingNotSupported      = errors.New("driver does not support recording migrations without running them")
+	ErrRenameNotSupported         = errors.New("driver does not support renaming recorded migrations")
+	ErrMigrationAlreadyExecuted   = errors.New("migration already executed")
+	ErrOrphanedMigrations         = errors.New("executed migrations are not registered")
+	ErrMigrationJobRunning        = errors.New("a migration job is already running")
+	ErrMigrationJobNotFound       = errors.New("migration job not found")
+	ErrDatabaseNotSupported       = errors.New("driver does not support running migrations on another database")
+	ErrValidationNotSupported     = errors.New("driver does not support validating SQL without running it")
+	ErrPreflightFailed            = errors.New("preflight check failed")
+	ErrMigrationLocked            = errors.New("migration lock held by another process")
+	ErrInvalidMigrationSuffix     = errors.New("invalid migration file suffix")
+	ErrVersionsNotSupported       = errors.New("driver does not support migration versions")
+	ErrTransactionNotSupported    = errors.New("driver does not support creating the migration table in a transaction")
+	ErrInvalidMigrationTable      = errors.New("migration table has unexpected schema")
+	ErrInvalidBatchSize           = errors.New("batch size must be greater than 0")
+	ErrNotSharded                 = errors.New("driver is not sharded")
+	ErrInvalidDirective           = errors.New("invalid migration directive")
+	ErrDriverSettingsNotSupported = errors.New("driver does not support the optional driver settings of Config")
+	ErrExecuteSQLNotSupported     = errors.New("driver does not support running SQL scripts outside migrations")
+	ErrMigrationNotTransactional  = errors.New("runnable and conditional migrations cannot be applied inside a transaction")
+	ErrLockingNotSupported        = errors.New("driver does not support migration locks")
 )
+
+// maxErrorSQLLength is the maximum number of bytes of SQL included in a MigrationSQLError message.
+const maxErrorSQLLength = 2000
+
+// MigrationSQLError is returned when a migration script fails to execute.
+// It carries the offending SQL so a failure can be diagnosed without enabling DebugSql.
+type MigrationSQLError struct {
+	Migration string
+	SQL       string
+	Err       error
+}
+
+func (e *MigrationSQLError) Error() string {
+	return fmt.Sprintf("%v; failing SQL: %s", e.Err, truncateString(e.SQL, maxErrorSQLLength))
+}
+
+func (e *MigrationSQLError) Unwrap() error {
+	return e.Err
+}
+
+// ShardError is returned by a MultiDriver for each shard an operation failed on.
+type ShardError struct {
+	Shard string
+	Err   error
+}
+
+func (e *ShardError) Error() string {
+	return fmt.Sprintf("shard %s: %v", e.Shard, e.Err)
+}
+
+func (e *ShardError) Unwrap() error {
+	return e.Err
+}
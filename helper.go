@@ -1,12 +1,16 @@
 package qafoia
 
 import (
+	"bufio"
 	"fmt"
 	"go/format"
+	"go/token"
+	"io"
 	"os"
 	"regexp"
 	"sort"
 	"strings"
+	"unicode"
 
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
@@ -20,14 +24,29 @@ func fileExists(fileName string) bool {
 
 // migrationDirExists checks if a directory for migration files exists.
 func migrationDirExists(migrationFilesDir string) bool {
-	_, err := os.Stat(migrationFilesDir)
-	return !os.IsNotExist(err)
+	return checkMigrationDir(migrationFilesDir) == nil
 }
 
-// printTable prints a 2D slice of strings as a formatted table.
-func printTable(data [][]string) {
+// checkMigrationDir returns ErrMigrationDirNotExists if the migration directory does not
+// exist, or ErrMigrationDirNotDirectory if the path exists but is not a directory.
+func checkMigrationDir(migrationFilesDir string) error {
+	info, err := os.Stat(migrationFilesDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %q", ErrMigrationDirNotExists, migrationFilesDir)
+		}
+		return fmt.Errorf("failed to access migration directory %q: %w", migrationFilesDir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%w: %q", ErrMigrationDirNotDirectory, migrationFilesDir)
+	}
+	return nil
+}
+
+// printTable writes a 2D slice of strings to w as a formatted table.
+func printTable(w io.Writer, data [][]string) {
 	if len(data) == 0 {
-		fmt.Println("No data to display.")
+		fmt.Fprintln(w, "No data to display.")
 		return
 	}
 
@@ -41,20 +60,20 @@ func printTable(data [][]string) {
 	}
 
 	printRow := func(row []string) {
-		fmt.Print("|")
+		fmt.Fprint(w, "|")
 		for i, col := range row {
 			format := fmt.Sprintf(" %%-%ds |", colWidths[i])
-			fmt.Printf(format, col)
+			fmt.Fprintf(w, format, col)
 		}
-		fmt.Println()
+		fmt.Fprintln(w)
 	}
 
 	printSeparator := func() {
-		fmt.Print("+")
+		fmt.Fprint(w, "+")
 		for _, width := range colWidths {
-			fmt.Print(strings.Repeat("-", width+2) + "+")
+			fmt.Fprint(w, strings.Repeat("-", width+2)+"+")
 		}
-		fmt.Println()
+		fmt.Fprintln(w)
 	}
 
 	printSeparator()
@@ -67,6 +86,14 @@ func printTable(data [][]string) {
 	printSeparator()
 }
 
+// truncateString shortens s to at most maxLength bytes, noting how much was cut off.
+func truncateString(s string, maxLength int) string {
+	if len(s) <= maxLength {
+		return s
+	}
+	return fmt.Sprintf("%s... (truncated, %d bytes total)", strings.ToValidUTF8(s[:maxLength], ""), len(s))
+}
+
 // sanitizeMigrationName transforms a migration name into a standardized format
 // and validates it. Returns an error if the name contains invalid characters.
 func sanitizeMigrationName(name string) (string, error) {
@@ -87,6 +114,12 @@ func sanitizeMigrationName(name string) (string, error) {
 	return name, nil
 }
 
+// isValidMigrationName reports whether a migration name only contains letters, digits and underscores.
+func isValidMigrationName(name string) bool {
+	valid := regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+	return valid.MatchString(name)
+}
+
 // sanitizeTableName validates the table name. Returns an error if it contains
 // invalid characters.
 func sanitizeTableName(name string) (string, error) {
@@ -118,6 +151,29 @@ func migrationNameToStructName(migrationName string) (string, error) {
 	return structName, nil
 }
 
+// migrationTimestampLayout is the time layout of the timestamp prefix of migration names.
+const migrationTimestampLayout = "20060102150405"
+
+// migrationTimestamp returns the 14-digit timestamp prefix of a migration name.
+// The second return value is false if the name has no timestamp prefix.
+func migrationTimestamp(migrationName string) (string, bool) {
+	re := regexp.MustCompile(`^(\d{14})_`)
+	matches := re.FindStringSubmatch(migrationName)
+	if len(matches) == 0 {
+		return "", false
+	}
+	return matches[1], true
+}
+
+// transactionGroup returns the transaction group of a migration, or an empty string
+// if the migration does not implement GroupedMigration.
+func transactionGroup(migration Migration) string {
+	if grouped, ok := migration.(GroupedMigration); ok {
+		return grouped.TransactionGroup()
+	}
+	return ""
+}
+
 // getPackageNameFromMigrationDir returns the last segment of the migrationFilesDir,
 // which is used as the package name.
 func getPackageNameFromMigrationDir(migrationFilesDir string) string {
@@ -130,11 +186,19 @@ func getPackageNameFromMigrationDir(migrationFilesDir string) string {
 
 // migrationFileTemplate generates a Go file template for a new migration
 // using the specified package and migration name. It returns formatted Go source code.
-func migrationFileTemplate(packageName string, migrationName string) (string, error) {
-	structName, err := migrationNameToStructName(migrationName)
+// If structNamer is nil, migrationNameToStructName is used to derive the struct name.
+func migrationFileTemplate(packageName string, migrationName string, structNamer func(string) (string, error)) (string, error) {
+	if structNamer == nil {
+		structNamer = migrationNameToStructName
+	}
+
+	structName, err := structNamer(migrationName)
 	if err != nil {
 		return "", err
 	}
+	if !token.IsIdentifier(structName) {
+		return "", fmt.Errorf("invalid struct name %q: not a valid Go identifier", structName)
+	}
 
 	migrationTemplate := fmt.Sprintf(`
 		package %s
@@ -173,13 +237,262 @@ func migrationFileTemplate(packageName string, migrationName string) (string, er
 }
 
 // getSortedMigrationName returns a sorted list of migration names
-// from a map of migration structs.
-func getSortedMigrationName(migrations map[string]Migration) []string {
+// from a map of migration structs. If less is nil, names are sorted lexicographically.
+func getSortedMigrationName(migrations map[string]Migration, less func(a, b string) bool) []string {
 	keys := []string{}
 	for k := range migrations {
 		keys = append(keys, k)
 	}
 
-	sort.Strings(keys)
+	if less == nil {
+		sort.Strings(keys)
+		return keys
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		return less(keys[i], keys[j])
+	})
 	return keys
 }
+
+// defaultDestructivePatterns are the patterns SafeMode uses when none are configured.
+var defaultDestructivePatterns = []string{
+	`\bDROP\s+TABLE\b`,
+	`\bDROP\s+DATABASE\b`,
+	`\bTRUNCATE\b`,
+}
+
+// compileDestructivePatterns compiles the patterns as case-insensitive regular expressions,
+// falling back to the default patterns if none are given.
+func compileDestructivePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	if len(patterns) == 0 {
+		patterns = defaultDestructivePatterns
+	}
+
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid destructive pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// sqlDialect describes the lexical rules splitSQLStatements needs to find where statements end.
+type sqlDialect struct {
+	// backslashEscapes makes a backslash escape the next character in quoted strings, as in MySQL.
+	backslashEscapes bool
+	// dollarQuotes enables Postgres dollar-quoted strings, such as function bodies in $$ ... $$.
+	dollarQuotes bool
+	// escapeStrings makes a backslash escape the next character in Postgres escape strings,
+	// which are prefixed with E, as in E'it\'s'.
+	escapeStrings bool
+	// compoundStatements keeps MySQL compound statements, such as the BEGIN ... END body of a
+	// trigger or procedure, in one statement despite the semicolons inside them.
+	compoundStatements bool
+}
+
+// mysqlDialect is the sqlDialect of MySQL scripts.
+var mysqlDialect = sqlDialect{backslashEscapes: true, compoundStatements: true}
+
+// splitSQLStatements reads SQL from r and calls fn with each statement, without its
+// terminating semicolon, as soon as it has been read, so only one statement is held in memory
+// at a time. Semicolons in quotes, comments, dollar-quoted strings and compound statements do
+// not end a statement. Statements made only of comments and whitespace are skipped.
+func splitSQLStatements(r io.Reader, dialect sqlDialect, fn func(statement string) error) error {
+	br := bufio.NewReader(r)
+
+	var stmt strings.Builder
+	var hasCode, lineComment, blockComment bool
+	var quote rune
+	var escapeString bool
+	var dollarTag string
+	var dollarStart int
+	var word strings.Builder
+	var blocks compoundBlocks
+
+	emit := func() error {
+		statement := strings.TrimSpace(stmt.String())
+		code := hasCode
+		stmt.Reset()
+		hasCode = false
+		word.Reset()
+		blocks = compoundBlocks{}
+		if !code {
+			return nil
+		}
+		return fn(statement)
+	}
+
+	for {
+		c, _, err := br.ReadRune()
+		if err == io.EOF {
+			return emit()
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case lineComment:
+			stmt.WriteRune(c)
+			lineComment = c != '\n'
+			continue
+		case blockComment:
+			stmt.WriteRune(c)
+			if next, _ := br.Peek(1); c == '*' && len(next) == 1 && next[0] == '/' {
+				br.ReadByte()
+				stmt.WriteByte('/')
+				blockComment = false
+			}
+			continue
+		case dollarTag != "":
+			stmt.WriteRune(c)
+			if stmt.Len()-dollarStart >= len(dollarTag) && strings.HasSuffix(stmt.String(), dollarTag) {
+				dollarTag = ""
+			}
+			continue
+		case quote != 0:
+			stmt.WriteRune(c)
+			if c == '\\' && (dialect.backslashEscapes || escapeString) {
+				if next, _, err := br.ReadRune(); err == nil {
+					stmt.WriteRune(next)
+				}
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		if dialect.compoundStatements {
+			if c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c) {
+				word.WriteRune(c)
+			} else if word.Len() > 0 {
+				blocks.word(word.String())
+				word.Reset()
+			}
+		}
+
+		next, _ := br.Peek(1)
+		switch {
+		case c == ';' && blocks.depth > 0:
+			blocks.afterEnd = false
+		case c == ';':
+			if err := emit(); err != nil {
+				return err
+			}
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			escapeString = c == '\'' && dialect.escapeStrings && hasEscapePrefix(stmt.String())
+		case c == '-' && len(next) == 1 && next[0] == '-':
+			lineComment = true
+			stmt.WriteRune(c)
+			continue
+		case c == '/' && len(next) == 1 && next[0] == '*':
+			br.ReadByte()
+			stmt.WriteString("/*")
+			blockComment = true
+			continue
+		case c == '$' && dialect.dollarQuotes:
+			if tag, ok := peekDollarTag(br); ok {
+				br.Discard(len(tag) + 1)
+				dollarTag = "$" + tag + "$"
+				stmt.WriteString(dollarTag)
+				dollarStart = stmt.Len()
+				hasCode = true
+				continue
+			}
+		}
+
+		stmt.WriteRune(c)
+		if !unicode.IsSpace(c) {
+			hasCode = true
+		}
+	}
+}
+
+// compoundBlocks tracks the nesting of the MySQL compound statements in a statement from its
+// words. BEGIN opens a block in the body of a stored routine, trigger or event, and CASE
+// opens one inside a block, as a CASE expression also ends with END. END closes the
+// innermost block, except END IF, END LOOP, END WHILE and END REPEAT, whose openers are not
+// counted.
+type compoundBlocks struct {
+	depth    int
+	words    int
+	create   bool
+	routine  bool
+	afterEnd bool
+}
+
+// word records the next word of the statement.
+func (b *compoundBlocks) word(w string) {
+	w = strings.ToUpper(w)
+	b.words++
+	switch {
+	case b.words == 1:
+		b.create = w == "CREATE"
+	case b.create && !b.routine:
+		b.routine = w == "PROCEDURE" || w == "FUNCTION" || w == "TRIGGER" || w == "EVENT"
+	}
+
+	if b.afterEnd {
+		b.afterEnd = false
+		switch w {
+		case "IF", "LOOP", "WHILE", "REPEAT":
+			b.depth++
+			return
+		case "CASE":
+			return
+		}
+	}
+
+	switch w {
+	case "BEGIN":
+		if b.routine || b.depth > 0 {
+			b.depth++
+		}
+	case "CASE":
+		if b.depth > 0 {
+			b.depth++
+		}
+	case "END":
+		if b.depth > 0 {
+			b.depth--
+			b.afterEnd = true
+		}
+	}
+}
+
+// hasEscapePrefix reports whether the SQL read so far ends with the E that prefixes a Postgres
+// escape string, rather than with an identifier or keyword ending in e.
+func hasEscapePrefix(sql string) bool {
+	n := len(sql)
+	if n == 0 || sql[n-1] != 'E' && sql[n-1] != 'e' {
+		return false
+	}
+	if n == 1 {
+		return true
+	}
+	b := sql[n-2]
+	return !(b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9')
+}
+
+// peekDollarTag returns the tag of a dollar quote whose opening $ has just been read, such as
+// "body" for $body$ or "" for $$, without consuming it. The second return value is false if
+// the $ does not open a dollar quote, as in the $1 placeholder.
+func peekDollarTag(br *bufio.Reader) (string, bool) {
+	ahead, _ := br.Peek(64)
+	for i, b := range ahead {
+		switch {
+		case b == '$':
+			return string(ahead[:i]), true
+		case b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || i > 0 && b >= '0' && b <= '9':
+		default:
+			return "", false
+		}
+	}
+	return "", false
+}
@@ -1,11 +1,18 @@
 package qafoia
 
 import (
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
+func TestTruncateString(t *testing.T) {
+	assert.Equal(t, "short", truncateString("short", 10))
+	assert.Equal(t, "abcde... (truncated, 10 bytes total)", truncateString("abcdefghij", 5))
+}
+
 func TestSanitizeMigrationName(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -76,6 +83,15 @@ func TestMigrationNameToStructName(t *testing.T) {
 	}
 }
 
+func TestMigrationTimestamp(t *testing.T) {
+	timestamp, ok := migrationTimestamp("20240426123456_create_users_table")
+	assert.True(t, ok)
+	assert.Equal(t, "20240426123456", timestamp)
+
+	_, ok = migrationTimestamp("001_create_users")
+	assert.False(t, ok)
+}
+
 func TestGetPackageNameFromMigrationDir(t *testing.T) {
 	result1 := getPackageNameFromMigrationDir("migrations")
 	result2 := getPackageNameFromMigrationDir("src/custompkg")
@@ -87,7 +103,7 @@ func TestGetPackageNameFromMigrationDir(t *testing.T) {
 }
 
 func TestMigrationFileTemplate(t *testing.T) {
-	code, err := migrationFileTemplate("migrations", "20240426123456_create_users_table")
+	code, err := migrationFileTemplate("migrations", "20240426123456_create_users_table", nil)
 
 	assert.NoError(t, err)
 	assert.Contains(t, code, "package migrations")
@@ -96,6 +112,27 @@ func TestMigrationFileTemplate(t *testing.T) {
 	assert.Contains(t, code, "return \"20240426123456_create_users_table\"")
 }
 
+func TestMigrationFileTemplate_CustomStructNamer(t *testing.T) {
+	namer := func(migrationName string) (string, error) {
+		return "Migration_" + migrationName, nil
+	}
+
+	code, err := migrationFileTemplate("migrations", "20240426123456_create_users_table", namer)
+
+	assert.NoError(t, err)
+	assert.Contains(t, code, "type Migration_20240426123456_create_users_table struct")
+}
+
+func TestMigrationFileTemplate_InvalidStructName(t *testing.T) {
+	namer := func(migrationName string) (string, error) {
+		return "Migration-" + migrationName, nil
+	}
+
+	_, err := migrationFileTemplate("migrations", "20240426123456_create_users_table", namer)
+
+	assert.ErrorContains(t, err, "not a valid Go identifier")
+}
+
 func TestGetSortedMigrationName(t *testing.T) {
 	migrations := map[string]Migration{
 		"b_migration": nil,
@@ -103,8 +140,78 @@ func TestGetSortedMigrationName(t *testing.T) {
 		"c_migration": nil,
 	}
 
-	sorted := getSortedMigrationName(migrations)
+	sorted := getSortedMigrationName(migrations, nil)
 
 	assert := assert.New(t)
 	assert.Equal([]string{"a_migration", "b_migration", "c_migration"}, sorted)
 }
+
+func TestGetSortedMigrationName_CustomLess(t *testing.T) {
+	migrations := map[string]Migration{
+		"10_add_index":   nil,
+		"2_create_roles": nil,
+		"1_create_users": nil,
+	}
+
+	numericPrefix := func(name string) int {
+		n, _ := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+		return n
+	}
+
+	sorted := getSortedMigrationName(migrations, func(a, b string) bool {
+		return numericPrefix(a) < numericPrefix(b)
+	})
+
+	assert.Equal(t, []string{"1_create_users", "2_create_roles", "10_add_index"}, sorted)
+}
+
+func TestSplitSQLStatements(t *testing.T) {
+	split := func(script string, dialect sqlDialect) []string {
+		var statements []string
+		err := splitSQLStatements(strings.NewReader(script), dialect, func(statement string) error {
+			statements = append(statements, statement)
+			return nil
+		})
+		assert.NoError(t, err)
+		return statements
+	}
+
+	script := `-- seed users
+INSERT INTO users (name) VALUES ('a;b'), ("c;d"), ('it''s');
+/* block; comment */ DELETE FROM logs;
+CREATE FUNCTION f() RETURNS int AS $body$ BEGIN RETURN 1; END $body$ LANGUAGE plpgsql;
+SELECT $1;
+-- trailing comment`
+
+	assert.Equal(t, []string{
+		"-- seed users\nINSERT INTO users (name) VALUES ('a;b'), (\"c;d\"), ('it''s')",
+		"/* block; comment */ DELETE FROM logs",
+		"CREATE FUNCTION f() RETURNS int AS $body$ BEGIN RETURN 1; END $body$ LANGUAGE plpgsql",
+		"SELECT $1",
+	}, split(script, sqlDialect{dollarQuotes: true}))
+
+	assert.Equal(t, []string{
+		`INSERT INTO notes VALUES ('it\'s; fine')`,
+		"SELECT 1",
+	}, split(`INSERT INTO notes VALUES ('it\'s; fine'); SELECT 1;`, sqlDialect{backslashEscapes: true}))
+
+	trigger := `CREATE TRIGGER users_defaults BEFORE INSERT ON users FOR EACH ROW
+BEGIN
+  SET NEW.active = CASE WHEN NEW.role = 'admin' THEN 1 ELSE 0 END;
+  IF NEW.name IS NULL THEN
+    SET NEW.name = 'anonymous';
+  END IF;
+  CASE NEW.role WHEN 'guest' THEN SET NEW.score = 0; ELSE BEGIN END; END CASE;
+END`
+	assert.Equal(t, []string{
+		trigger,
+		"CREATE TABLE events (`begin` DATETIME, `end` DATETIME)",
+		"SELECT 1",
+	}, split(trigger+";\nCREATE TABLE events (`begin` DATETIME, `end` DATETIME);\nSELECT 1;", mysqlDialect))
+
+	assert.Equal(t, []string{
+		`INSERT INTO notes VALUES (E'it\'s; fine'), ('C:\'), (e'\\')`,
+		`SELECT name FROM users WHERE type='x;y'`,
+	}, split(`INSERT INTO notes VALUES (E'it\'s; fine'), ('C:\'), (e'\\'); SELECT name FROM users WHERE type='x;y';`,
+		sqlDialect{dollarQuotes: true, escapeStrings: true}))
+}
@@ -0,0 +1,182 @@
+package qafoia
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// maxFinishedJobs is the number of finished migration jobs whose status is kept for JobStatus.
+// Older ones are evicted as new jobs finish, so a long-running process does not accumulate
+// them.
+const maxFinishedJobs = 100
+
+// MigrationJobState is the state of a migration job started with MigrateAsync.
+type MigrationJobState string
+
+const (
+	MigrationJobRunning   MigrationJobState = "running"
+	MigrationJobSucceeded MigrationJobState = "succeeded"
+	MigrationJobFailed    MigrationJobState = "failed"
+)
+
+// MigrationJobStatus is a snapshot of the progress of a migration job.
+type MigrationJobStatus struct {
+	ID    string
+	State MigrationJobState
+	// Current is the name of the migration being applied, if any.
+	Current string
+	// Completed is the number of migrations applied so far, out of Total pending migrations.
+	Completed  int
+	Total      int
+	Err        error
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// migrationJob tracks a migration job. All methods are no-ops on a nil migrationJob, so the
+// migrate code can report progress whether or not it runs as a job.
+type migrationJob struct {
+	mu     sync.Mutex
+	status MigrationJobStatus
+}
+
+type migrationJobKey struct{}
+
+// withMigrationJob returns a context carrying job, to which migrate reports its progress.
+func withMigrationJob(ctx context.Context, job *migrationJob) context.Context {
+	return context.WithValue(ctx, migrationJobKey{}, job)
+}
+
+// migrationJobFromContext returns the job carried by ctx, or nil.
+func migrationJobFromContext(ctx context.Context) *migrationJob {
+	job, _ := ctx.Value(migrationJobKey{}).(*migrationJob)
+	return job
+}
+
+// setTotal records the number of migrations the job is going to apply.
+func (j *migrationJob) setTotal(total int) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.Total = total
+}
+
+// running records the migration being applied.
+func (j *migrationJob) running(name string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.Current = name
+}
+
+// succeeded records that the current migration was applied.
+func (j *migrationJob) succeeded() {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.Current = ""
+	j.status.Completed++
+}
+
+// finish records the outcome of the job.
+func (j *migrationJob) finish(err error, at time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.State = MigrationJobSucceeded
+	if err != nil {
+		j.status.State = MigrationJobFailed
+		j.status.Err = err
+	}
+	j.status.FinishedAt = at
+}
+
+// snapshot returns a copy of the job status.
+func (j *migrationJob) snapshot() MigrationJobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+// MigrateAsync starts applying the pending migrations in a background goroutine and returns
+// the ID of the job, to be polled with JobStatus. The job keeps the values of ctx but is not
+// canceled with it, so it outlives the request that started it. Only one job runs at a time
+// per Qafoia instance; starting another while one is running returns ErrMigrationJobRunning.
+func (q *Qafoia) MigrateAsync(ctx context.Context) (string, error) {
+	q.jobsMu.Lock()
+	defer q.jobsMu.Unlock()
+
+	if q.activeJob != nil {
+		return "", ErrMigrationJobRunning
+	}
+
+	id, err := randomID()
+	if err != nil {
+		return "", err
+	}
+
+	job := &migrationJob{status: MigrationJobStatus{
+		ID:        id,
+		State:     MigrationJobRunning,
+		StartedAt: clockNow(q.clock),
+	}}
+	if q.jobs == nil {
+		q.jobs = make(map[string]*migrationJob)
+	}
+	q.jobs[id] = job
+	q.activeJob = job
+
+	jobCtx := withMigrationJob(context.WithoutCancel(ctx), job)
+	go func() {
+		_, err := q.migrate(jobCtx)
+
+		q.jobsMu.Lock()
+		defer q.jobsMu.Unlock()
+		job.finish(err, clockNow(q.clock))
+		q.activeJob = nil
+		q.retireJob(id)
+	}()
+
+	return id, nil
+}
+
+// retireJob adds the finished job to the finished jobs, evicting the oldest one beyond
+// maxFinishedJobs. Jobs run one at a time, so they finish in the order they started.
+// q.jobsMu must be held.
+func (q *Qafoia) retireJob(id string) {
+	q.finishedJobs = append(q.finishedJobs, id)
+	if len(q.finishedJobs) > maxFinishedJobs {
+		delete(q.jobs, q.finishedJobs[0])
+		q.finishedJobs = q.finishedJobs[1:]
+	}
+}
+
+// JobStatus returns the status of the migration job with the given ID. The status of only
+// the most recent finished jobs is kept; older ones return ErrMigrationJobNotFound.
+func (q *Qafoia) JobStatus(jobID string) (MigrationJobStatus, error) {
+	q.jobsMu.Lock()
+	job, found := q.jobs[jobID]
+	q.jobsMu.Unlock()
+
+	if !found {
+		return MigrationJobStatus{}, ErrMigrationJobNotFound
+	}
+	return job.snapshot(), nil
+}
+
+// randomID returns a random hexadecimal ID, used for job IDs and scratch table names.
+func randomID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,133 @@
+package qafoia
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingMigration is a Go migration that runs until released.
+type blockingMigration struct {
+	mockMigrationMySqlDriver
+	release chan struct{}
+}
+
+func (m *blockingMigration) Run(ctx context.Context, db *sql.DB) error {
+	<-m.release
+	return nil
+}
+
+func (m *blockingMigration) Rollback(ctx context.Context, db *sql.DB) error {
+	return nil
+}
+
+func TestQafoia_MigrateAsync(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	orders := &blockingMigration{mockMigrationMySqlDriver{name: "002_create_orders"}, make(chan struct{})}
+	q := &Qafoia{driver: driver, migrations: map[string]Migration{
+		"001_create_users":  &mockMigrationMySqlDriver{name: "001_create_users", up: "CREATE TABLE users (id INT);"},
+		"002_create_orders": orders,
+	}}
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT name, executed_at FROM migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "executed_at"}))
+	mock.ExpectExec("CREATE TABLE users").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO migrations").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO migrations").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	id, err := q.MigrateAsync(ctx)
+	assert.NoError(t, err)
+	cancel()
+
+	assert.Eventually(t, func() bool {
+		status, err := q.JobStatus(id)
+		return err == nil && status.Current == "002_create_orders"
+	}, time.Second, time.Millisecond)
+
+	status, _ := q.JobStatus(id)
+	assert.Equal(t, MigrationJobRunning, status.State)
+	assert.Equal(t, 1, status.Completed)
+	assert.Equal(t, 2, status.Total)
+
+	_, err = q.MigrateAsync(context.Background())
+	assert.ErrorIs(t, err, ErrMigrationJobRunning)
+
+	close(orders.release)
+	assert.Eventually(t, func() bool {
+		status, _ := q.JobStatus(id)
+		return status.State != MigrationJobRunning
+	}, time.Second, time.Millisecond)
+
+	status, _ = q.JobStatus(id)
+	assert.Equal(t, MigrationJobSucceeded, status.State)
+	assert.Equal(t, 2, status.Completed)
+	assert.NoError(t, status.Err)
+	assert.False(t, status.FinishedAt.IsZero())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = q.JobStatus("unknown")
+	assert.ErrorIs(t, err, ErrMigrationJobNotFound)
+}
+
+func TestQafoia_RetireJob(t *testing.T) {
+	q := &Qafoia{jobs: make(map[string]*migrationJob)}
+	for i := range maxFinishedJobs + 1 {
+		id := fmt.Sprintf("job%d", i)
+		q.jobs[id] = &migrationJob{status: MigrationJobStatus{ID: id, State: MigrationJobSucceeded}}
+		q.retireJob(id)
+	}
+
+	assert.Len(t, q.jobs, maxFinishedJobs)
+	_, err := q.JobStatus("job0")
+	assert.ErrorIs(t, err, ErrMigrationJobNotFound)
+	status, err := q.JobStatus(fmt.Sprintf("job%d", maxFinishedJobs))
+	assert.NoError(t, err)
+	assert.Equal(t, MigrationJobSucceeded, status.State)
+}
+
+// steppingClock is a clock that advances by step on every reading.
+type steppingClock struct {
+	now  time.Time
+	step time.Duration
+}
+
+func (c *steppingClock) Now() time.Time {
+	now := c.now
+	c.now = c.now.Add(c.step)
+	return now
+}
+
+func TestQafoia_MigrateUntil(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	start := time.Date(2025, 1, 1, 22, 0, 0, 0, time.UTC)
+	q := &Qafoia{driver: driver, clock: &steppingClock{now: start, step: time.Minute}, migrations: map[string]Migration{
+		"001_create_users":  &mockMigrationMySqlDriver{name: "001_create_users", up: "CREATE TABLE users (id INT);"},
+		"002_create_orders": &mockMigrationMySqlDriver{name: "002_create_orders", up: "CREATE TABLE orders (id INT);"},
+		"003_create_items":  &mockMigrationMySqlDriver{name: "003_create_items", up: "CREATE TABLE items (id INT);"},
+	}}
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT name, executed_at FROM migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "executed_at"}))
+	mock.ExpectExec("CREATE TABLE users").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO migrations").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("CREATE TABLE orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO migrations").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// The clock reads 22:00 and 22:01 before the first two migrations, and 22:02 before the third
+	applied, err := q.MigrateUntil(context.Background(), start.Add(2*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
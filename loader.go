@@ -0,0 +1,281 @@
+package qafoia
+
+import (
+	"cmp"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	upMigrationFileSuffix   = ".up.sql"
+	downMigrationFileSuffix = ".down.sql"
+
+	// beforeMigrationFileSuffix and afterMigrationFileSuffix start the suffixes of the optional
+	// hook scripts run right before and after the up script of a migration. The extension of
+	// the up suffix follows them, as in .before.sql for .up.sql.
+	beforeMigrationFileSuffix = ".before"
+	afterMigrationFileSuffix  = ".after"
+
+	// descriptionCommentPrefix starts the optional description comment on the first line of
+	// an .up.sql file.
+	descriptionCommentPrefix = "-- description:"
+
+	// directiveCommentPrefix starts the optional directive comments at the top of an .up.sql
+	// file, such as "-- qafoia:notransaction".
+	directiveCommentPrefix = "-- qafoia:"
+)
+
+// MigrationFile is a migration loaded from a pair of .up.sql and .down.sql files.
+type MigrationFile struct {
+	Name    string
+	UpSql   []byte
+	DownSql []byte
+	// Description is taken from a "-- description: ..." comment on the first line of the
+	// .up.sql file, if there is one.
+	Description string
+	// BeforeSql and AfterSql are the optional .before.sql and .after.sql hook scripts, run
+	// right before and after the up script. They are nil when the files do not exist. With
+	// another up suffix, the hook files take its extension, as in .before.pgsql.
+	BeforeSql []byte
+	AfterSql  []byte
+	// NoTransaction, Tags and Timeout are set by the "-- qafoia:notransaction",
+	// "-- qafoia:tags a,b" and "-- qafoia:timeout 30s" directive comments at the top of the
+	// .up.sql file, and implement NonTransactionalMigration, TaggedMigration and
+	// TimeoutMigration.
+	NoTransaction bool
+	Tags          []string
+	Timeout       time.Duration
+}
+
+// fileMigration adapts a MigrationFile to the Migration interface. With inlineHooks, the
+// hook scripts are part of the up script instead of being run on their own.
+type fileMigration struct {
+	file        MigrationFile
+	inlineHooks bool
+}
+
+// FileMigration adapts a MigrationFile to the Migration interface, so migrations read with
+// LoadMigrationFiles can be registered alongside Go migrations.
+func FileMigration(mf MigrationFile) Migration {
+	return &fileMigration{file: mf}
+}
+
+// FileMigrations adapts each MigrationFile to the Migration interface, preserving order.
+func FileMigrations(files []MigrationFile) []Migration {
+	migrations := make([]Migration, 0, len(files))
+	for _, file := range files {
+		migrations = append(migrations, FileMigration(file))
+	}
+	return migrations
+}
+
+func (m *fileMigration) Name() string {
+	return m.file.Name
+}
+
+func (m *fileMigration) UpScript() string {
+	if !m.inlineHooks {
+		return string(m.file.UpSql)
+	}
+
+	var scripts []string
+	for _, script := range [][]byte{m.file.BeforeSql, m.file.UpSql, m.file.AfterSql} {
+		if len(script) > 0 {
+			scripts = append(scripts, string(script))
+		}
+	}
+	return strings.Join(scripts, "\n")
+}
+
+// beforeScript returns the .before.sql hook script, unless it is inlined in the up script.
+func (m *fileMigration) beforeScript() string {
+	if m.inlineHooks {
+		return ""
+	}
+	return string(m.file.BeforeSql)
+}
+
+// afterScript returns the .after.sql hook script, unless it is inlined in the up script.
+func (m *fileMigration) afterScript() string {
+	if m.inlineHooks {
+		return ""
+	}
+	return string(m.file.AfterSql)
+}
+
+func (m *fileMigration) DownScript() string {
+	return string(m.file.DownSql)
+}
+
+// Description returns the "-- description:" comment of the up script, implementing
+// DescribedMigration.
+func (m *fileMigration) Description() string {
+	return m.file.Description
+}
+
+// NoTransaction reports whether the up script has the "-- qafoia:notransaction" directive,
+// implementing NonTransactionalMigration.
+func (m *fileMigration) NoTransaction() bool {
+	return m.file.NoTransaction
+}
+
+// Tags returns the tags of the "-- qafoia:tags" directive, implementing TaggedMigration.
+func (m *fileMigration) Tags() []string {
+	return m.file.Tags
+}
+
+// Timeout returns the duration of the "-- qafoia:timeout" directive, or zero without one,
+// implementing TimeoutMigration.
+func (m *fileMigration) Timeout() time.Duration {
+	return m.file.Timeout
+}
+
+// LoadMigrationFiles reads all .up.sql/.down.sql pairs from dir in fsys, sorted by name.
+// Any fs.FS works, such as os.DirFS, an embed.FS, or an HTTPFS.
+func LoadMigrationFiles(fsys fs.FS, dir string) ([]MigrationFile, error) {
+	if fsys == nil {
+		return nil, ErrEmbeddedFSNotProvided
+	}
+
+	return collectMigrationFiles(fsys, dir, upMigrationFileSuffix, downMigrationFileSuffix)
+}
+
+// collectMigrationFiles reads the migration file pairs in dir. Every file must end in
+// upSuffix or downSuffix, such as .up.sql or .down.sql, or be a hook with the extension of
+// upSuffix, such as .before.sql or .after.sql, and every migration must have both an up and
+// a down file. Empty suffixes fall back to the defaults.
+func collectMigrationFiles(fsys fs.FS, dir string, upSuffix string, downSuffix string) ([]MigrationFile, error) {
+	upSuffix = cmp.Or(upSuffix, upMigrationFileSuffix)
+	downSuffix = cmp.Or(downSuffix, downMigrationFileSuffix)
+	beforeSuffix := beforeMigrationFileSuffix + path.Ext(upSuffix)
+	afterSuffix := afterMigrationFileSuffix + path.Ext(upSuffix)
+
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration directory %q: %w", dir, err)
+	}
+
+	files := make(map[string]*MigrationFile)
+	fileFor := func(name string) *MigrationFile {
+		if files[name] == nil {
+			files[name] = &MigrationFile{Name: name}
+		}
+		return files[name]
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		fileName := entry.Name()
+		// Go migrations are registered with Register, so both styles can share a directory
+		if strings.HasSuffix(fileName, ".go") {
+			continue
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, fileName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration file %q: %w", fileName, err)
+		}
+
+		// The longer suffix is matched first, so a down suffix such as .down.sql is not taken
+		// for an up suffix such as .sql
+		isUp := strings.HasSuffix(fileName, upSuffix)
+		isDown := strings.HasSuffix(fileName, downSuffix)
+		if isUp && isDown {
+			isUp = len(upSuffix) > len(downSuffix)
+			isDown = !isUp
+		}
+
+		switch {
+		case strings.HasSuffix(fileName, beforeSuffix):
+			fileFor(strings.TrimSuffix(fileName, beforeSuffix)).BeforeSql = content
+		case strings.HasSuffix(fileName, afterSuffix):
+			fileFor(strings.TrimSuffix(fileName, afterSuffix)).AfterSql = content
+		case isUp:
+			file := fileFor(strings.TrimSuffix(fileName, upSuffix))
+			file.UpSql = content
+			file.Description = parseDescriptionComment(content)
+			if err := parseDirectiveComments(file, content); err != nil {
+				return nil, fmt.Errorf("migration file %q: %w", fileName, err)
+			}
+		case isDown:
+			fileFor(strings.TrimSuffix(fileName, downSuffix)).DownSql = content
+		default:
+			return nil, fmt.Errorf("unexpected file %q in migration directory", fileName)
+		}
+	}
+
+	migrationFiles := make([]MigrationFile, 0, len(files))
+	for _, file := range files {
+		if file.UpSql == nil {
+			return nil, fmt.Errorf("migration %s is missing its %s file", file.Name, upSuffix)
+		}
+		if file.DownSql == nil {
+			return nil, fmt.Errorf("migration %s is missing its %s file", file.Name, downSuffix)
+		}
+		migrationFiles = append(migrationFiles, *file)
+	}
+
+	sort.Slice(migrationFiles, func(i, j int) bool {
+		return migrationFiles[i].Name < migrationFiles[j].Name
+	})
+
+	return migrationFiles, nil
+}
+
+// parseDescriptionComment returns the description from a "-- description: ..." comment on
+// the first line of an SQL script, or an empty string if there is none.
+func parseDescriptionComment(content []byte) string {
+	firstLine, _, _ := strings.Cut(string(content), "\n")
+	firstLine = strings.TrimSpace(firstLine)
+	if !strings.HasPrefix(firstLine, descriptionCommentPrefix) {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(firstLine, descriptionCommentPrefix))
+}
+
+// parseDirectiveComments sets the fields of file from the "-- qafoia:" directive comments
+// among the comment lines at the top of its up script. Parsing stops at the first line that
+// is neither a comment nor blank.
+func parseDirectiveComments(file *MigrationFile, content []byte) error {
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			return nil
+		}
+		if !strings.HasPrefix(line, directiveCommentPrefix) {
+			continue
+		}
+
+		directive, value, _ := strings.Cut(strings.TrimPrefix(line, directiveCommentPrefix), " ")
+		value = strings.TrimSpace(value)
+		switch directive {
+		case "notransaction":
+			file.NoTransaction = true
+		case "tags":
+			for _, tag := range strings.Split(value, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					file.Tags = append(file.Tags, tag)
+				}
+			}
+		case "timeout":
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout <= 0 {
+				return fmt.Errorf("%w: timeout %q is not a positive duration", ErrInvalidDirective, value)
+			}
+			file.Timeout = timeout
+		default:
+			return fmt.Errorf("%w: unknown directive %q", ErrInvalidDirective, directive)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package qafoia
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// HTTPFSIndexFile is the name of the file listing the entries of a directory served over
+// HTTP, one file name per line, since HTTP has no standard way to list a directory.
+const HTTPFSIndexFile = "index.txt"
+
+// HTTPFS is a read-only fs.FS backed by files served over HTTP, such as a static site or
+// a public or pre-signed S3 bucket. Directories are listed through their HTTPFSIndexFile.
+type HTTPFS struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewHTTPFS creates an HTTPFS serving files relative to baseURL. If client is nil,
+// http.DefaultClient is used.
+func NewHTTPFS(baseURL string, client *http.Client) *HTTPFS {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &HTTPFS{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  client,
+	}
+}
+
+// Open fetches the named file.
+func (h *HTTPFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	content, err := h.fetch(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &httpFile{
+		Reader: bytes.NewReader(content),
+		info:   httpFileInfo{name: path.Base(name), size: int64(len(content))},
+	}, nil
+}
+
+// ReadDir lists the named directory using its HTTPFSIndexFile.
+func (h *HTTPFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	index, err := h.fetch(path.Join(name, HTTPFSIndexFile))
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	var entries []fs.DirEntry
+	for _, line := range strings.Split(string(index), "\n") {
+		fileName := strings.TrimSpace(line)
+		if fileName == "" {
+			continue
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(httpFileInfo{name: fileName}))
+	}
+
+	return entries, nil
+}
+
+// fetch downloads the file at name relative to the base URL.
+func (h *HTTPFS) fetch(name string) ([]byte, error) {
+	resp, err := h.client.Get(h.baseURL + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fs.ErrNotExist
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// httpFile is an in-memory fs.File holding a downloaded file.
+type httpFile struct {
+	*bytes.Reader
+	info httpFileInfo
+}
+
+func (f *httpFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *httpFile) Close() error {
+	return nil
+}
+
+// httpFileInfo describes a regular file served over HTTP.
+type httpFileInfo struct {
+	name string
+	size int64
+}
+
+func (i httpFileInfo) Name() string       { return i.name }
+func (i httpFileInfo) Size() int64        { return i.size }
+func (i httpFileInfo) Mode() fs.FileMode  { return 0444 }
+func (i httpFileInfo) ModTime() time.Time { return time.Time{} }
+func (i httpFileInfo) IsDir() bool        { return false }
+func (i httpFileInfo) Sys() any           { return nil }
@@ -0,0 +1,43 @@
+package qafoia
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPFS_LoadMigrationFiles(t *testing.T) {
+	files := map[string]string{
+		"/migrations/index.txt":                            "20240426123456_create_users.up.sql\n20240426123456_create_users.down.sql\n",
+		"/migrations/20240426123456_create_users.up.sql":   "CREATE TABLE users (id INT);",
+		"/migrations/20240426123456_create_users.down.sql": "DROP TABLE users;",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	migrationFiles, err := LoadMigrationFiles(NewHTTPFS(server.URL+"/", nil), "migrations")
+
+	assert.NoError(t, err)
+	assert.Len(t, migrationFiles, 1)
+	assert.Equal(t, "20240426123456_create_users", migrationFiles[0].Name)
+	assert.Equal(t, "DROP TABLE users;", string(migrationFiles[0].DownSql))
+}
+
+func TestHTTPFS_OpenNotFound(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := NewHTTPFS(server.URL, nil).Open("missing.up.sql")
+
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
@@ -0,0 +1,274 @@
+package qafoia
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectMigrationFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/20240426123456_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT);")},
+		"migrations/20240426123456_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"migrations/20240427000000_create_roles.up.sql":   {Data: []byte("CREATE TABLE roles (id INT);")},
+		"migrations/20240427000000_create_roles.down.sql": {Data: []byte("DROP TABLE roles;")},
+	}
+
+	files, err := collectMigrationFiles(fsys, "migrations", "", "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []MigrationFile{
+		{
+			Name:    "20240426123456_create_users",
+			UpSql:   []byte("CREATE TABLE users (id INT);"),
+			DownSql: []byte("DROP TABLE users;"),
+		},
+		{
+			Name:    "20240427000000_create_roles",
+			UpSql:   []byte("CREATE TABLE roles (id INT);"),
+			DownSql: []byte("DROP TABLE roles;"),
+		},
+	}, files)
+}
+
+func TestCollectMigrationFiles_Description(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/20240426123456_create_users.up.sql":   {Data: []byte("-- description: Create the users table\nCREATE TABLE users (id INT);")},
+		"migrations/20240426123456_create_users.down.sql": {Data: []byte("-- description: ignored\nDROP TABLE users;")},
+		"migrations/20240427000000_create_roles.up.sql":   {Data: []byte("CREATE TABLE roles (id INT);\n-- description: not on the first line")},
+		"migrations/20240427000000_create_roles.down.sql": {Data: []byte("DROP TABLE roles;")},
+	}
+
+	files, err := collectMigrationFiles(fsys, "migrations", "", "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Create the users table", files[0].Description)
+	assert.Empty(t, files[1].Description)
+	assert.Equal(t, "Create the users table", FileMigration(files[0]).(DescribedMigration).Description())
+}
+
+func TestCollectMigrationFiles_Directives(t *testing.T) {
+	up := "-- description: Index users by email\n-- qafoia:notransaction\n-- qafoia:tags billing, v2\n\n-- qafoia:timeout 30s\nCREATE INDEX CONCURRENTLY users_email ON users (email);\n-- qafoia:unknown"
+	fsys := fstest.MapFS{
+		"migrations/20240426123456_index_users.up.sql":   {Data: []byte(up)},
+		"migrations/20240426123456_index_users.down.sql": {Data: []byte("DROP INDEX users_email;")},
+	}
+
+	files, err := collectMigrationFiles(fsys, "migrations", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "Index users by email", files[0].Description)
+	assert.True(t, files[0].NoTransaction)
+	assert.Equal(t, []string{"billing", "v2"}, files[0].Tags)
+	assert.Equal(t, 30*time.Second, files[0].Timeout)
+
+	migration := FileMigration(files[0])
+	assert.True(t, migration.(NonTransactionalMigration).NoTransaction())
+	assert.Equal(t, []string{"billing", "v2"}, migration.(TaggedMigration).Tags())
+	assert.Equal(t, 30*time.Second, migration.(TimeoutMigration).Timeout())
+
+	for _, directive := range []string{"-- qafoia:timeout soon", "-- qafoia:transaction"} {
+		fsys["migrations/20240426123456_index_users.up.sql"] = &fstest.MapFile{Data: []byte(directive + "\nSELECT 1;")}
+		_, err = collectMigrationFiles(fsys, "migrations", "", "")
+		assert.ErrorIs(t, err, ErrInvalidDirective)
+	}
+}
+
+func TestCollectMigrationFiles_MissingPair(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/20240426123456_create_users.up.sql": {Data: []byte("CREATE TABLE users (id INT);")},
+	}
+
+	_, err := collectMigrationFiles(fsys, "migrations", "", "")
+
+	assert.ErrorContains(t, err, "missing its .down.sql file")
+}
+
+func TestCollectMigrationFiles_IgnoresGoFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/20240101000000_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT);")},
+		"migrations/20240101000000_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"migrations/20240102000000_create_roles.go":       {Data: []byte("package migrations")},
+	}
+
+	files, err := collectMigrationFiles(fsys, "migrations", "", "")
+
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, "20240101000000_create_users", files[0].Name)
+}
+
+func TestCollectMigrationFiles_UnexpectedFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/README.md": {Data: []byte("# migrations")},
+	}
+
+	_, err := collectMigrationFiles(fsys, "migrations", "", "")
+
+	assert.ErrorContains(t, err, `unexpected file "README.md"`)
+}
+
+func TestLoadMigrationFiles_NilFS(t *testing.T) {
+	_, err := LoadMigrationFiles(nil, "migrations")
+
+	assert.Equal(t, ErrEmbeddedFSNotProvided, err)
+}
+
+func TestFileMigrations(t *testing.T) {
+	migrations := FileMigrations([]MigrationFile{
+		{Name: "001_create_users", UpSql: []byte("CREATE TABLE users (id INT);"), DownSql: []byte("DROP TABLE users;")},
+		{Name: "002_create_orders", UpSql: []byte("CREATE TABLE orders (id INT);"), DownSql: []byte("DROP TABLE orders;")},
+	})
+
+	assert.Len(t, migrations, 2)
+	assert.Equal(t, "001_create_users", migrations[0].Name())
+	assert.Equal(t, "CREATE TABLE users (id INT);", migrations[0].UpScript())
+	assert.Equal(t, "DROP TABLE users;", migrations[0].DownScript())
+	assert.Equal(t, "002_create_orders", migrations[1].Name())
+}
+
+func TestQafoia_RegisterFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/20240426123456_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT);")},
+		"sql/20240426123456_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+	}
+	q := &Qafoia{migrations: make(map[string]Migration)}
+
+	err := q.RegisterFS(fsys, "sql")
+
+	assert.NoError(t, err)
+	assert.Contains(t, q.migrations, "20240426123456_create_users")
+	assert.Equal(t, "DROP TABLE users;", q.migrations["20240426123456_create_users"].DownScript())
+}
+
+func TestQafoia_Load(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/20240426123456_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT);")},
+		"migrations/20240426123456_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+	}
+	q := &Qafoia{
+		migrations:     make(map[string]Migration),
+		migrationFS:    fsys,
+		migrationFSDir: "migrations",
+	}
+
+	assert.NoError(t, q.Load())
+	assert.Contains(t, q.migrations, "20240426123456_create_users")
+
+	// A second Load uses the cached set instead of registering the files again
+	assert.NoError(t, q.Load())
+}
+
+func TestQafoia_RollbackLoadsMigrationFS(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	fsys := fstest.MapFS{
+		"migrations/20240426123456_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT);")},
+		"migrations/20240426123456_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+	}
+	q := &Qafoia{
+		driver:         driver,
+		onMissing:      MissingMigrationRemoveRecord,
+		migrations:     make(map[string]Migration),
+		migrationFS:    fsys,
+		migrationFSDir: "migrations",
+	}
+
+	// Without loading the files first, the migration would look unregistered and only its
+	// record would be removed
+	mock.ExpectQuery("SELECT name, executed_at FROM migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "executed_at"}).AddRow("20240426123456_create_users", time.Now()))
+	mock.ExpectExec("DROP TABLE users").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM migrations").WithArgs("", "20240426123456_create_users").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, q.Rollback(context.Background(), 1))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQafoia_Load_InvalidNames(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/2024-04-26_create users.up.sql":   {Data: []byte("CREATE TABLE users (id INT);")},
+		"migrations/2024-04-26_create users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"migrations/2024-04-27_create-roles.up.sql":   {Data: []byte("CREATE TABLE roles (id INT);")},
+		"migrations/2024-04-27_create-roles.down.sql": {Data: []byte("DROP TABLE roles;")},
+	}
+	q := &Qafoia{
+		migrations:     make(map[string]Migration),
+		migrationFS:    fsys,
+		migrationFSDir: "migrations",
+	}
+
+	err := q.Load()
+
+	assert.ErrorContains(t, err, "invalid migration name: 2024-04-26_create users")
+	assert.ErrorContains(t, err, "invalid migration name: 2024-04-27_create-roles")
+	assert.Empty(t, q.migrations)
+}
+
+func TestCollectMigrationFiles_CustomSuffixes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/20240426123456_create_users.up.pgsql":   {Data: []byte("CREATE TABLE users (id INT);")},
+		"migrations/20240426123456_create_users.down.pgsql": {Data: []byte("DROP TABLE users;")},
+	}
+
+	files, err := collectMigrationFiles(fsys, "migrations", ".up.pgsql", ".down.pgsql")
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, "20240426123456_create_users", files[0].Name)
+	assert.Equal(t, "DROP TABLE users;", string(files[0].DownSql))
+
+	_, err = collectMigrationFiles(fsys, "migrations", "", "")
+	assert.ErrorContains(t, err, "unexpected file")
+
+	fsys = fstest.MapFS{
+		"migrations/20240426123456_create_users.sql":      {Data: []byte("CREATE TABLE users (id INT);")},
+		"migrations/20240426123456_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+	}
+
+	files, err = collectMigrationFiles(fsys, "migrations", ".sql", ".down.sql")
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, "CREATE TABLE users (id INT);", string(files[0].UpSql))
+}
+
+func TestCollectMigrationFiles_Hooks(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/20240426123456_backfill.up.sql":     {Data: []byte("UPDATE users SET active = true;")},
+		"migrations/20240426123456_backfill.down.sql":   {Data: []byte("UPDATE users SET active = false;")},
+		"migrations/20240426123456_backfill.before.sql": {Data: []byte("ALTER TABLE users DISABLE TRIGGER ALL;")},
+		"migrations/20240426123456_backfill.after.sql":  {Data: []byte("ALTER TABLE users ENABLE TRIGGER ALL;")},
+	}
+
+	files, err := collectMigrationFiles(fsys, "migrations", "", "")
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, "ALTER TABLE users DISABLE TRIGGER ALL;", string(files[0].BeforeSql))
+	assert.Equal(t, "ALTER TABLE users ENABLE TRIGGER ALL;", string(files[0].AfterSql))
+
+	separate := &fileMigration{file: files[0]}
+	assert.Equal(t, "UPDATE users SET active = true;", separate.UpScript())
+	assert.Equal(t, "ALTER TABLE users DISABLE TRIGGER ALL;", separate.beforeScript())
+	assert.True(t, hasHookScripts(separate))
+
+	inline := &fileMigration{file: files[0], inlineHooks: true}
+	assert.Equal(t, "ALTER TABLE users DISABLE TRIGGER ALL;\nUPDATE users SET active = true;\nALTER TABLE users ENABLE TRIGGER ALL;", inline.UpScript())
+	assert.False(t, hasHookScripts(inline))
+
+	_, err = collectMigrationFiles(fstest.MapFS{
+		"migrations/20240426123456_backfill.before.sql": {Data: []byte("SELECT 1;")},
+	}, "migrations", "", "")
+	assert.ErrorContains(t, err, "missing its .up.sql file")
+
+	files, err = collectMigrationFiles(fstest.MapFS{
+		"migrations/20240426123456_backfill.up.pgsql":     {Data: []byte("UPDATE users SET active = true;")},
+		"migrations/20240426123456_backfill.down.pgsql":   {Data: []byte("UPDATE users SET active = false;")},
+		"migrations/20240426123456_backfill.before.pgsql": {Data: []byte("ALTER TABLE users DISABLE TRIGGER ALL;")},
+	}, "migrations", ".up.pgsql", ".down.pgsql")
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, "ALTER TABLE users DISABLE TRIGGER ALL;", string(files[0].BeforeSql))
+}
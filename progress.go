@@ -0,0 +1,69 @@
+package qafoia
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const progressBarWidth = 30
+
+// progressBar renders a single-line "done/total migrations" bar for interactive terminals.
+// All methods are no-ops on a nil progressBar.
+type progressBar struct {
+	out      io.Writer
+	total    int
+	done     int
+	rendered bool
+}
+
+// newProgressBar creates a progress bar for total migrations writing to out.
+func newProgressBar(out io.Writer, total int) *progressBar {
+	return &progressBar{out: out, total: total}
+}
+
+// advance marks one more migration as done and redraws the bar.
+func (p *progressBar) advance() {
+	if p == nil {
+		return
+	}
+	p.done++
+	p.render()
+}
+
+// render redraws the bar in place.
+func (p *progressBar) render() {
+	if p == nil || p.total == 0 {
+		return
+	}
+
+	filled := min(max(progressBarWidth*p.done/p.total, 0), progressBarWidth)
+	fmt.Fprintf(
+		p.out,
+		"\r[%s%s] %d/%d migrations",
+		strings.Repeat("=", filled),
+		strings.Repeat(" ", progressBarWidth-filled),
+		p.done,
+		p.total,
+	)
+	p.rendered = true
+}
+
+// finish ends the bar line so that later output starts on a new line.
+func (p *progressBar) finish() {
+	if p == nil || !p.rendered {
+		return
+	}
+	fmt.Fprintln(p.out)
+	p.rendered = false
+}
+
+// isTerminal reports whether f is connected to an interactive terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
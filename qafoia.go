@@ -5,20 +5,83 @@ package qafoia
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
+// Migrator is the set of core migration operations of Qafoia. Code that runs migrations can
+// depend on it instead of *Qafoia so a fake can be injected in its tests.
+type Migrator interface {
+	Register(migrations ...Migration) error
+	Create(fileName string) error
+	Migrate(ctx context.Context) error
+	Rollback(ctx context.Context, step int) error
+	Fresh(ctx context.Context) error
+	Reset(ctx context.Context) error
+	Clean(ctx context.Context) error
+	List(ctx context.Context) (RegisteredMigrationList, error)
+}
+
+var _ Migrator = (*Qafoia)(nil)
+
 // Qafoia is the main struct for managing and executing database migrations.
 type Qafoia struct {
-	driver            Driver
-	migrationFilesDir string
-	debugSql          bool
-	migrations        map[string]Migration
-	mu                sync.Mutex
+	driver             Driver
+	migrationFilesDir  string
+	debugSql           bool
+	sortFunc           func(a, b string) bool
+	preMigrateSQL      []string
+	postMigrateSQL     []string
+	structNamer        func(migrationName string) (string, error)
+	skipCreateTable    bool
+	strictReversible   bool
+	baseline           string
+	migrationFS        fs.FS
+	migrationFSDir     string
+	upSuffix           string
+	downSuffix         string
+	hooksInTransaction bool
+	sqlTransform       SQLTransformFunc
+	progressOut        io.Writer
+	tracer             Tracer
+	fromStored         bool
+	safeMode           bool
+	destructive        []*regexp.Regexp
+	clock              Clock
+	environment        string
+	failOnOrphans      bool
+	requireReversible  bool
+	disallowEmptyUp    bool
+	onMissing          MissingMigrationAction
+	quiet              bool
+	audit              *auditLog
+	rollbackOnFailure  bool
+	lockTimeout        time.Duration
+	twoPhaseRecording  bool
+	preserveOrder      bool
+	registrationOrder  []string
+	loaded             bool
+	loadMu             sync.Mutex
+	migrations         map[string]Migration
+	mu                 sync.Mutex
+	jobs               map[string]*migrationJob
+	finishedJobs       []string
+	activeJob          *migrationJob
+	jobsMu             sync.Mutex
 }
 
 // New creates a new instance of Qafoia using the provided configuration.
@@ -38,27 +101,103 @@ func New(config *Config) (*Qafoia, error) {
 	if config.MigrationTableName == "" {
 		config.MigrationTableName = "migrations"
 	}
+	if config.MigrationFSDir == "" {
+		config.MigrationFSDir = config.MigrationFilesDir
+	}
+
+	if config.UpSuffix == "" {
+		config.UpSuffix = upMigrationFileSuffix
+	}
+	if config.DownSuffix == "" {
+		config.DownSuffix = downMigrationFileSuffix
+	}
+	if config.UpSuffix == config.DownSuffix {
+		return nil, fmt.Errorf("%w: up and down suffixes are both %s", ErrInvalidMigrationSuffix, config.UpSuffix)
+	}
 
 	if _, err := sanitizeTableName(config.MigrationTableName); err != nil {
 		return nil, fmt.Errorf("invalid migration table name: %w", err)
 	}
 
-	if !migrationDirExists(config.MigrationFilesDir) {
-		return nil, fmt.Errorf("migration directory %q does not exist", config.MigrationFilesDir)
+	if err := checkMigrationDir(config.MigrationFilesDir); err != nil {
+		return nil, err
+	}
+
+	var destructive []*regexp.Regexp
+	if config.SafeMode {
+		var err error
+		destructive, err = compileDestructivePatterns(config.DestructivePatterns)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	config.Driver.SetMigrationTableName(config.MigrationTableName)
+	// Configure a copy of the driver when possible, so several Qafoia instances can share
+	// one driver with different migration tables, such as one per module
+	driver := config.Driver
+	if cloner, ok := driver.(DriverCloner); ok {
+		driver = cloner.Clone()
+	}
+
+	driver.SetMigrationTableName(config.MigrationTableName)
+	if configurer, ok := driver.(DriverConfigurer); ok {
+		configurer.SetNamespace(config.Namespace)
+		configurer.SetTwoPhaseRecording(config.TwoPhaseRecording)
+		configurer.SetDelayBetweenMigrations(config.DelayBetweenMigrations)
+		configurer.SetSQLTransform(config.SQLTransform)
+		configurer.SetStoreDownSQL(config.RollbackFromStored)
+		configurer.SetClock(config.Clock)
+		configurer.SetRecordMigration(config.RecordMigration)
+		configurer.SetRemoveMigration(config.RemoveMigration)
+		configurer.SetRecordDurations(config.RecordDurations)
+		configurer.SetCleanPrefix(config.CleanPrefix)
+	} else if config.Namespace != "" || config.TwoPhaseRecording || config.DelayBetweenMigrations != 0 ||
+		config.SQLTransform != nil || config.RollbackFromStored || config.Clock != nil ||
+		config.RecordMigration != nil || config.RemoveMigration != nil || config.RecordDurations ||
+		config.CleanPrefix != "" {
+		return nil, ErrDriverSettingsNotSupported
+	}
 
 	return &Qafoia{
-		driver:            config.Driver,
-		migrationFilesDir: config.MigrationFilesDir,
-		debugSql:          config.DebugSql,
-		migrations:        make(map[string]Migration),
+		driver:             driver,
+		migrationFilesDir:  config.MigrationFilesDir,
+		debugSql:           config.DebugSql,
+		sortFunc:           config.SortFunc,
+		preMigrateSQL:      config.PreMigrateSQL,
+		postMigrateSQL:     config.PostMigrateSQL,
+		structNamer:        config.StructNamer,
+		skipCreateTable:    config.DisableAutoCreateTable,
+		strictReversible:   config.StrictReversibility,
+		baseline:           config.Baseline,
+		migrationFS:        config.MigrationFS,
+		migrationFSDir:     config.MigrationFSDir,
+		upSuffix:           config.UpSuffix,
+		downSuffix:         config.DownSuffix,
+		hooksInTransaction: config.HooksInTransaction,
+		sqlTransform:       config.SQLTransform,
+		preserveOrder:      config.PreserveRegistrationOrder,
+		tracer:             config.Tracer,
+		fromStored:         config.RollbackFromStored,
+		safeMode:           config.SafeMode,
+		destructive:        destructive,
+		clock:              config.Clock,
+		environment:        config.Environment,
+		failOnOrphans:      config.FailOnOrphans,
+		requireReversible:  config.RequireReversible,
+		disallowEmptyUp:    config.DisallowEmptyUp,
+		onMissing:          config.OnMissingRollbackMigration,
+		lockTimeout:        config.LockTimeout,
+		twoPhaseRecording:  config.TwoPhaseRecording && config.RecordMigration == nil && config.RemoveMigration == nil,
+		quiet:              config.Quiet,
+		audit:              newAuditLog(config.AuditLogWriter),
+		rollbackOnFailure:  config.RollbackOnBatchFailure,
+		migrations:         make(map[string]Migration),
 	}, nil
 }
 
 // Register adds one or more Migration instances to the internal registry.
-// It ensures no duplicate migration names are registered.
+// It ensures no duplicate migration names are registered and warns when two
+// migrations share the same timestamp prefix, which usually indicates a merge hazard.
 func (q *Qafoia) Register(migrations ...Migration) error {
 	q.mu.Lock()
 	defer q.mu.Unlock()
@@ -71,12 +210,145 @@ func (q *Qafoia) Register(migrations ...Migration) error {
 		if _, exists := q.migrations[name]; exists {
 			return fmt.Errorf("migration %s registered more than once", name)
 		}
+		if timestamp, ok := migrationTimestamp(name); ok {
+			for existing := range q.migrations {
+				if existingTimestamp, ok := migrationTimestamp(existing); ok && existingTimestamp == timestamp {
+					log.Printf("⚠️  Migrations %s and %s share the same timestamp %s\n", existing, name, timestamp)
+				}
+			}
+		}
 		q.migrations[name] = migration
+		q.registrationOrder = append(q.registrationOrder, name)
+	}
+
+	return nil
+}
+
+// RegisterAll validates and registers a whole set of migrations, such as one built by a
+// generator. Every name must be unique and start with a valid timestamp prefix, and no two
+// migrations may share a timestamp, including migrations registered earlier. All problems
+// are reported together and nothing is registered unless the whole set is valid.
+func (q *Qafoia) RegisterAll(migrations []Migration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var errs []error
+	names := make(map[string]bool, len(migrations))
+	timestamps := make(map[string]string, len(q.migrations)+len(migrations))
+	for existing := range q.migrations {
+		if timestamp, ok := migrationTimestamp(existing); ok {
+			timestamps[timestamp] = existing
+		}
+	}
+
+	for _, migration := range migrations {
+		name := migration.Name()
+		if name == "" {
+			errs = append(errs, ErrMigrationNameNotProvided)
+			continue
+		}
+		if _, exists := q.migrations[name]; exists || names[name] {
+			errs = append(errs, fmt.Errorf("migration %s registered more than once", name))
+			continue
+		}
+		names[name] = true
+
+		timestamp, ok := migrationTimestamp(name)
+		if !ok {
+			errs = append(errs, fmt.Errorf("migration %s: name has no timestamp prefix", name))
+			continue
+		}
+		if _, err := time.Parse(migrationTimestampLayout, timestamp); err != nil {
+			errs = append(errs, fmt.Errorf("migration %s: invalid timestamp %s", name, timestamp))
+			continue
+		}
+		if existing, found := timestamps[timestamp]; found {
+			errs = append(errs, fmt.Errorf("migrations %s and %s share the same timestamp %s", existing, name, timestamp))
+			continue
+		}
+		timestamps[timestamp] = name
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	for _, migration := range migrations {
+		q.migrations[migration.Name()] = migration
+		q.registrationOrder = append(q.registrationOrder, migration.Name())
+	}
+
+	return nil
+}
+
+// GetMigration returns the registered migration with the given name, and whether it was found.
+func (q *Qafoia) GetMigration(name string) (Migration, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	migration, found := q.migrations[name]
+	return migration, found
+}
+
+// Load eagerly reads, validates and registers the SQL file migrations in Config.MigrationFS.
+// Structural problems such as invalid names or missing up/down pairs are reported up front.
+// The loaded migrations are cached, so Load only reads the files once; every operation that
+// reads the registered migrations calls it implicitly if it has not been called yet.
+func (q *Qafoia) Load() error {
+	q.loadMu.Lock()
+	defer q.loadMu.Unlock()
+
+	if q.loaded {
+		return nil
+	}
+
+	if q.migrationFS != nil {
+		files, err := collectMigrationFiles(q.migrationFS, q.migrationFSDir, q.upSuffix, q.downSuffix)
+		if err != nil {
+			return err
+		}
+
+		var errs []error
+		migrations := make([]Migration, 0, len(files))
+		for _, file := range files {
+			if !isValidMigrationName(file.Name) {
+				errs = append(errs, fmt.Errorf("invalid migration name: %s", file.Name))
+				continue
+			}
+			migrations = append(migrations, &fileMigration{file: file, inlineHooks: q.hooksInTransaction})
+		}
+		if len(errs) > 0 {
+			return errors.Join(errs...)
+		}
+
+		if err := q.Register(migrations...); err != nil {
+			return err
+		}
 	}
 
+	q.loaded = true
 	return nil
 }
 
+// RegisterFS loads the .up.sql/.down.sql migration pairs in dir from fsys and registers them.
+// Config.UpSuffix and Config.DownSuffix replace the default suffixes.
+func (q *Qafoia) RegisterFS(fsys fs.FS, dir string) error {
+	if fsys == nil {
+		return ErrEmbeddedFSNotProvided
+	}
+
+	files, err := collectMigrationFiles(fsys, dir, q.upSuffix, q.downSuffix)
+	if err != nil {
+		return err
+	}
+
+	migrations := make([]Migration, 0, len(files))
+	for _, file := range files {
+		migrations = append(migrations, &fileMigration{file: file, inlineHooks: q.hooksInTransaction})
+	}
+	return q.Register(migrations...)
+}
+
 // Create generates a new migration file using the given name.
 // The generated file includes a timestamp prefix and basic template content.
 func (q *Qafoia) Create(fileName string) error {
@@ -89,14 +361,14 @@ func (q *Qafoia) Create(fileName string) error {
 		return err
 	}
 
-	migrationName = fmt.Sprintf("%s_%s", time.Now().Format("20060102150405"), migrationName)
+	migrationName = fmt.Sprintf("%s_%s", clockNow(q.clock).Format(migrationTimestampLayout), migrationName)
 	migrationFileName := fmt.Sprintf("%s/%s.go", q.migrationFilesDir, migrationName)
 
 	if fileExists(migrationFileName) {
 		return ErrMigrationFileAlreadyExists
 	}
 
-	template, err := migrationFileTemplate(getPackageNameFromMigrationDir(q.migrationFilesDir), migrationName)
+	template, err := migrationFileTemplate(getPackageNameFromMigrationDir(q.migrationFilesDir), migrationName, q.structNamer)
 	if err != nil {
 		return err
 	}
@@ -110,219 +382,1861 @@ func (q *Qafoia) Create(fileName string) error {
 	return nil
 }
 
-// Migrate applies all pending migrations in the correct order.
-// It skips migrations that have already been executed.
-func (q *Qafoia) Migrate(ctx context.Context) error {
-	if err := q.driver.CreateMigrationsTable(ctx); err != nil {
+// Validate checks that every registered migration name starts with a 14-digit timestamp, and
+// that each Go migration file in the migration directory declares the migration named after
+// the file, catching names left behind by copy-pasting a migration. All problems are
+// reported together.
+func (q *Qafoia) Validate() error {
+	if err := q.Load(); err != nil {
 		return err
 	}
 
-	executedMigrations, err := q.driver.GetExecutedMigrations(ctx, false)
-	if err != nil {
-		return err
+	var errs []error
+	for _, name := range q.sortedMigrationNames() {
+		if _, ok := migrationTimestamp(name); !ok {
+			errs = append(errs, fmt.Errorf("migration %s: name must start with a 14-digit timestamp followed by an underscore", name))
+		}
 	}
 
-	executedMap := make(map[string]struct{}, len(executedMigrations))
-	for _, m := range executedMigrations {
-		executedMap[m.Name] = struct{}{}
-	}
+	if migrationDirExists(q.migrationFilesDir) {
+		declared, err := declaredMigrationNames(q.migrationFilesDir)
+		if err != nil {
+			return err
+		}
 
-	migrationsToApply := make([]Migration, 0, len(q.migrations))
-	for _, name := range getSortedMigrationName(q.migrations) {
-		migration := q.migrations[name]
-		if _, found := executedMap[migration.Name()]; !found {
-			migrationsToApply = append(migrationsToApply, migration)
+		fileNames := make([]string, 0, len(declared))
+		for fileName := range declared {
+			fileNames = append(fileNames, fileName)
 		}
-	}
+		sort.Strings(fileNames)
 
-	if len(migrationsToApply) == 0 {
-		log.Println("✅ No migrations to run")
-		return nil
+		for _, fileName := range fileNames {
+			expected := strings.TrimSuffix(fileName, ".go")
+			for _, name := range declared[fileName] {
+				if name != expected {
+					errs = append(errs, fmt.Errorf("migration file %s: Name() returns %q, expected %q", fileName, name, expected))
+				}
+			}
+		}
 	}
 
-	log.Printf("🚀 Applying %d migration(s)...\n", len(migrationsToApply))
+	return errors.Join(errs...)
+}
 
-	return q.driver.ApplyMigrations(
-		ctx,
-		migrationsToApply,
-		func(m *Migration) {
-			log.Printf("📦 Migrating: %s\n", (*m).Name())
-			if q.debugSql {
-				log.Println("🧾 Running SQL:")
-				fmt.Println("================================================")
-				fmt.Println((*m).UpScript())
-				fmt.Println("================================================")
-			}
-		},
-		func(m *Migration) {
-			log.Printf("✅ Migrated: %s\n", (*m).Name())
-		},
-		func(m *Migration, err error) {
-			log.Printf("❌ Migration failed: %s - %s\n", (*m).Name(), err)
-		},
-	)
+// Migrate applies all pending migrations in the correct order.
+// It skips migrations that have already been executed. The configured pre-migrate and
+// post-migrate SQL runs before and after the batch when there is something to apply.
+func (q *Qafoia) Migrate(ctx context.Context) error {
+	_, err := q.migrate(ctx)
+	return err
 }
 
-// Fresh wipes the database clean and reapplies all registered migrations from scratch.
-func (q *Qafoia) Fresh(ctx context.Context) error {
-	log.Println("🧹 Cleaning database...")
+// MigrateStep applies at most step pending migrations, in the same order Migrate would apply
+// them, for a controlled one-at-a-time rollout.
+func (q *Qafoia) MigrateStep(ctx context.Context, step int) error {
+	_, err := q.migrateStep(ctx, step)
+	return err
+}
 
-	if err := q.driver.CleanDatabase(ctx); err != nil {
-		return fmt.Errorf("failed to clean database: %w", err)
+// migrateStep applies at most step pending migrations and returns a summary of the run.
+func (q *Qafoia) migrateStep(ctx context.Context, step int) (runSummary, error) {
+	if step <= 0 {
+		return runSummary{}, ErrInvalidMigrateStep
 	}
 
-	log.Println("🚀 Running fresh migrations...")
-
-	if err := q.Migrate(ctx); err != nil {
-		return fmt.Errorf("failed to run migrations after cleaning: %w", err)
-	}
+	return q.migratePending(ctx, func(pending []Migration) []Migration {
+		return pending[:min(step, len(pending))]
+	}, time.Time{})
+}
 
-	log.Println("✅ Fresh migration completed successfully")
-	return nil
+// MigrateBefore applies the pending migrations whose timestamp prefix is before cutoff, so
+// migrations can be staged in advance and applied once approved. Migrations whose name has
+// no parseable timestamp are skipped with a warning.
+func (q *Qafoia) MigrateBefore(ctx context.Context, cutoff time.Time) error {
+	_, err := q.migratePending(ctx, func(pending []Migration) []Migration {
+		selected := make([]Migration, 0, len(pending))
+		for _, m := range pending {
+			timestamp, ok := migrationTimestamp(m.Name())
+			if !ok {
+				log.Printf("⚠️  Skipping %s: name has no timestamp prefix\n", m.Name())
+				continue
+			}
+			at, err := time.ParseInLocation(migrationTimestampLayout, timestamp, cutoff.Location())
+			if err != nil {
+				log.Printf("⚠️  Skipping %s: invalid timestamp %s\n", m.Name(), timestamp)
+				continue
+			}
+			if at.Before(cutoff) {
+				selected = append(selected, m)
+			}
+		}
+		return selected
+	}, time.Time{})
+	return err
 }
 
-// Reset rolls back all applied migrations and reapplies them from scratch.
-func (q *Qafoia) Reset(ctx context.Context) error {
-	executedMigrations, err := q.driver.GetExecutedMigrations(ctx, true)
-	if err != nil {
-		return fmt.Errorf("failed to get executed migrations: %w", err)
-	}
+// MigrateUntil applies pending migrations one at a time, in the same order Migrate would apply
+// them, and stops before starting a migration once deadline has passed, for maintenance
+// windows with a hard end. A migration already running when the deadline passes is left to
+// finish. It returns the number of migrations applied; calling Migrate later applies the rest.
+func (q *Qafoia) MigrateUntil(ctx context.Context, deadline time.Time) (int, error) {
+	summary, err := q.migratePending(ctx, nil, deadline)
+	return summary.Applied, err
+}
 
-	if len(executedMigrations) == 0 {
-		log.Println("✅ No migrations to reset")
-		return nil
-	}
+// Keywords accepted as targets by MigrateTo and RollbackTo in place of a migration name.
+const (
+	// TargetLatest makes MigrateTo apply every pending migration.
+	TargetLatest = "latest"
+	// TargetBase makes RollbackTo roll back every executed migration.
+	TargetBase = "base"
+)
 
-	log.Printf("🔁 Resetting %d executed migration(s)...\n", len(executedMigrations))
+// MigrateTo applies the pending migrations up to and including the migration named target, in
+// the order Migrate would apply them. TargetLatest applies all pending migrations, like
+// Migrate. Keywords are matched before migration names, so a migration named like a keyword
+// can only be reached with Migrate.
+func (q *Qafoia) MigrateTo(ctx context.Context, target string) error {
+	_, err := q.migrateTo(ctx, target)
+	return err
+}
 
-	if err := q.Rollback(ctx, len(executedMigrations)); err != nil {
-		return fmt.Errorf("rollback failed during reset: %w", err)
+// migrateTo applies the pending migrations up to target and returns a summary of the run.
+func (q *Qafoia) migrateTo(ctx context.Context, target string) (runSummary, error) {
+	if target == TargetLatest {
+		return q.migrate(ctx)
 	}
 
-	if err := q.Migrate(ctx); err != nil {
-		return fmt.Errorf("migration failed during reset: %w", err)
+	if err := q.Load(); err != nil {
+		return runSummary{}, err
+	}
+	if _, found := q.GetMigration(target); !found {
+		return runSummary{}, fmt.Errorf("%w: %s", ErrMigrationNotRegistered, target)
 	}
 
-	log.Println("✅ Migration reset completed successfully")
-	return nil
+	return q.migratePending(ctx, func(pending []Migration) []Migration {
+		for i, m := range pending {
+			if m.Name() == target {
+				return pending[:i+1]
+			}
+		}
+		log.Printf("⚠️  %s is not pending\n", target)
+		return nil
+	}, time.Time{})
 }
 
-// Rollback undoes the last `step` number of executed migrations.
-func (q *Qafoia) Rollback(ctx context.Context, step int) error {
-	if step <= 0 {
-		return ErrInvalidRollbackStep
+// migrate applies all pending migrations and returns a summary of the run.
+func (q *Qafoia) migrate(ctx context.Context) (runSummary, error) {
+	return q.migratePending(ctx, nil, time.Time{})
+}
+
+// migratePending applies the pending migrations returned by selectPending, or all pending
+// migrations if it is nil, and returns a summary of the run. Pending migrations that are not
+// selected count as skipped. With a non-zero deadline, migrations are applied one at a time
+// and the ones that would start after it are left pending and count as skipped.
+func (q *Qafoia) migratePending(ctx context.Context, selectPending func(pending []Migration) []Migration, deadline time.Time) (summary runSummary, err error) {
+	defer summary.track(time.Now())
+
+	ctx, span := q.startSpan(ctx, "qafoia.migrate")
+	defer func() { endRunSpan(span, summary, err) }()
+
+	unlock, err := q.lock(ctx)
+	if err != nil {
+		return summary, err
 	}
+	defer unlock()
 
-	executedMigrations, err := q.driver.GetExecutedMigrations(ctx, true)
+	migrationsToApply, skipped, err := q.pendingMigrations(ctx)
 	if err != nil {
-		return err
+		return summary, err
 	}
+	summary.Skipped = skipped
 
-	if len(executedMigrations) == 0 {
-		log.Println("✅ No migrations to rollback")
-		return nil
+	if selectPending != nil {
+		pending := len(migrationsToApply)
+		migrationsToApply = selectPending(migrationsToApply)
+		summary.Skipped += pending - len(migrationsToApply)
 	}
 
-	if step > len(executedMigrations) {
-		step = len(executedMigrations)
+	migrationJobFromContext(ctx).setTotal(len(migrationsToApply))
+
+	if len(migrationsToApply) == 0 {
+		q.logRoutine("✅ No migrations to run")
+		return summary, nil
 	}
 
-	migrationMap := make(map[string]Migration, len(q.migrations))
-	for _, m := range q.migrations {
-		migrationMap[m.Name()] = m
+	if err := q.checkCapabilities(migrationsToApply); err != nil {
+		return summary, err
 	}
 
-	migrationsToRollback := make([]Migration, 0, step)
-	for i := range step {
-		executedMigration := executedMigrations[i]
-		if migration, found := migrationMap[executedMigration.Name]; found {
-			migrationsToRollback = append(migrationsToRollback, migration)
-		} else {
-			log.Printf("⚠️  Migration not found for: %s\n", executedMigration.Name)
+	if q.disallowEmptyUp {
+		if err := checkEmptyUp(migrationsToApply); err != nil {
+			return summary, err
 		}
 	}
 
-	if len(migrationsToRollback) == 0 {
-		log.Println("✅ No migrations to rollback")
-		return nil
+	if q.safeMode {
+		if err := q.checkDestructive(migrationsToApply); err != nil {
+			return summary, err
+		}
 	}
 
-	log.Printf("🔁 Rolling back %d migration(s)...\n", len(migrationsToRollback))
+	if q.requireReversible {
+		if err := q.checkDownScripts(ctx, migrationsToApply); err != nil {
+			return summary, err
+		}
+	}
 
-	return q.driver.UnapplyMigrations(
-		ctx,
-		migrationsToRollback,
-		func(m *Migration) {
-			log.Printf("🔄 Rolling back: %s\n", (*m).Name())
-			if q.debugSql {
-				log.Println("🧾 Running SQL:")
-				fmt.Println("================================================")
-				fmt.Println((*m).DownScript())
-				fmt.Println("================================================")
-			}
-		},
-		func(m *Migration) {
-			log.Printf("✅ Rolled back: %s\n", (*m).Name())
-		},
-		func(m *Migration, err error) {
-			log.Printf("❌ Rollback failed: %s - %s\n", (*m).Name(), err)
-		},
-	)
-}
+	for _, sql := range q.preMigrateSQL {
+		if err := q.executeSQL(ctx, sql); err != nil {
+			return summary, fmt.Errorf("failed to run pre-migrate SQL: %w", err)
+		}
+	}
 
-// Clean drops all database tables and objects managed by the migration system.
-func (q *Qafoia) Clean(ctx context.Context) error {
-	log.Println("🧹 Cleaning database...")
+	log.Printf("🚀 Applying %d migration(s)...\n", len(migrationsToApply))
 
-	if err := q.driver.CleanDatabase(ctx); err != nil {
-		return fmt.Errorf("failed to clean database: %w", err)
+	if err := q.applyPending(ctx, migrationsToApply, deadline, &summary); err != nil {
+		if q.rollbackOnFailure {
+			err = q.rollbackBatch(ctx, migrationsToApply, &summary, err)
+		}
+		return summary, err
 	}
 
-	log.Println("✅ Database cleaned successfully")
-	return nil
+	for _, sql := range q.postMigrateSQL {
+		if err := q.executeSQL(ctx, sql); err != nil {
+			return summary, fmt.Errorf("failed to run post-migrate SQL: %w", err)
+		}
+	}
+
+	return summary, nil
 }
 
-// List returns all registered migrations along with their execution status.
-func (q *Qafoia) List(ctx context.Context) (RegisteredMigrationList, error) {
-	if err := q.driver.CreateMigrationsTable(ctx); err != nil {
-		return nil, err
+// applyPending applies the migrations in order, one at a time when they need to be checked
+// individually or a deadline is set, updating summary with the outcome of each. Otherwise only
+// migrations with hook scripts are applied on their own, and the migrations between them are
+// applied together, so their transaction groups are kept.
+func (q *Qafoia) applyPending(ctx context.Context, migrations []Migration, deadline time.Time, summary *runSummary) error {
+	if !q.strictReversible && deadline.IsZero() {
+		for len(migrations) > 0 {
+			hooked := slices.IndexFunc(migrations, hasHookScripts)
+			if hooked == -1 {
+				return q.applyMigrations(ctx, migrations, summary)
+			}
+			if hooked > 0 {
+				if err := q.applyMigrations(ctx, migrations[:hooked], summary); err != nil {
+					return err
+				}
+			}
+			if err := q.applyWithHooks(ctx, migrations[hooked], summary); err != nil {
+				return err
+			}
+			migrations = migrations[hooked+1:]
+		}
+		return nil
+	}
+
+	for i, migration := range migrations {
+		if !deadline.IsZero() && !clockNow(q.clock).Before(deadline) {
+			left := len(migrations) - i
+			log.Printf("⏸️  Deadline reached, leaving %d migration(s) pending\n", left)
+			summary.Skipped += left
+			break
+		}
+		if q.strictReversible {
+			// Each migration is verified against the schema left by the previous one
+			if err := q.verifyReversible(ctx, migration); err != nil {
+				summary.failed()
+				return err
+			}
+		}
+		if err := q.applyWithHooks(ctx, migration, summary); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
+// rollbackBatch rolls back, most recent first, the migrations of batch that a failed run
+// applied, for Config.RollbackOnBatchFailure. The batch only holds migrations that were pending
+// when the run started, so migrations applied by earlier runs are never touched. It returns
+// runErr, joined with the error of the rollback if that fails too.
+func (q *Qafoia) rollbackBatch(ctx context.Context, batch []Migration, summary *runSummary, runErr error) error {
 	executedMigrations, err := q.driver.GetExecutedMigrations(ctx, false)
 	if err != nil {
-		return nil, err
+		return errors.Join(runErr, fmt.Errorf("failed to read migrations to roll back: %w", err))
 	}
 
-	executedMap := make(map[string]struct {
-		Executed   bool
-		ExecutedAt *time.Time
-	}, len(executedMigrations))
-
+	executed := make(map[string]bool, len(executedMigrations))
 	for _, m := range executedMigrations {
-		executedMap[m.Name] = struct {
-			Executed   bool
-			ExecutedAt *time.Time
-		}{
-			Executed:   true,
-			ExecutedAt: &m.ExecutedAt,
+		executed[m.Name] = !m.InProgress
+	}
+
+	var applied []Migration
+	for i := len(batch) - 1; i >= 0; i-- {
+		if executed[batch[i].Name()] {
+			applied = append(applied, batch[i])
 		}
 	}
+	if len(applied) == 0 {
+		return runErr
+	}
 
-	registeredMigrations := make(RegisteredMigrationList, 0, len(q.migrations))
+	log.Printf("↩️  Rolling back %d migration(s) applied before the failure...\n", len(applied))
 
-	for _, k := range getSortedMigrationName(q.migrations) {
-		migration := q.migrations[k]
-		name := migration.Name()
-		executed := executedMap[name]
+	if q.fromStored {
+		ctx, err = q.withStoredDownScripts(ctx, applied)
+		if err != nil {
+			return errors.Join(runErr, err)
+		}
+	}
+	if err := q.unapplyMigrations(ctx, applied, nil); err != nil {
+		return errors.Join(runErr, fmt.Errorf("failed to roll back applied migrations: %w", err))
+	}
+	summary.Applied -= len(applied)
+	return runErr
+}
 
-		registeredMigrations = append(registeredMigrations, RegisteredMigration{
-			Name:       name,
-			UpScript:   migration.UpScript(),
-			DownScript: migration.DownScript(),
-			IsExecuted: executed.Executed,
-			ExecutedAt: executed.ExecutedAt,
-		})
+// hookedMigration is implemented by migrations with hook scripts run on their own right before
+// and after their up script, such as SQL file migrations with .before.sql and .after.sql files.
+type hookedMigration interface {
+	beforeScript() string
+	afterScript() string
+}
+
+// hasHookScripts reports whether the migration has a before or after hook script.
+func hasHookScripts(migration Migration) bool {
+	hooked, ok := migration.(hookedMigration)
+	return ok && (hooked.beforeScript() != "" || hooked.afterScript() != "")
+}
+
+// executeSQL runs an SQL script that is not tracked as a migration, which requires a driver
+// that implements ExecuteSQL.
+func (q *Qafoia) executeSQL(ctx context.Context, sql string) error {
+	executor, ok := q.driver.(ScriptExecutor)
+	if !ok {
+		return ErrExecuteSQLNotSupported
 	}
+	return executor.ExecuteSQL(ctx, sql)
+}
 
-	return registeredMigrations, nil
+// runHook runs a before or after hook script of the named migration, rewritten by the SQL
+// transform like the up script it belongs to.
+func (q *Qafoia) runHook(ctx context.Context, name string, script string) error {
+	if q.sqlTransform != nil {
+		transformed, err := q.sqlTransform(name, script)
+		if err != nil {
+			return fmt.Errorf("failed to transform SQL: %w", err)
+		}
+		script = transformed
+	}
+	return q.executeSQL(ctx, script)
+}
+
+// applyWithHooks applies a single migration, running its before and after hook scripts, if
+// any, as separate statements right before and after it. A failing after hook is returned
+// as an error, but the migration itself has been applied and recorded by then, so it is
+// counted as applied rather than failed.
+func (q *Qafoia) applyWithHooks(ctx context.Context, migration Migration, summary *runSummary) error {
+	hooked, ok := migration.(hookedMigration)
+	if !ok {
+		return q.applyMigrations(ctx, []Migration{migration}, summary)
+	}
+
+	if before := hooked.beforeScript(); before != "" {
+		if err := q.runHook(ctx, migration.Name(), before); err != nil {
+			summary.failed()
+			return fmt.Errorf("failed to run before hook of %s: %w", migration.Name(), err)
+		}
+	}
+
+	if err := q.applyMigrations(ctx, []Migration{migration}, summary); err != nil {
+		return err
+	}
+
+	if after := hooked.afterScript(); after != "" {
+		if err := q.runHook(ctx, migration.Name(), after); err != nil {
+			return fmt.Errorf("failed to run after hook of %s: %w", migration.Name(), err)
+		}
+	}
+	return nil
+}
+
+// PlannedOrder returns the names of the pending migrations in the order Migrate would apply
+// them, without applying anything, for reviewing the order before a deploy.
+func (q *Qafoia) PlannedOrder(ctx context.Context) ([]string, error) {
+	pending, _, err := q.pendingMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(pending))
+	for _, m := range pending {
+		names = append(names, m.Name())
+	}
+	return names, nil
+}
+
+// pendingMigrations returns the migrations the next migrate applies, in order, along with the
+// number of registered migrations it skips. It fails on the same migration table states that
+// stop a migrate.
+func (q *Qafoia) pendingMigrations(ctx context.Context) (pending []Migration, skipped int, err error) {
+	if err := q.Load(); err != nil {
+		return nil, 0, err
+	}
+
+	if err := q.ensureMigrationsTable(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	executedMigrations, err := q.driver.GetExecutedMigrations(ctx, false)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	executedMap := make(map[string]struct{}, len(executedMigrations))
+	for _, m := range executedMigrations {
+		if m.InProgress {
+			return nil, 0, fmt.Errorf("%w: %s; check the database state and remove or complete its migration record", ErrMigrationInProgress, m.Name)
+		}
+		executedMap[m.Name] = struct{}{}
+	}
+
+	if q.failOnOrphans {
+		var orphans []string
+		for _, m := range executedMigrations {
+			if _, found := q.migrations[m.Name]; !found {
+				orphans = append(orphans, m.Name)
+			}
+		}
+		if len(orphans) > 0 {
+			return nil, 0, fmt.Errorf("%w: %s", ErrOrphanedMigrations, strings.Join(orphans, ", "))
+		}
+	}
+
+	pending = make([]Migration, 0, len(q.migrations))
+	for _, name := range q.sortedMigrationNames() {
+		migration := q.migrations[name]
+		if _, found := executedMap[migration.Name()]; !found && !q.isBaselined(name) && !q.isExcludedByEnvironment(migration) {
+			pending = append(pending, migration)
+		} else {
+			skipped++
+		}
+	}
+
+	return pending, skipped, nil
+}
+
+// Fresh wipes the database clean and reapplies all registered migrations from scratch.
+func (q *Qafoia) Fresh(ctx context.Context) error {
+	_, err := q.fresh(ctx)
+	return err
+}
+
+// fresh cleans the database, reapplies all migrations and returns a summary of the run.
+func (q *Qafoia) fresh(ctx context.Context) (runSummary, error) {
+	log.Println("🧹 Cleaning database...")
+
+	if err := q.cleanDatabase(ctx); err != nil {
+		return runSummary{}, fmt.Errorf("failed to clean database: %w", err)
+	}
+
+	log.Println("🚀 Running fresh migrations...")
+
+	summary, err := q.migrate(ctx)
+	if err != nil {
+		return summary, fmt.Errorf("failed to run migrations after cleaning: %w", err)
+	}
+
+	q.logRoutine("✅ Fresh migration completed successfully")
+	return summary, nil
+}
+
+// Reset rolls back all applied migrations and reapplies them from scratch.
+func (q *Qafoia) Reset(ctx context.Context) error {
+	executedMigrations, err := q.driver.GetExecutedMigrations(ctx, true)
+	if err != nil {
+		return fmt.Errorf("failed to get executed migrations: %w", err)
+	}
+
+	if len(executedMigrations) == 0 {
+		q.logRoutine("✅ No migrations to reset")
+		return nil
+	}
+
+	log.Printf("🔁 Resetting %d executed migration(s)...\n", len(executedMigrations))
+
+	if err := q.Rollback(ctx, len(executedMigrations)); err != nil {
+		return fmt.Errorf("rollback failed during reset: %w", err)
+	}
+
+	if err := q.Migrate(ctx); err != nil {
+		return fmt.Errorf("migration failed during reset: %w", err)
+	}
+
+	q.logRoutine("✅ Migration reset completed successfully")
+	return nil
+}
+
+// Rollback undoes the last `step` number of executed migrations.
+func (q *Qafoia) Rollback(ctx context.Context, step int) error {
+	_, err := q.rollback(ctx, step)
+	return err
+}
+
+// rollback undoes the last `step` executed migrations and returns a summary of the run.
+func (q *Qafoia) rollback(ctx context.Context, step int) (runSummary, error) {
+	if step <= 0 {
+		return runSummary{}, ErrInvalidRollbackStep
+	}
+
+	return q.rollbackExecuted(ctx, lastExecuted(step))
+}
+
+// lastExecuted returns a selector of the last step executed migrations, capped at the number
+// of executed migrations.
+func lastExecuted(step int) func(executed []ExecutedMigration) []ExecutedMigration {
+	return func(executed []ExecutedMigration) []ExecutedMigration {
+		return executed[:min(step, len(executed))]
+	}
+}
+
+// RollbackPlan returns the names of the migrations Rollback would undo for step, in the order
+// it would undo them, without rolling anything back. Executed migrations that are not
+// registered are left out when Rollback would skip them, and included when their record would
+// be removed; with MissingMigrationError, RollbackPlan fails as Rollback would.
+func (q *Qafoia) RollbackPlan(ctx context.Context, step int) ([]string, error) {
+	if step <= 0 {
+		return nil, ErrInvalidRollbackStep
+	}
+
+	executedMigrations, err := q.executedToRollback(ctx, lastExecuted(step))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(executedMigrations))
+	var missing []string
+	for _, executedMigration := range executedMigrations {
+		if _, found := q.migrations[executedMigration.Name]; found || q.onMissing == MissingMigrationRemoveRecord {
+			names = append(names, executedMigration.Name)
+		} else if q.onMissing == MissingMigrationError {
+			missing = append(missing, executedMigration.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMigrationNotRegistered, strings.Join(missing, ", "))
+	}
+	return names, nil
+}
+
+// RollbackTo rolls back, most recent first, the executed migrations applied after the
+// migration named target, which stays applied. TargetBase rolls back every executed
+// migration. Keywords are matched before migration names, and a number that is not the name
+// of an executed migration is taken as a version: the migrations recorded with a higher
+// version, as reported by CurrentVersion, are rolled back, and version 0 rolls back all.
+func (q *Qafoia) RollbackTo(ctx context.Context, target string) error {
+	_, err := q.rollbackTo(ctx, target)
+	return err
+}
+
+// rollbackTo rolls back the executed migrations after target and returns a summary of the run.
+func (q *Qafoia) rollbackTo(ctx context.Context, target string) (runSummary, error) {
+	if target == TargetBase {
+		return q.rollbackExecuted(ctx, func(executed []ExecutedMigration) []ExecutedMigration {
+			return executed
+		})
+	}
+
+	executedMigrations, err := q.driver.GetExecutedMigrations(ctx, false)
+	if err != nil {
+		return runSummary{}, err
+	}
+	if !slices.ContainsFunc(executedMigrations, func(m ExecutedMigration) bool { return m.Name == target }) {
+		if version, err := strconv.Atoi(target); err == nil && version >= 0 {
+			return q.rollbackToVersion(ctx, version)
+		}
+		return runSummary{}, fmt.Errorf("%w: %s", ErrMigrationNotExecuted, target)
+	}
+
+	return q.rollbackExecuted(ctx, func(executed []ExecutedMigration) []ExecutedMigration {
+		for i, m := range executed {
+			if m.Name == target {
+				return executed[:i]
+			}
+		}
+		return nil
+	})
+}
+
+// rollbackToVersion rolls back the executed migrations recorded with a version higher than
+// version and returns a summary of the run.
+func (q *Qafoia) rollbackToVersion(ctx context.Context, version int) (runSummary, error) {
+	reader, ok := q.driver.(VersionReader)
+	if !ok {
+		return runSummary{}, ErrVersionsNotSupported
+	}
+
+	versions, err := reader.ReadVersions(ctx)
+	if err != nil {
+		return runSummary{}, err
+	}
+	found := version == 0
+	for _, v := range versions {
+		found = found || v == version
+	}
+	if !found {
+		return runSummary{}, fmt.Errorf("%w: version %d", ErrMigrationNotExecuted, version)
+	}
+
+	return q.rollbackExecuted(ctx, func(executed []ExecutedMigration) []ExecutedMigration {
+		var later []ExecutedMigration
+		for _, m := range executed {
+			if versions[m.Name] > version {
+				later = append(later, m)
+			}
+		}
+		return later
+	})
+}
+
+// CurrentVersion returns the highest version number recorded for an executed migration, or
+// 0 when none is executed. The built-in drivers number migrations with the auto-incrementing
+// version column of the migration table as they are recorded, so a migration rolled back and
+// applied again gets a new version. Drivers without version numbers return
+// ErrVersionsNotSupported.
+func (q *Qafoia) CurrentVersion(ctx context.Context) (int, error) {
+	reader, ok := q.driver.(VersionReader)
+	if !ok {
+		return 0, ErrVersionsNotSupported
+	}
+
+	if err := q.ensureMigrationsTable(ctx); err != nil {
+		return 0, err
+	}
+
+	versions, err := reader.ReadVersions(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	current := 0
+	for _, version := range versions {
+		current = max(current, version)
+	}
+	return current, nil
+}
+
+// RollbackMatching rolls back, most recent first, every executed migration whose name matches
+// the regular expression pattern, such as "^20240601" for the migrations of one day. A warning
+// is logged for each later migration that does not match and stays applied.
+func (q *Qafoia) RollbackMatching(ctx context.Context, pattern string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRollbackPattern, err)
+	}
+
+	_, err = q.rollbackExecuted(ctx, func(executed []ExecutedMigration) []ExecutedMigration {
+		var matching []ExecutedMigration
+		var kept []string
+		for _, m := range executed {
+			if re.MatchString(m.Name) {
+				matching = append(matching, m)
+				for _, name := range kept {
+					log.Printf("⚠️  %s stays applied after rolled back %s\n", name, m.Name)
+				}
+				kept = nil
+			} else {
+				kept = append(kept, m.Name)
+			}
+		}
+		return matching
+	})
+	return err
+}
+
+// executedToRollback returns the executed migrations selected by selectExecuted, which
+// receives them most recent first, in the order a rollback undoes them.
+func (q *Qafoia) executedToRollback(ctx context.Context, selectExecuted func(executed []ExecutedMigration) []ExecutedMigration) ([]ExecutedMigration, error) {
+	if err := q.Load(); err != nil {
+		return nil, err
+	}
+
+	executedMigrations, err := q.driver.GetExecutedMigrations(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(executedMigrations) == 0 {
+		return nil, nil
+	}
+
+	if q.sortFunc != nil || q.preserveOrder {
+		sort.SliceStable(executedMigrations, func(i, j int) bool {
+			return q.less(executedMigrations[j].Name, executedMigrations[i].Name)
+		})
+	}
+
+	return selectExecuted(executedMigrations), nil
+}
+
+// rollbackExecuted rolls back the executed migrations returned by selectExecuted, which
+// receives them most recent first, and returns a summary of the run.
+func (q *Qafoia) rollbackExecuted(ctx context.Context, selectExecuted func(executed []ExecutedMigration) []ExecutedMigration) (summary runSummary, err error) {
+	defer summary.track(time.Now())
+
+	ctx, span := q.startSpan(ctx, "qafoia.rollback")
+	defer func() { endRunSpan(span, summary, err) }()
+
+	unlock, err := q.lock(ctx)
+	if err != nil {
+		return summary, err
+	}
+	defer unlock()
+
+	executedMigrations, err := q.executedToRollback(ctx, selectExecuted)
+	if err != nil {
+		return summary, err
+	}
+
+	if len(executedMigrations) == 0 {
+		q.logRoutine("✅ No migrations to rollback")
+		return summary, nil
+	}
+
+	migrationMap := make(map[string]Migration, len(q.migrations))
+	for _, m := range q.migrations {
+		migrationMap[m.Name()] = m
+	}
+
+	// Each batch of registered migrations is followed by the name of a missing migration whose
+	// record is removed after the batch is rolled back, keeping the rollback order
+	type rollbackBatch struct {
+		migrations []Migration
+		missing    string
+	}
+	var batches []rollbackBatch
+	var current rollbackBatch
+	var missing []string
+	total := 0
+	for _, executedMigration := range executedMigrations {
+		if migration, found := migrationMap[executedMigration.Name]; found {
+			current.migrations = append(current.migrations, migration)
+			total++
+			continue
+		}
+
+		switch q.onMissing {
+		case MissingMigrationError:
+			missing = append(missing, executedMigration.Name)
+		case MissingMigrationRemoveRecord:
+			current.missing = executedMigration.Name
+			batches = append(batches, current)
+			current = rollbackBatch{}
+		default:
+			log.Printf("⚠️  Migration not found for: %s\n", executedMigration.Name)
+			summary.Skipped++
+		}
+	}
+	batches = append(batches, current)
+
+	if len(missing) > 0 {
+		return summary, fmt.Errorf("%w: %s", ErrMigrationNotRegistered, strings.Join(missing, ", "))
+	}
+
+	recorder, canForget := q.driver.(HistoryRecorder)
+	if len(batches) > 1 && !canForget {
+		return summary, ErrRecordingNotSupported
+	}
+
+	if total == 0 && len(batches) == 1 {
+		q.logRoutine("✅ No migrations to rollback")
+		return summary, nil
+	}
+
+	if total > 0 {
+		log.Printf("🔁 Rolling back %d migration(s)...\n", total)
+	}
+
+	for _, batch := range batches {
+		if len(batch.migrations) > 0 {
+			unapplyCtx := ctx
+			if q.fromStored {
+				unapplyCtx, err = q.withStoredDownScripts(ctx, batch.migrations)
+				if err != nil {
+					return summary, err
+				}
+			}
+			if err := q.unapplyMigrations(unapplyCtx, batch.migrations, &summary); err != nil {
+				return summary, err
+			}
+		}
+
+		if batch.missing != "" {
+			started := time.Now()
+			err := recorder.ForgetExecutedMigration(ctx, batch.missing)
+			q.recordAudit(AuditRecord{Action: AuditActionRemoveRecord, Migration: batch.missing}, started, err)
+			if err != nil {
+				return summary, fmt.Errorf("failed to remove record of %s: %w", batch.missing, err)
+			}
+			log.Printf("🗑️  Removed record of unregistered migration: %s\n", batch.missing)
+		}
+	}
+
+	return summary, nil
+}
+
+// Clean drops all database tables and objects managed by the migration system.
+func (q *Qafoia) Clean(ctx context.Context) error {
+	log.Println("🧹 Cleaning database...")
+
+	if err := q.cleanDatabase(ctx); err != nil {
+		return fmt.Errorf("failed to clean database: %w", err)
+	}
+
+	q.logRoutine("✅ Database cleaned successfully")
+	return nil
+}
+
+// cleanDatabase drops the tables of the database with the driver, logging each dropped table
+// and recording the clean in the audit log.
+func (q *Qafoia) cleanDatabase(ctx context.Context) error {
+	started := time.Now()
+	dropped, err := q.driver.CleanDatabase(ctx)
+	for _, table := range dropped {
+		log.Printf("🗑️  Dropped table: %s\n", table)
+	}
+	q.recordAudit(AuditRecord{Action: AuditActionClean, Tables: dropped}, started, err)
+	return err
+}
+
+// List returns all registered migrations along with their execution status.
+func (q *Qafoia) List(ctx context.Context) (RegisteredMigrationList, error) {
+	if err := q.Load(); err != nil {
+		return nil, err
+	}
+
+	if err := q.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+
+	// Listing never writes, so it may read from a replica configured with ReadReplica
+	var executedMigrations []ExecutedMigration
+	var err error
+	if reader, ok := q.driver.(ReplicaReader); ok {
+		executedMigrations, err = reader.GetExecutedMigrationsFromReplica(ctx)
+	} else {
+		executedMigrations, err = q.driver.GetExecutedMigrations(ctx, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	executedMap := make(map[string]struct {
+		Executed   bool
+		InProgress bool
+		ExecutedAt *time.Time
+		Duration   time.Duration
+	}, len(executedMigrations))
+
+	for _, m := range executedMigrations {
+		var executedAt *time.Time
+		if !m.InProgress {
+			executedAt = &m.ExecutedAt
+		}
+		executedMap[m.Name] = struct {
+			Executed   bool
+			InProgress bool
+			ExecutedAt *time.Time
+			Duration   time.Duration
+		}{
+			Executed:   !m.InProgress,
+			InProgress: m.InProgress,
+			ExecutedAt: executedAt,
+			Duration:   m.Duration,
+		}
+	}
+
+	registeredMigrations := make(RegisteredMigrationList, 0, len(q.migrations))
+
+	for _, k := range q.sortedMigrationNames() {
+		migration := q.migrations[k]
+		name := migration.Name()
+		executed := executedMap[name]
+
+		var description string
+		if described, ok := migration.(DescribedMigration); ok {
+			description = described.Description()
+		}
+		var tags []string
+		if tagged, ok := migration.(TaggedMigration); ok {
+			tags = tagged.Tags()
+		}
+
+		registeredMigrations = append(registeredMigrations, RegisteredMigration{
+			Name:                    name,
+			Description:             description,
+			UpScript:                migration.UpScript(),
+			DownScript:              migration.DownScript(),
+			IsExecuted:              executed.Executed,
+			IsBaselined:             !executed.Executed && !executed.InProgress && q.isBaselined(name),
+			IsInProgress:            executed.InProgress,
+			IsSkippedForEnvironment: !executed.Executed && !executed.InProgress && q.isExcludedByEnvironment(migration),
+			ExecutedAt:              executed.ExecutedAt,
+			Duration:                executed.Duration,
+			Tags:                    tags,
+		})
+	}
+
+	return registeredMigrations, nil
+}
+
+// ListSharded returns whether each registered migration is applied on each shard of a
+// MultiDriver, to spot a shard that is behind the others. A migration recorded as in progress
+// on a shard counts as not applied there. Drivers that are not sharded return ErrNotSharded.
+func (q *Qafoia) ListSharded(ctx context.Context) (ShardedMigrationList, error) {
+	reader, ok := q.driver.(ShardReader)
+	if !ok {
+		return ShardedMigrationList{}, ErrNotSharded
+	}
+
+	if err := q.Load(); err != nil {
+		return ShardedMigrationList{}, err
+	}
+
+	if err := q.ensureMigrationsTable(ctx); err != nil {
+		return ShardedMigrationList{}, err
+	}
+
+	shards, executedByShard, err := reader.ExecutedMigrationsByShard(ctx)
+	if err != nil {
+		return ShardedMigrationList{}, err
+	}
+
+	applied := make([]map[string]bool, len(shards))
+	for i, executed := range executedByShard {
+		applied[i] = make(map[string]bool, len(executed))
+		for _, m := range executed {
+			applied[i][m.Name] = !m.InProgress
+		}
+	}
+
+	list := ShardedMigrationList{Shards: shards}
+	for _, name := range q.sortedMigrationNames() {
+		migration := ShardedMigration{Name: name, Applied: make([]bool, len(shards))}
+		for i := range shards {
+			migration.Applied[i] = applied[i][name]
+		}
+		list.Migrations = append(list.Migrations, migration)
+	}
+	return list, nil
+}
+
+// Init creates the migration table without running any migration. It is useful to
+// provision the table or verify DDL permissions in a controlled step.
+func (q *Qafoia) Init(ctx context.Context) error {
+	if err := q.driver.CreateMigrationsTable(ctx); err != nil {
+		return fmt.Errorf("failed to create migration table: %w", err)
+	}
+
+	q.logRoutine("✅ Migration table initialized")
+	return nil
+}
+
+// InitTx creates the migration table in tx, a transaction the caller commits or rolls back,
+// so the table is only kept if the caller's larger setup succeeds. Only drivers with
+// transactional DDL support it; others return ErrTransactionNotSupported, since MySQL would
+// implicitly commit the caller's transaction on CREATE TABLE.
+func (q *Qafoia) InitTx(ctx context.Context, tx *sql.Tx) error {
+	creator, ok := q.driver.(MigrationTableCreator)
+	if !ok {
+		return ErrTransactionNotSupported
+	}
+
+	if err := creator.CreateMigrationsTableWith(ctx, tx); err != nil {
+		return fmt.Errorf("failed to create migration table: %w", err)
+	}
+	return nil
+}
+
+// SchemaFingerprint returns a stable hash of the table, column and index definitions of the
+// current schema, leaving out the migration table. Applying all migrations to an empty
+// database and comparing the fingerprint with a committed value catches unintended schema
+// changes in tests. Drivers that cannot read the schema return ErrSnapshotNotSupported.
+func (q *Qafoia) SchemaFingerprint(ctx context.Context) (string, error) {
+	fingerprinter, ok := q.driver.(SchemaFingerprinter)
+	if !ok {
+		return "", ErrSnapshotNotSupported
+	}
+	return fingerprinter.SchemaFingerprint(ctx)
+}
+
+// Preflight checks that the database user has the permissions migrations need, before a
+// deploy touches the real schema. It creates a scratch table with a random name, inserts
+// and deletes a row, and drops the table, returning ErrPreflightFailed with the denied step.
+// The scratch table is dropped even when a later step fails.
+func (q *Qafoia) Preflight(ctx context.Context) error {
+	id, err := randomID()
+	if err != nil {
+		return err
+	}
+	table := "qafoia_preflight_" + id
+
+	steps := []struct {
+		name string
+		sql  string
+	}{
+		{"create table", fmt.Sprintf("CREATE TABLE %s (id INT)", table)},
+		{"insert", fmt.Sprintf("INSERT INTO %s (id) VALUES (1)", table)},
+		{"delete", fmt.Sprintf("DELETE FROM %s", table)},
+		{"drop table", fmt.Sprintf("DROP TABLE %s", table)},
+	}
+
+	for i, step := range steps {
+		if err := q.executeSQL(ctx, step.sql); err != nil {
+			if i > 0 && i < len(steps)-1 {
+				if dropErr := q.executeSQL(context.WithoutCancel(ctx), steps[len(steps)-1].sql); dropErr != nil {
+					log.Printf("⚠️  Failed to drop preflight table %s: %s\n", table, dropErr)
+				}
+			}
+			return fmt.Errorf("%w: %s: %w", ErrPreflightFailed, step.name, err)
+		}
+	}
+
+	q.logRoutine("✅ Preflight passed")
+	return nil
+}
+
+// Orphans returns the names of migrations recorded in the migration table that have no
+// matching registered migration, in the order they are stored.
+func (q *Qafoia) Orphans(ctx context.Context) ([]string, error) {
+	if err := q.Load(); err != nil {
+		return nil, err
+	}
+
+	if err := q.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+
+	executedMigrations, err := q.driver.GetExecutedMigrations(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	orphans := make([]string, 0)
+	for _, m := range executedMigrations {
+		if _, found := q.migrations[m.Name]; !found {
+			orphans = append(orphans, m.Name)
+		}
+	}
+
+	return orphans, nil
+}
+
+// RunSQLFile executes the SQL in the file at path through the driver without recording
+// anything in the migration table, for one-off maintenance scripts.
+func (q *Qafoia) RunSQLFile(ctx context.Context, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read SQL file %q: %w", path, err)
+	}
+
+	script := string(content)
+	if strings.TrimSpace(script) == "" {
+		return fmt.Errorf("SQL file %q is empty", path)
+	}
+
+	log.Printf("📦 Executing: %s\n", path)
+	if q.debugSql {
+		log.Println("🧾 Running SQL:")
+		fmt.Println("================================================")
+		fmt.Println(script)
+		fmt.Println("================================================")
+	}
+
+	if err := q.executeSQL(ctx, script); err != nil {
+		return &MigrationSQLError{Migration: path, SQL: script, Err: err}
+	}
+
+	log.Printf("✅ Executed: %s\n", path)
+
+	return nil
+}
+
+// History returns the content of the migration table, including the values of any additional
+// metadata columns when the driver supports reading them. Drivers that do not fall back to the
+// name and execution time of each migration.
+func (q *Qafoia) History(ctx context.Context) (MigrationHistory, error) {
+	if err := q.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+
+	if reader, ok := q.driver.(HistoryReader); ok {
+		return reader.ReadHistory(ctx)
+	}
+
+	return q.driver.GetExecutedMigrations(ctx, false)
+}
+
+// ExportHistory returns the executed migrations recorded in the migration table as JSON,
+// so the history can be restored with ImportHistory after the table is lost.
+func (q *Qafoia) ExportHistory(ctx context.Context) ([]byte, error) {
+	if err := q.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+
+	executedMigrations, err := q.driver.GetExecutedMigrations(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(executedMigrations, "", "  ")
+}
+
+// ImportHistory records the migrations in data, as produced by ExportHistory, as executed
+// without running any SQL. Migrations already recorded in the migration table are skipped.
+func (q *Qafoia) ImportHistory(ctx context.Context, data []byte) error {
+	recorder, ok := q.driver.(HistoryRecorder)
+	if !ok {
+		return ErrRecordingNotSupported
+	}
+
+	var history []ExecutedMigration
+	if err := json.Unmarshal(data, &history); err != nil {
+		return fmt.Errorf("failed to parse migration history: %w", err)
+	}
+
+	if err := q.ensureMigrationsTable(ctx); err != nil {
+		return err
+	}
+
+	executedMigrations, err := q.driver.GetExecutedMigrations(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	executed := make(map[string]struct{}, len(executedMigrations))
+	for _, m := range executedMigrations {
+		executed[m.Name] = struct{}{}
+	}
+
+	imported := 0
+	for _, m := range history {
+		if m.InProgress {
+			continue
+		}
+		if _, found := executed[m.Name]; found {
+			continue
+		}
+		if err := recorder.RecordExecutedMigration(ctx, m.Name, m.ExecutedAt); err != nil {
+			return fmt.Errorf("failed to import migration %s: %w", m.Name, err)
+		}
+		executed[m.Name] = struct{}{}
+		imported++
+	}
+
+	log.Printf("✅ Imported %d migration(s) into the migration history\n", imported)
+
+	return nil
+}
+
+// MarkApplied records the named registered migrations as executed without running their SQL.
+// It is the recovery tool for a migration whose changes were applied but never recorded, for
+// example because the process was killed mid-migration, and for a migration left in progress
+// by two-phase recording. Migrations that are already recorded as executed are skipped.
+func (q *Qafoia) MarkApplied(ctx context.Context, names ...string) error {
+	recorder, ok := q.driver.(HistoryRecorder)
+	if !ok {
+		return ErrRecordingNotSupported
+	}
+
+	if err := q.Load(); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if _, found := q.migrations[name]; !found {
+			return fmt.Errorf("%w: %s", ErrMigrationNotRegistered, name)
+		}
+	}
+
+	if err := q.ensureMigrationsTable(ctx); err != nil {
+		return err
+	}
+
+	executedMigrations, err := q.driver.GetExecutedMigrations(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	inProgress := make(map[string]bool, len(executedMigrations))
+	for _, m := range executedMigrations {
+		inProgress[m.Name] = m.InProgress
+	}
+
+	for _, name := range names {
+		started, recorded := inProgress[name]
+		if recorded && !started {
+			log.Printf("✅ Already applied: %s\n", name)
+			continue
+		}
+		// A record left in progress is completed in place, like a two-phase run completes it
+		startedAt := time.Now()
+		if started {
+			err = recorder.SetExecutedAt(ctx, name, clockNow(q.clock))
+		} else {
+			err = recorder.RecordExecutedMigration(ctx, name, clockNow(q.clock))
+		}
+		q.recordAudit(AuditRecord{Action: AuditActionMarkApplied, Migration: name}, startedAt, err)
+		if err != nil {
+			return fmt.Errorf("failed to mark migration %s as applied: %w", name, err)
+		}
+		inProgress[name] = false
+		log.Printf("✅ Marked as applied: %s\n", name)
+	}
+
+	return nil
+}
+
+// Rename changes the name an executed migration is recorded under from oldName to newName,
+// so a migration whose file was renamed is not run again. newName must be registered, and
+// oldName must be recorded as executed while newName is not.
+func (q *Qafoia) Rename(ctx context.Context, oldName string, newName string) error {
+	renamer, ok := q.driver.(HistoryRenamer)
+	if !ok {
+		return ErrRenameNotSupported
+	}
+
+	if err := q.Load(); err != nil {
+		return err
+	}
+
+	if _, found := q.migrations[newName]; !found {
+		return fmt.Errorf("%w: %s", ErrMigrationNotRegistered, newName)
+	}
+
+	if err := q.ensureMigrationsTable(ctx); err != nil {
+		return err
+	}
+
+	executedMigrations, err := q.driver.GetExecutedMigrations(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	executed := make(map[string]bool, len(executedMigrations))
+	for _, m := range executedMigrations {
+		executed[m.Name] = true
+	}
+	if !executed[oldName] {
+		return fmt.Errorf("%w: %s", ErrMigrationNotExecuted, oldName)
+	}
+	if executed[newName] {
+		return fmt.Errorf("%w: %s", ErrMigrationAlreadyExecuted, newName)
+	}
+
+	started := time.Now()
+	err = renamer.RenameExecutedMigration(ctx, oldName, newName)
+	q.recordAudit(AuditRecord{Action: AuditActionRename, Migration: newName, PreviousName: oldName}, started, err)
+	if err != nil {
+		return fmt.Errorf("failed to rename migration %s to %s: %w", oldName, newName, err)
+	}
+	log.Printf("✅ Renamed: %s -> %s\n", oldName, newName)
+
+	return nil
+}
+
+// Repair normalizes the migration table: duplicate records of a migration are replaced by a
+// single record with the earliest execution time, and records without an execution time
+// get the time of their name's timestamp prefix, or the current time. Each change is logged,
+// and with dryRun nothing is written. With two-phase recording, records without an execution
+// time are migrations left in progress, which are reported but not changed, since only a
+// check of the database can tell whether they ran.
+func (q *Qafoia) Repair(ctx context.Context, dryRun bool) error {
+	recorder, ok := q.driver.(HistoryRecorder)
+	if !ok {
+		return ErrRecordingNotSupported
+	}
+
+	if err := q.ensureMigrationsTable(ctx); err != nil {
+		return err
+	}
+
+	executedMigrations, err := q.driver.GetExecutedMigrations(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	records := make(map[string][]ExecutedMigration, len(executedMigrations))
+	var names []string
+	for _, m := range executedMigrations {
+		if _, found := records[m.Name]; !found {
+			names = append(names, m.Name)
+		}
+		records[m.Name] = append(records[m.Name], m)
+	}
+
+	prefix := ""
+	if dryRun {
+		prefix = "[dry run] "
+	}
+
+	changes := 0
+	for _, name := range names {
+		var earliest *ExecutedMigration
+		for i, m := range records[name] {
+			if m.InProgress && q.twoPhaseRecording {
+				continue
+			}
+			if earliest == nil || (!m.ExecutedAt.IsZero() && (earliest.ExecutedAt.IsZero() || m.ExecutedAt.Before(earliest.ExecutedAt))) {
+				earliest = &records[name][i]
+			}
+		}
+		if earliest == nil {
+			log.Printf("⚠️  %s is in progress; check the database and use MarkApplied or remove its record\n", name)
+			continue
+		}
+
+		executedAt := earliest.ExecutedAt
+		if executedAt.IsZero() {
+			executedAt = q.backfillExecutedAt(name)
+			log.Printf("🔧 %sSetting missing execution time of %s to %s\n", prefix, name, executedAt.Format(time.RFC3339))
+			changes++
+		}
+
+		duplicates := len(records[name]) > 1
+		if duplicates {
+			log.Printf("🔧 %sReplacing %d records of %s with one\n", prefix, len(records[name]), name)
+			changes++
+		}
+
+		if dryRun || (!duplicates && executedAt.Equal(earliest.ExecutedAt)) {
+			continue
+		}
+
+		started := time.Now()
+		if duplicates {
+			err = recorder.ReplaceExecutedMigration(ctx, name, executedAt)
+		} else {
+			err = recorder.SetExecutedAt(ctx, name, executedAt)
+		}
+		q.recordAudit(AuditRecord{Action: AuditActionRepair, Migration: name}, started, err)
+		if err != nil {
+			return fmt.Errorf("failed to repair migration %s: %w", name, err)
+		}
+	}
+
+	if changes == 0 {
+		q.logRoutine("✅ Migration table is consistent")
+	}
+
+	return nil
+}
+
+// backfillExecutedAt returns the execution time given to a migration recorded without one:
+// the time of its timestamp prefix, or the current time if it has none.
+func (q *Qafoia) backfillExecutedAt(name string) time.Time {
+	if timestamp, ok := migrationTimestamp(name); ok {
+		if at, err := time.ParseInLocation(migrationTimestampLayout, timestamp, time.Local); err == nil {
+			return at
+		}
+	}
+	return clockNow(q.clock)
+}
+
+// GenerateDiffMigration generates up and down SQL capturing the difference between the
+// current database schema and the schema of the database at targetDSN. The driver must
+// implement DiffMigrationGenerator.
+func (q *Qafoia) GenerateDiffMigration(ctx context.Context, targetDSN string) (string, string, error) {
+	generator, ok := q.driver.(DiffMigrationGenerator)
+	if !ok {
+		return "", "", ErrDiffNotSupported
+	}
+
+	return generator.GenerateDiffMigration(ctx, targetDSN)
+}
+
+// RedoOne rolls back the named migration and applies it again without touching any
+// other migration. The migration must be registered and currently applied.
+func (q *Qafoia) RedoOne(ctx context.Context, name string) error {
+	if err := q.Load(); err != nil {
+		return err
+	}
+
+	migration, found := q.migrations[name]
+	if !found {
+		return fmt.Errorf("%w: %s", ErrMigrationNotRegistered, name)
+	}
+
+	executedMigrations, err := q.driver.GetExecutedMigrations(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	applied := false
+	for _, m := range executedMigrations {
+		if m.Name == name {
+			applied = true
+		} else if q.less(name, m.Name) {
+			log.Printf("⚠️  Migration %s was applied after %s and may depend on it\n", m.Name, name)
+		}
+	}
+	if !applied {
+		return fmt.Errorf("%w: %s", ErrMigrationNotExecuted, name)
+	}
+
+	log.Printf("🔁 Redoing migration: %s\n", name)
+
+	if err := q.unapplyMigrations(ctx, []Migration{migration}, nil); err != nil {
+		return fmt.Errorf("rollback failed during redo: %w", err)
+	}
+
+	if err := q.applyMigrations(ctx, []Migration{migration}, nil); err != nil {
+		return fmt.Errorf("migration failed during redo: %w", err)
+	}
+
+	log.Printf("✅ Redo completed successfully: %s\n", name)
+	return nil
+}
+
+// logRoutine logs a message saying that nothing needed to be done or that an operation
+// completed as usual, unless Quiet is set.
+func (q *Qafoia) logRoutine(message string) {
+	if !q.quiet {
+		log.Println(message)
+	}
+}
+
+// lock takes the migration lock of the driver when LockTimeout is set and the driver supports
+// locking, and returns a function that releases it.
+func (q *Qafoia) lock(ctx context.Context) (func(), error) {
+	if q.lockTimeout <= 0 {
+		return func() {}, nil
+	}
+	locker, ok := q.driver.(MigrationLocker)
+	if !ok {
+		return nil, ErrLockingNotSupported
+	}
+
+	release, err := locker.AcquireLock(ctx, q.lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if err := release(); err != nil {
+			log.Printf("⚠️  Failed to release migration lock: %v\n", err)
+		}
+	}, nil
+}
+
+// ensureMigrationsTable creates the migration table unless automatic creation is disabled,
+// in which case the table is assumed to exist already.
+func (q *Qafoia) ensureMigrationsTable(ctx context.Context) error {
+	if q.skipCreateTable {
+		return nil
+	}
+	return q.driver.CreateMigrationsTable(ctx)
+}
+
+// PrepareAll checks that the up script of every pending migration parses against the
+// database, without running it, and returns the problems of all migrations joined together.
+// Each driver validates SQL its own way and can only catch what its database checks without
+// executing; drivers that cannot validate SQL return ErrValidationNotSupported. Migrations
+// implementing RunnableMigration or StreamedMigration, and scripts with query arguments, are
+// not checked.
+func (q *Qafoia) PrepareAll(ctx context.Context) error {
+	validator, ok := q.driver.(SQLValidator)
+	if !ok {
+		return ErrValidationNotSupported
+	}
+
+	pending, _, err := q.pendingMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, m := range pending {
+		if _, ok := m.(RunnableMigration); ok {
+			continue
+		}
+		if _, ok := m.(StreamedMigration); ok {
+			continue
+		}
+		if parameterized, ok := m.(ParameterizedMigration); ok && len(parameterized.UpArgs()) > 0 {
+			continue
+		}
+		if err := validator.ValidateSQL(ctx, m.Name(), m.UpScript()); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", m.Name(), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// VerifyReversible applies the named pending migration, rolls it back, and checks that the
+// schema returned to its prior state. The driver must support schema snapshots. Only use it
+// against a test database, as the migration is actually executed.
+func (q *Qafoia) VerifyReversible(ctx context.Context, name string) error {
+	if err := q.Load(); err != nil {
+		return err
+	}
+
+	migration, found := q.migrations[name]
+	if !found {
+		return fmt.Errorf("%w: %s", ErrMigrationNotRegistered, name)
+	}
+
+	if err := q.ensureMigrationsTable(ctx); err != nil {
+		return err
+	}
+
+	executedMigrations, err := q.driver.GetExecutedMigrations(ctx, false)
+	if err != nil {
+		return err
+	}
+	for _, m := range executedMigrations {
+		if m.Name == name {
+			return fmt.Errorf("migration %s is already applied", name)
+		}
+	}
+
+	return q.verifyReversible(ctx, migration)
+}
+
+// verifyReversible applies and rolls back a migration, comparing schema snapshots taken
+// before and after.
+func (q *Qafoia) verifyReversible(ctx context.Context, migration Migration) error {
+	snapshotter, ok := q.driver.(SchemaSnapshotter)
+	if !ok {
+		return ErrSnapshotNotSupported
+	}
+
+	before, err := snapshotter.SnapshotCurrentSchema(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot schema: %w", err)
+	}
+
+	log.Printf("🔍 Verifying reversibility: %s\n", migration.Name())
+
+	if err := q.applyMigrations(ctx, []Migration{migration}, nil); err != nil {
+		return fmt.Errorf("failed to apply migration during verification: %w", err)
+	}
+	if err := q.unapplyMigrations(ctx, []Migration{migration}, nil); err != nil {
+		return fmt.Errorf("failed to roll back migration during verification: %w", err)
+	}
+
+	after, err := snapshotter.SnapshotCurrentSchema(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot schema: %w", err)
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		difference, _ := diffSchemas(before, after, strconv.Quote)
+		if difference == "" {
+			difference = "column definitions differ"
+		}
+		return fmt.Errorf("%w: %s leaves schema changes behind: %s", ErrMigrationNotReversible, migration.Name(), difference)
+	}
+
+	return nil
+}
+
+// isBaselined reports whether the named migration sorts at or before the configured baseline.
+func (q *Qafoia) isBaselined(name string) bool {
+	return q.baseline != "" && !q.less(q.baseline, name)
+}
+
+// isExcludedByEnvironment reports whether the migration declares environments that do not
+// include the configured environment.
+func (q *Qafoia) isExcludedByEnvironment(migration Migration) bool {
+	m, ok := migration.(EnvironmentMigration)
+	if !ok {
+		return false
+	}
+	environments := m.Environments()
+	return len(environments) > 0 && !slices.Contains(environments, q.environment)
+}
+
+// sortedMigrationNames returns the names of the registered migrations in the order they are
+// applied: registration order if PreserveRegistrationOrder is set, sorted otherwise.
+func (q *Qafoia) sortedMigrationNames() []string {
+	if q.preserveOrder {
+		return slices.Clone(q.registrationOrder)
+	}
+	return getSortedMigrationName(q.migrations, q.sortFunc)
+}
+
+// checkDownScripts returns ErrMigrationNotReversible for the first migration whose down script
+// is empty or fails validation by the driver. Migrations implementing RunnableMigration or
+// StreamedMigration do not roll back with a down script string and are not checked, and
+// scripts with query arguments are only checked for being non-empty, as they cannot be
+// validated without their arguments.
+func (q *Qafoia) checkDownScripts(ctx context.Context, migrations []Migration) error {
+	validator, ok := q.driver.(SQLValidator)
+	if !ok {
+		return ErrValidationNotSupported
+	}
+
+	for _, m := range migrations {
+		if _, ok := m.(RunnableMigration); ok {
+			continue
+		}
+		if _, ok := m.(StreamedMigration); ok {
+			continue
+		}
+
+		downScript := m.DownScript()
+		if strings.TrimSpace(downScript) == "" {
+			return fmt.Errorf("%w: %s has no down script", ErrMigrationNotReversible, m.Name())
+		}
+		if parameterized, ok := m.(ParameterizedMigration); ok && len(parameterized.DownArgs()) > 0 {
+			continue
+		}
+		if err := validator.ValidateSQL(ctx, m.Name(), downScript); err != nil {
+			return fmt.Errorf("%w: %s has an invalid down script: %w", ErrMigrationNotReversible, m.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// Capabilities returns the features supported by the driver, or none if the driver does not
+// implement CapabilityProvider.
+func (q *Qafoia) Capabilities() DriverCapabilities {
+	return driverCapabilities(q.driver)
+}
+
+// checkCapabilities returns an error before anything is applied if a migration needs a
+// feature the driver reports it does not support. Drivers that do not implement
+// CapabilityProvider are left to reject such migrations themselves.
+func (q *Qafoia) checkCapabilities(migrations []Migration) error {
+	provider, ok := q.driver.(CapabilityProvider)
+	if !ok {
+		return nil
+	}
+
+	if !provider.Capabilities().CrossDatabase {
+		for _, m := range migrations {
+			if target, ok := m.(DatabaseMigration); ok && target.Database() != "" {
+				return fmt.Errorf("%w: %s", ErrDatabaseNotSupported, m.Name())
+			}
+		}
+	}
+	return nil
+}
+
+// checkEmptyUp returns ErrEmptyMigration listing the migrations whose up script is empty.
+// Migrations running Go code, loading data with COPY or streaming their scripts have no up
+// script to check.
+func checkEmptyUp(migrations []Migration) error {
+	var empty []string
+	for _, m := range migrations {
+		if _, ok := m.(RunnableMigration); ok {
+			continue
+		}
+		if _, ok := m.(CopyMigration); ok {
+			continue
+		}
+		if _, ok := m.(StreamedMigration); ok {
+			continue
+		}
+		if strings.TrimSpace(m.UpScript()) == "" {
+			empty = append(empty, m.Name())
+		}
+	}
+
+	if len(empty) > 0 {
+		return fmt.Errorf("%w: %s", ErrEmptyMigration, strings.Join(empty, ", "))
+	}
+	return nil
+}
+
+// checkDestructive returns ErrDestructiveMigration if any of the migrations has an up script
+// or hook script matching a destructive pattern without acknowledging it through
+// DestructiveMigration. The script of a StreamedMigration cannot be scanned, so such a
+// migration must implement DestructiveMigration to state whether it is destructive.
+func (q *Qafoia) checkDestructive(migrations []Migration) error {
+	var unacknowledged []string
+	for _, m := range migrations {
+		destructive, declared := m.(DestructiveMigration)
+		if declared && destructive.Destructive() {
+			continue
+		}
+		if _, streamed := m.(StreamedMigration); streamed {
+			if !declared {
+				log.Printf("⚠️  Streamed migration %s cannot be scanned and does not implement DestructiveMigration\n", m.Name())
+				unacknowledged = append(unacknowledged, m.Name())
+			}
+			continue
+		}
+		scripts := []string{m.UpScript()}
+		if hooked, ok := m.(hookedMigration); ok {
+			// Separate hook scripts run outside the up script, so they are scanned too
+			scripts = append(scripts, hooked.beforeScript(), hooked.afterScript())
+		}
+		if match := q.findDestructive(scripts); match != "" {
+			log.Printf("⚠️  Migration %s contains %q but is not marked as destructive\n", m.Name(), match)
+			unacknowledged = append(unacknowledged, m.Name())
+		}
+	}
+
+	if len(unacknowledged) > 0 {
+		return fmt.Errorf("%w: %s", ErrDestructiveMigration, strings.Join(unacknowledged, ", "))
+	}
+	return nil
+}
+
+// findDestructive returns the first match of a destructive pattern in scripts, or an empty
+// string if none of them matches.
+func (q *Qafoia) findDestructive(scripts []string) string {
+	for _, script := range scripts {
+		for _, re := range q.destructive {
+			if match := re.FindString(script); match != "" {
+				return match
+			}
+		}
+	}
+	return ""
+}
+
+// withStoredDownScripts returns ctx carrying the down script of each migration stored in the
+// migration table when it was applied, which the drivers run instead of the registered one.
+// Migrations without a stored script keep their registered down script.
+func (q *Qafoia) withStoredDownScripts(ctx context.Context, migrations []Migration) (context.Context, error) {
+	history, err := q.History(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	scripts := make(map[string]string, len(migrations))
+	for _, m := range migrations {
+		executed, _ := history.Find(m.Name())
+		downSQL, stored := executed.Metadata["down_sql"].(string)
+		_, runnable := m.(RunnableMigration)
+		_, streamed := m.(StreamedMigration)
+		if runnable || streamed || !stored {
+			if !runnable && !streamed {
+				log.Printf("⚠️  No stored down script for %s, using the registered one\n", m.Name())
+			}
+			continue
+		}
+		scripts[m.Name()] = downSQL
+	}
+
+	return withStoredDownScripts(ctx, scripts), nil
+}
+
+// less reports whether migration a is ordered before migration b. With
+// PreserveRegistrationOrder, registered migrations are ordered by registration and
+// unregistered ones fall back to name order.
+func (q *Qafoia) less(a, b string) bool {
+	if q.preserveOrder {
+		i, j := slices.Index(q.registrationOrder, a), slices.Index(q.registrationOrder, b)
+		if i >= 0 && j >= 0 {
+			return i < j
+		}
+	}
+	if q.sortFunc != nil {
+		return q.sortFunc(a, b)
+	}
+	return a < b
+}
+
+// applyMigrations applies the given migrations through the driver, logging progress.
+// If summary is not nil, it is updated with the outcome of each migration.
+func (q *Qafoia) applyMigrations(ctx context.Context, migrations []Migration, summary *runSummary) error {
+	bar := q.newProgressBar(len(migrations))
+	defer bar.finish()
+	bar.render()
+	spans := q.newMigrationSpans(ctx, "qafoia.migration.up", AuditActionApply)
+	ctx = spans.withShardAudit(ctx)
+	job := migrationJobFromContext(ctx)
+
+	return q.driver.ApplyMigrations(
+		ctx,
+		migrations,
+		func(m *Migration) {
+			spans.start(*m)
+			job.running((*m).Name())
+			if bar != nil {
+				return
+			}
+			log.Printf("📦 Migrating: %s\n", (*m).Name())
+			if q.debugSql {
+				log.Println("🧾 Running SQL:")
+				fmt.Println("================================================")
+				fmt.Println((*m).UpScript())
+				fmt.Println("================================================")
+			}
+		},
+		func(m *Migration) {
+			spans.end(*m, nil)
+			summary.succeeded()
+			job.succeeded()
+			if bar != nil {
+				bar.advance()
+				return
+			}
+			log.Printf("✅ Migrated: %s\n", (*m).Name())
+		},
+		func(m *Migration, err error) {
+			spans.end(*m, err)
+			bar.finish()
+			log.Printf("❌ Migration failed: %s - %s\n", (*m).Name(), err)
+			summary.failed()
+		},
+	)
+}
+
+// unapplyMigrations rolls back the given migrations through the driver, logging progress.
+// If summary is not nil, it is updated with the outcome of each migration.
+func (q *Qafoia) unapplyMigrations(ctx context.Context, migrations []Migration, summary *runSummary) error {
+	bar := q.newProgressBar(len(migrations))
+	defer bar.finish()
+	bar.render()
+	spans := q.newMigrationSpans(ctx, "qafoia.migration.down", AuditActionRollback)
+	ctx = spans.withShardAudit(ctx)
+
+	return q.driver.UnapplyMigrations(
+		ctx,
+		migrations,
+		func(m *Migration) {
+			spans.start(*m)
+			if bar != nil {
+				return
+			}
+			log.Printf("🔄 Rolling back: %s\n", (*m).Name())
+			if q.debugSql {
+				log.Println("🧾 Running SQL:")
+				fmt.Println("================================================")
+				fmt.Println(downScript(ctx, *m))
+				fmt.Println("================================================")
+			}
+		},
+		func(m *Migration) {
+			spans.end(*m, nil)
+			summary.succeeded()
+			if bar != nil {
+				bar.advance()
+				return
+			}
+			log.Printf("✅ Rolled back: %s\n", (*m).Name())
+		},
+		func(m *Migration, err error) {
+			spans.end(*m, err)
+			bar.finish()
+			log.Printf("❌ Rollback failed: %s - %s\n", (*m).Name(), err)
+			summary.failed()
+		},
+	)
+}
+
+// newProgressBar returns a progress bar for total migrations when progress output is enabled,
+// or nil to fall back to line-by-line logging. SQL debugging always uses line-by-line logging.
+func (q *Qafoia) newProgressBar(total int) *progressBar {
+	if q.progressOut == nil || q.debugSql {
+		return nil
+	}
+	return newProgressBar(q.progressOut, total)
 }
@@ -1,11 +1,19 @@
 package qafoia
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -39,11 +47,17 @@ func (m *mockDriver) UnapplyMigrations(ctx context.Context, migrations []Migrati
 	return args.Error(0)
 }
 
-func (m *mockDriver) CleanDatabase(ctx context.Context) error {
-	args := m.Called(ctx)
+func (m *mockDriver) ExecuteSQL(ctx context.Context, sql string) error {
+	args := m.Called(ctx, sql)
 	return args.Error(0)
 }
 
+func (m *mockDriver) CleanDatabase(ctx context.Context) ([]string, error) {
+	args := m.Called(ctx)
+	dropped, _ := args.Get(0).([]string)
+	return dropped, args.Error(1)
+}
+
 func TestQafoia_New_ErrorNilConfig(t *testing.T) {
 	q, err := New(nil)
 	assert.Nil(t, q)
@@ -70,6 +84,46 @@ func TestQafoia_Register_Duplicate(t *testing.T) {
 	assert.Contains(t, err.Error(), "registered more than once")
 }
 
+func TestQafoia_Register_DuplicateTimestampWarns(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	q := &Qafoia{migrations: make(map[string]Migration)}
+
+	err := q.Register(
+		dummyMigration{name: "20240426123456_create_users"},
+		dummyMigration{name: "20240426123456_create_roles"},
+	)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "share the same timestamp 20240426123456")
+}
+
+func TestQafoia_RegisterAll(t *testing.T) {
+	q := &Qafoia{migrations: make(map[string]Migration)}
+	assert.NoError(t, q.Register(dummyMigration{name: "20240101000000_create_users"}))
+
+	err := q.RegisterAll([]Migration{
+		dummyMigration{name: "20240102000000_create_roles"},
+		dummyMigration{name: "20240102000000_create_roles"},
+		dummyMigration{name: "create_orders"},
+		dummyMigration{name: "20241399000000_create_items"},
+		dummyMigration{name: "20240101000000_create_teams"},
+	})
+	assert.ErrorContains(t, err, "migration 20240102000000_create_roles registered more than once")
+	assert.ErrorContains(t, err, "migration create_orders: name has no timestamp prefix")
+	assert.ErrorContains(t, err, "migration 20241399000000_create_items: invalid timestamp 20241399000000")
+	assert.ErrorContains(t, err, "migrations 20240101000000_create_users and 20240101000000_create_teams share the same timestamp")
+	assert.Len(t, q.migrations, 1)
+
+	err = q.RegisterAll([]Migration{
+		dummyMigration{name: "20240102000000_create_roles"},
+		dummyMigration{name: "20240103000000_create_orders"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"20240101000000_create_users", "20240102000000_create_roles", "20240103000000_create_orders"}, q.registrationOrder)
+}
+
 func TestQafoia_Migrate_NoMigrations(t *testing.T) {
 	ctx := context.TODO()
 	driver := new(mockDriver)
@@ -86,10 +140,169 @@ func TestQafoia_Migrate_NoMigrations(t *testing.T) {
 	driver.AssertExpectations(t)
 }
 
+func TestQafoia_Migrate_SkipCreateTable(t *testing.T) {
+	ctx := context.TODO()
+	driver := new(mockDriver)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+
+	q := &Qafoia{
+		driver:          driver,
+		migrations:      map[string]Migration{},
+		skipCreateTable: true,
+	}
+
+	err := q.Migrate(ctx)
+	assert.NoError(t, err)
+	driver.AssertNotCalled(t, "CreateMigrationsTable", ctx)
+	driver.AssertExpectations(t)
+}
+
+func TestQafoia_Migrate_Baseline(t *testing.T) {
+	ctx := context.TODO()
+	pending := dummyMigration{name: "003_create_permissions"}
+
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+	driver.On("ApplyMigrations", ctx, []Migration{pending}).Return(nil)
+
+	q := &Qafoia{
+		driver: driver,
+		migrations: map[string]Migration{
+			"001_create_users":       dummyMigration{name: "001_create_users"},
+			"002_create_roles":       dummyMigration{name: "002_create_roles"},
+			"003_create_permissions": pending,
+		},
+		baseline: "002_create_roles",
+	}
+
+	err := q.Migrate(ctx)
+	assert.NoError(t, err)
+	driver.AssertExpectations(t)
+
+	list, err := q.List(ctx)
+	assert.NoError(t, err)
+	assert.True(t, list[0].IsBaselined)
+	assert.True(t, list[1].IsBaselined)
+	assert.False(t, list[2].IsBaselined)
+}
+
+type environmentMigration struct {
+	dummyMigration
+	environments []string
+}
+
+func (m environmentMigration) Environments() []string {
+	return m.environments
+}
+
+func TestQafoia_Migrate_Environment(t *testing.T) {
+	ctx := context.TODO()
+	everywhere := dummyMigration{name: "001_create_users"}
+	testOnly := environmentMigration{dummyMigration{name: "002_seed_users"}, []string{"test"}}
+	unrestricted := environmentMigration{dummyMigration{name: "003_create_roles"}, nil}
+
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+	driver.On("ApplyMigrations", ctx, []Migration{everywhere, unrestricted}).Return(nil)
+
+	q := &Qafoia{
+		driver: driver,
+		migrations: map[string]Migration{
+			"001_create_users": everywhere,
+			"002_seed_users":   testOnly,
+			"003_create_roles": unrestricted,
+		},
+		environment: "production",
+	}
+
+	err := q.Migrate(ctx)
+	assert.NoError(t, err)
+	driver.AssertExpectations(t)
+
+	list, err := q.List(ctx)
+	assert.NoError(t, err)
+	assert.False(t, list[0].IsSkippedForEnvironment)
+	assert.True(t, list[1].IsSkippedForEnvironment)
+	assert.Equal(t, "skipped: env", list[1].executionStatus())
+	assert.False(t, list[2].IsSkippedForEnvironment)
+
+	q.environment = "test"
+	assert.False(t, q.isExcludedByEnvironment(testOnly))
+}
+
+func TestQafoia_Migrate_PreAndPostSQL(t *testing.T) {
+	ctx := context.TODO()
+	migration := dummyMigration{name: "001_create_users"}
+
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+	driver.On("ExecuteSQL", ctx, "UPDATE settings SET maintenance = true").Return(nil).Once()
+	driver.On("ApplyMigrations", ctx, []Migration{migration}).Return(nil).Once()
+	driver.On("ExecuteSQL", ctx, "ANALYZE").Return(nil).Once()
+
+	q := &Qafoia{
+		driver:         driver,
+		migrations:     map[string]Migration{"001_create_users": migration},
+		preMigrateSQL:  []string{"UPDATE settings SET maintenance = true"},
+		postMigrateSQL: []string{"ANALYZE"},
+	}
+
+	err := q.Migrate(ctx)
+	assert.NoError(t, err)
+	driver.AssertExpectations(t)
+}
+
+func TestQafoia_migrate_Summary(t *testing.T) {
+	ctx := context.TODO()
+	pending := dummyMigration{name: "002_create_roles"}
+
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{{Name: "001_create_users"}}, nil)
+	driver.On("ApplyMigrations", ctx, []Migration{pending}).Return(nil)
+
+	q := &Qafoia{
+		driver: driver,
+		migrations: map[string]Migration{
+			"001_create_users": dummyMigration{name: "001_create_users"},
+			"002_create_roles": pending,
+		},
+	}
+
+	summary, err := q.migrate(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, summary.Skipped)
+	assert.Equal(t, 0, summary.Failed)
+	driver.AssertExpectations(t)
+}
+
+func TestQafoia_Migrate_PostSQLSkippedOnFailure(t *testing.T) {
+	ctx := context.TODO()
+	migration := dummyMigration{name: "001_create_users"}
+
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+	driver.On("ApplyMigrations", ctx, []Migration{migration}).Return(errors.New("apply error"))
+
+	q := &Qafoia{
+		driver:         driver,
+		migrations:     map[string]Migration{"001_create_users": migration},
+		postMigrateSQL: []string{"ANALYZE"},
+	}
+
+	err := q.Migrate(ctx)
+	assert.Error(t, err)
+	driver.AssertNotCalled(t, "ExecuteSQL", ctx, "ANALYZE")
+}
+
 func TestQafoia_Fresh_Success(t *testing.T) {
 	ctx := context.TODO()
 	driver := new(mockDriver)
-	driver.On("CleanDatabase", ctx).Return(nil)
+	driver.On("CleanDatabase", ctx).Return([]string{"users"}, nil)
 	driver.On("CreateMigrationsTable", ctx).Return(nil)
 	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
 
@@ -117,53 +330,1356 @@ func TestQafoia_Reset_NoExecuted(t *testing.T) {
 	driver.AssertExpectations(t)
 }
 
-func TestQafoia_Clean_Error(t *testing.T) {
+func TestQafoia_MigrateBefore(t *testing.T) {
 	ctx := context.TODO()
+	approved := dummyMigration{name: "20250101120000_create_users"}
+	staged := dummyMigration{name: "20250301120000_create_orders"}
+	untimed := dummyMigration{name: "create_roles"}
+
 	driver := new(mockDriver)
-	driver.On("CleanDatabase", ctx).Return(errors.New("clean error"))
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+	driver.On("ApplyMigrations", ctx, []Migration{approved}).Return(nil)
 
-	q := &Qafoia{
-		driver: driver,
-	}
+	q := &Qafoia{driver: driver, migrations: map[string]Migration{
+		approved.name: approved,
+		staged.name:   staged,
+		untimed.name:  untimed,
+	}}
 
-	err := q.Clean(ctx)
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to clean database")
+	err := q.MigrateBefore(ctx, time.Date(2025, 2, 1, 0, 0, 0, 0, time.Local))
+	assert.NoError(t, err)
 	driver.AssertExpectations(t)
 }
 
-func TestQafoia_List(t *testing.T) {
+func TestQafoia_Migrate_FailOnOrphans(t *testing.T) {
 	ctx := context.TODO()
 	driver := new(mockDriver)
 	driver.On("CreateMigrationsTable", ctx).Return(nil)
-	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{{Name: "001_create_users", ExecutedAt: time.Now()}}, nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{
+		{Name: "001_create_users"},
+		{Name: "003_create_permissions"},
+	}, nil)
 
-	migration := dummyMigration{name: "001_create_users"}
-	q := &Qafoia{
-		driver:     driver,
-		migrations: map[string]Migration{"001_create_users": migration},
+	q := &Qafoia{driver: driver, failOnOrphans: true, migrations: map[string]Migration{
+		"001_create_users": dummyMigration{name: "001_create_users"},
+		"002_create_roles": dummyMigration{name: "002_create_roles"},
+	}}
+
+	err := q.Migrate(ctx)
+	assert.ErrorIs(t, err, ErrOrphanedMigrations)
+	assert.ErrorContains(t, err, "003_create_permissions")
+	driver.AssertNotCalled(t, "ApplyMigrations", mock.Anything, mock.Anything)
+}
+
+type validatingMockDriver struct {
+	*mockDriver
+	invalid map[string]bool
+}
+
+func (d *validatingMockDriver) ValidateSQL(ctx context.Context, name string, script string) error {
+	if d.invalid[script] {
+		return errors.New("syntax error")
 	}
+	return nil
+}
 
-	list, err := q.List(ctx)
+func TestQafoia_Migrate_DisallowEmptyUp(t *testing.T) {
+	ctx := context.TODO()
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+
+	q := &Qafoia{driver: driver, disallowEmptyUp: true, migrations: map[string]Migration{
+		"001_create_users": dummyMigration{name: "001_create_users"},
+		"002_add_index":    &mockMigrationMySqlDriver{name: "002_add_index", up: "\n  "},
+		"003_reencrypt":    &mockRunnableMigrationMySqlDriver{mockMigrationMySqlDriver: mockMigrationMySqlDriver{name: "003_reencrypt"}},
+	}}
+
+	err := q.Migrate(ctx)
+	assert.ErrorIs(t, err, ErrEmptyMigration)
+	assert.EqualError(t, err, "migration has an empty up script: 002_add_index")
+	driver.AssertNotCalled(t, "ApplyMigrations", mock.Anything, mock.Anything)
+}
+
+func TestQafoia_Migrate_RequireReversible(t *testing.T) {
+	ctx := context.TODO()
+	valid := dummyMigration{name: "001_create_users"}
+	noDown := &mockMigrationMySqlDriver{name: "002_create_roles", up: "CREATE TABLE roles (id INT);", down: " "}
+	brokenDown := &mockMigrationMySqlDriver{name: "002_create_roles", up: "CREATE TABLE roles (id INT);", down: "DROP TABEL roles;"}
+
+	driver := &validatingMockDriver{mockDriver: new(mockDriver), invalid: map[string]bool{"DROP TABEL roles;": true}}
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+	driver.On("ApplyMigrations", ctx, []Migration{valid}).Return(nil)
+
+	q := &Qafoia{driver: driver, requireReversible: true, migrations: map[string]Migration{
+		"001_create_users": valid,
+		"002_create_roles": noDown,
+	}}
+	err := q.Migrate(ctx)
+	assert.ErrorIs(t, err, ErrMigrationNotReversible)
+	assert.ErrorContains(t, err, "002_create_roles has no down script")
+
+	q.migrations["002_create_roles"] = brokenDown
+	err = q.Migrate(ctx)
+	assert.ErrorIs(t, err, ErrMigrationNotReversible)
+	assert.ErrorContains(t, err, "syntax error")
+	driver.AssertNotCalled(t, "ApplyMigrations", mock.Anything, mock.Anything)
+
+	delete(q.migrations, "002_create_roles")
+	assert.NoError(t, q.Migrate(ctx))
+	driver.AssertExpectations(t)
+
+	q.driver = new(mockDriver)
+	assert.ErrorIs(t, q.checkDownScripts(ctx, []Migration{valid}), ErrValidationNotSupported)
+}
+
+func TestQafoia_PrepareAll(t *testing.T) {
+	ctx := context.TODO()
+	driver := &validatingMockDriver{mockDriver: new(mockDriver), invalid: map[string]bool{
+		"CREAT TABLE roles (id INT);":    true,
+		"ALTER TABLE users ADD COLUM x;": true,
+	}}
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{{Name: "001_create_users"}}, nil)
+
+	q := &Qafoia{driver: driver, migrations: map[string]Migration{
+		"001_create_users": &mockMigrationMySqlDriver{name: "001_create_users", up: "CREAT TABLE roles (id INT);"},
+		"002_create_roles": &mockMigrationMySqlDriver{name: "002_create_roles", up: "CREAT TABLE roles (id INT);"},
+		"003_add_column":   &mockMigrationMySqlDriver{name: "003_add_column", up: "ALTER TABLE users ADD COLUM x;"},
+		"004_add_index":    &mockMigrationMySqlDriver{name: "004_add_index", up: "CREATE INDEX idx ON users (id);"},
+	}}
+
+	err := q.PrepareAll(ctx)
+	assert.ErrorContains(t, err, "002_create_roles: syntax error")
+	assert.ErrorContains(t, err, "003_add_column: syntax error")
+	assert.NotContains(t, err.Error(), "001_create_users")
+	assert.NotContains(t, err.Error(), "004_add_index")
+
+	q.driver = new(mockDriver)
+	assert.ErrorIs(t, q.PrepareAll(ctx), ErrValidationNotSupported)
+}
+
+func TestQafoia_PlannedOrder(t *testing.T) {
+	ctx := context.TODO()
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{{Name: "002_create_roles"}}, nil)
+
+	q := &Qafoia{driver: driver, baseline: "001_create_users", migrations: map[string]Migration{
+		"001_create_users":       dummyMigration{name: "001_create_users"},
+		"002_create_roles":       dummyMigration{name: "002_create_roles"},
+		"003_create_permissions": dummyMigration{name: "003_create_permissions"},
+		"004_create_orders":      dummyMigration{name: "004_create_orders"},
+	}}
+
+	names, err := q.PlannedOrder(ctx)
 	assert.NoError(t, err)
-	assert.Len(t, list, 1)
-	assert.True(t, list[0].IsExecuted)
+	assert.Equal(t, []string{"003_create_permissions", "004_create_orders"}, names)
+	driver.AssertNotCalled(t, "ApplyMigrations", mock.Anything, mock.Anything)
+}
+
+func TestQafoia_RollbackPlan(t *testing.T) {
+	ctx := context.TODO()
+	driver := new(mockDriver)
+	driver.On("GetExecutedMigrations", ctx, true).Return([]ExecutedMigration{
+		{Name: "003_create_permissions"},
+		{Name: "002_removed"},
+		{Name: "001_create_users"},
+	}, nil)
+
+	q := &Qafoia{driver: driver, migrations: map[string]Migration{
+		"001_create_users":       dummyMigration{name: "001_create_users"},
+		"003_create_permissions": dummyMigration{name: "003_create_permissions"},
+	}}
+
+	names, err := q.RollbackPlan(ctx, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"003_create_permissions", "001_create_users"}, names)
+
+	q.onMissing = MissingMigrationRemoveRecord
+	names, err = q.RollbackPlan(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"003_create_permissions", "002_removed"}, names)
+
+	q.onMissing = MissingMigrationError
+	_, err = q.RollbackPlan(ctx, 2)
+	assert.ErrorIs(t, err, ErrMigrationNotRegistered)
+
+	_, err = q.RollbackPlan(ctx, 0)
+	assert.ErrorIs(t, err, ErrInvalidRollbackStep)
+	driver.AssertNotCalled(t, "UnapplyMigrations", mock.Anything, mock.Anything)
+}
+
+func TestQafoia_RollbackOnBatchFailure(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	q := &Qafoia{driver: driver, rollbackOnFailure: true, migrations: map[string]Migration{
+		"001_create_users":  &mockMigrationMySqlDriver{name: "001_create_users", up: "CREATE TABLE users (id INT);", down: "DROP TABLE users;"},
+		"002_create_orders": &mockMigrationMySqlDriver{name: "002_create_orders", up: "CREATE TABLE orders (id INT);", down: "DROP TABLE orders;"},
+		"003_create_items":  &mockMigrationMySqlDriver{name: "003_create_items", up: "CREATE TABLE items (id INT);", down: "DROP TABLE items;"},
+		"004_create_tags":   &mockMigrationMySqlDriver{name: "004_create_tags", up: "CREATE TABLE tags (id INT);", down: "DROP TABLE tags;"},
+	}}
+
+	// 001 was applied by an earlier run and must stay applied
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT name, executed_at FROM migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "executed_at"}).AddRow("001_create_users", time.Now()))
+	mock.ExpectExec("CREATE TABLE orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO migrations").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("CREATE TABLE items").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO migrations").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("CREATE TABLE tags").WillReturnError(errors.New("syntax error"))
+	mock.ExpectQuery("SELECT name, executed_at FROM migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "executed_at"}).
+			AddRow("001_create_users", time.Now()).
+			AddRow("002_create_orders", time.Now()).
+			AddRow("003_create_items", time.Now()))
+	mock.ExpectExec("DROP TABLE items").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM migrations").WithArgs("", "003_create_items").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DROP TABLE orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM migrations").WithArgs("", "002_create_orders").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	summary, err := q.migrate(context.Background())
+	assert.ErrorContains(t, err, "syntax error")
+	assert.Equal(t, 0, summary.Applied)
+	assert.Equal(t, 1, summary.Failed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQafoia_MigrateStep(t *testing.T) {
+	ctx := context.TODO()
+	next := dummyMigration{name: "002_create_roles"}
+
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{{Name: "001_create_users"}}, nil)
+	driver.On("ApplyMigrations", ctx, []Migration{next}).Return(nil)
+
+	q := &Qafoia{driver: driver, migrations: map[string]Migration{
+		"001_create_users":       dummyMigration{name: "001_create_users"},
+		"002_create_roles":       next,
+		"003_create_permissions": dummyMigration{name: "003_create_permissions"},
+	}}
+
+	summary, err := q.migrateStep(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, summary.Skipped)
 	driver.AssertExpectations(t)
+
+	assert.ErrorIs(t, q.MigrateStep(ctx, 0), ErrInvalidMigrateStep)
 }
 
-// dummyMigration is a simple implementation of the Migration interface for testing.
-type dummyMigration struct {
-	name string
+func TestQafoia_MigrateTo(t *testing.T) {
+	ctx := context.TODO()
+	users := dummyMigration{name: "001_create_users"}
+	roles := dummyMigration{name: "002_create_roles"}
+	latest := dummyMigration{name: "latest"}
+
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+	driver.On("ApplyMigrations", ctx, []Migration{users, roles}).Return(nil).Once()
+	driver.On("ApplyMigrations", ctx, []Migration{users, roles, latest}).Return(nil).Once()
+
+	q := &Qafoia{driver: driver, migrations: map[string]Migration{
+		"001_create_users": users,
+		"002_create_roles": roles,
+		"latest":           latest,
+	}}
+
+	assert.NoError(t, q.MigrateTo(ctx, "002_create_roles"))
+	assert.NoError(t, q.MigrateTo(ctx, TargetLatest))
+	assert.ErrorIs(t, q.MigrateTo(ctx, "003_create_permissions"), ErrMigrationNotRegistered)
+	driver.AssertExpectations(t)
 }
 
-func (d dummyMigration) Name() string {
-	return d.name
+func TestQafoia_RollbackTo(t *testing.T) {
+	ctx := context.TODO()
+	users := dummyMigration{name: "001_create_users"}
+	roles := dummyMigration{name: "002_create_roles"}
+	permissions := dummyMigration{name: "003_create_permissions"}
+	executed := []ExecutedMigration{{Name: "001_create_users"}, {Name: "002_create_roles"}, {Name: "003_create_permissions"}}
+
+	driver := new(mockDriver)
+	driver.On("GetExecutedMigrations", ctx, false).Return(executed, nil)
+	driver.On("GetExecutedMigrations", ctx, true).Return([]ExecutedMigration{executed[2], executed[1], executed[0]}, nil)
+	driver.On("UnapplyMigrations", ctx, []Migration{permissions, roles}).Return(nil).Once()
+	driver.On("UnapplyMigrations", ctx, []Migration{permissions, roles, users}).Return(nil).Once()
+
+	q := &Qafoia{driver: driver, migrations: map[string]Migration{
+		"001_create_users":       users,
+		"002_create_roles":       roles,
+		"003_create_permissions": permissions,
+	}}
+
+	assert.NoError(t, q.RollbackTo(ctx, "001_create_users"))
+	assert.NoError(t, q.RollbackTo(ctx, TargetBase))
+	assert.ErrorIs(t, q.RollbackTo(ctx, "004_create_teams"), ErrMigrationNotExecuted)
+	driver.AssertExpectations(t)
 }
 
-func (d dummyMigration) UpScript() string {
-	return "CREATE TABLE dummy (id INT);"
+type versionedMockDriver struct {
+	*mockDriver
+	versions map[string]int
 }
 
-func (d dummyMigration) DownScript() string {
-	return "DROP TABLE dummy;"
+func (d *versionedMockDriver) ReadVersions(ctx context.Context) (map[string]int, error) {
+	return d.versions, nil
+}
+
+func TestQafoia_RollbackToVersion(t *testing.T) {
+	ctx := context.TODO()
+	users := dummyMigration{name: "001_create_users"}
+	roles := dummyMigration{name: "002_create_roles"}
+	permissions := dummyMigration{name: "003_create_permissions"}
+	executed := []ExecutedMigration{{Name: "001_create_users"}, {Name: "002_create_roles"}, {Name: "003_create_permissions"}}
+
+	// 002_create_roles was rolled back and applied again, so it has the highest version
+	driver := &versionedMockDriver{mockDriver: new(mockDriver), versions: map[string]int{
+		"001_create_users":       1,
+		"002_create_roles":       4,
+		"003_create_permissions": 3,
+	}}
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return(executed, nil)
+	driver.On("GetExecutedMigrations", ctx, true).Return([]ExecutedMigration{executed[2], executed[1], executed[0]}, nil)
+	driver.On("UnapplyMigrations", ctx, []Migration{roles}).Return(nil).Once()
+	driver.On("UnapplyMigrations", ctx, []Migration{permissions, roles, users}).Return(nil).Once()
+
+	q := &Qafoia{driver: driver, migrations: map[string]Migration{
+		"001_create_users":       users,
+		"002_create_roles":       roles,
+		"003_create_permissions": permissions,
+	}}
+
+	version, err := q.CurrentVersion(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, version)
+
+	assert.NoError(t, q.RollbackTo(ctx, "3"))
+	assert.NoError(t, q.RollbackTo(ctx, "0"))
+	assert.ErrorIs(t, q.RollbackTo(ctx, "2"), ErrMigrationNotExecuted)
+	driver.AssertExpectations(t)
+
+	q.driver = new(mockDriver)
+	_, err = q.CurrentVersion(ctx)
+	assert.ErrorIs(t, err, ErrVersionsNotSupported)
+}
+
+func TestQafoia_SafeMode(t *testing.T) {
+	ctx := context.TODO()
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+
+	patterns, err := compileDestructivePatterns(nil)
+	assert.NoError(t, err)
+
+	dropUsers := &destructiveMigration{mockMigrationMySqlDriver{name: "001_drop_users", up: "drop  table users;"}, false}
+	q := &Qafoia{driver: driver, safeMode: true, destructive: patterns, migrations: map[string]Migration{
+		"001_drop_users": dropUsers,
+	}}
+
+	err = q.Migrate(ctx)
+	assert.ErrorIs(t, err, ErrDestructiveMigration)
+	assert.ErrorContains(t, err, "001_drop_users")
+	driver.AssertNotCalled(t, "ApplyMigrations", mock.Anything, mock.Anything)
+
+	dropUsers.acknowledged = true
+	driver.On("ApplyMigrations", ctx, []Migration{dropUsers}).Return(nil)
+
+	err = q.Migrate(ctx)
+	assert.NoError(t, err)
+	driver.AssertExpectations(t)
+}
+
+// declaredStreamedMigration is a streamed migration that states whether it is destructive.
+type declaredStreamedMigration struct {
+	streamedMigrationMySqlDriver
+	destructive bool
+}
+
+func (m *declaredStreamedMigration) Destructive() bool {
+	return m.destructive
+}
+
+func TestQafoia_SafeMode_StreamedMigration(t *testing.T) {
+	ctx := context.TODO()
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+
+	patterns, err := compileDestructivePatterns(nil)
+	assert.NoError(t, err)
+
+	seed := &streamedMigrationMySqlDriver{mockMigrationMySqlDriver{name: "001_seed"}}
+	q := &Qafoia{driver: driver, safeMode: true, destructive: patterns, migrations: map[string]Migration{
+		"001_seed": seed,
+	}}
+
+	err = q.Migrate(ctx)
+	assert.ErrorIs(t, err, ErrDestructiveMigration)
+	driver.AssertNotCalled(t, "ApplyMigrations", mock.Anything, mock.Anything)
+
+	declared := &declaredStreamedMigration{*seed, false}
+	q.migrations = map[string]Migration{"001_seed": declared}
+	driver.On("ApplyMigrations", ctx, []Migration{declared}).Return(nil)
+
+	err = q.Migrate(ctx)
+	assert.NoError(t, err)
+	driver.AssertExpectations(t)
+}
+
+func TestQafoia_SafeMode_HookScripts(t *testing.T) {
+	ctx := context.TODO()
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+
+	patterns, err := compileDestructivePatterns(nil)
+	assert.NoError(t, err)
+
+	backfill := &fileMigration{file: MigrationFile{
+		Name:     "001_backfill",
+		UpSql:    []byte("UPDATE users SET active = true;"),
+		AfterSql: []byte("DROP TABLE users_backup;"),
+	}}
+	q := &Qafoia{driver: driver, safeMode: true, destructive: patterns, migrations: map[string]Migration{
+		"001_backfill": backfill,
+	}}
+
+	err = q.Migrate(ctx)
+	assert.ErrorIs(t, err, ErrDestructiveMigration)
+	assert.ErrorContains(t, err, "001_backfill")
+	driver.AssertNotCalled(t, "ExecuteSQL", mock.Anything, mock.Anything)
+	driver.AssertNotCalled(t, "ApplyMigrations", mock.Anything, mock.Anything)
+}
+
+func TestCompileDestructivePatterns_Invalid(t *testing.T) {
+	_, err := compileDestructivePatterns([]string{"DELETE ("})
+	assert.ErrorContains(t, err, "invalid destructive pattern")
+}
+
+func TestQafoia_Rollback_FromStored(t *testing.T) {
+	ctx := context.TODO()
+	driver := &historyMockDriver{mockDriver: new(mockDriver), history: MigrationHistory{
+		{Name: "001_create_users", Metadata: map[string]any{"down_sql": "DROP TABLE users;"}},
+		{Name: "002_create_orders", Metadata: map[string]any{"down_sql": nil}},
+	}}
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, true).Return([]ExecutedMigration{
+		{Name: "002_create_orders"},
+		{Name: "001_create_users"},
+	}, nil)
+
+	users := dummyMigration{name: "001_create_users"}
+	orders := dummyMigration{name: "002_create_orders"}
+	storedCtx := mock.MatchedBy(func(ctx context.Context) bool {
+		return downScript(ctx, users) == "DROP TABLE users;" && downScript(ctx, orders) == orders.DownScript()
+	})
+	driver.On("UnapplyMigrations", storedCtx, []Migration{orders, users}).Return(nil)
+
+	q := &Qafoia{driver: driver, fromStored: true, migrations: map[string]Migration{
+		"001_create_users":  users,
+		"002_create_orders": orders,
+	}}
+
+	err := q.Rollback(ctx, 2)
+	assert.NoError(t, err)
+	driver.AssertExpectations(t)
+}
+
+func TestQafoia_RollbackMatching(t *testing.T) {
+	ctx := context.TODO()
+	first := dummyMigration{name: "20240601090000_create_feature"}
+	second := dummyMigration{name: "20240601100000_alter_feature"}
+	later := dummyMigration{name: "20240602090000_create_orders"}
+
+	driver := new(mockDriver)
+	driver.On("GetExecutedMigrations", ctx, true).Return([]ExecutedMigration{
+		{Name: later.name},
+		{Name: second.name},
+		{Name: first.name},
+	}, nil)
+	driver.On("UnapplyMigrations", ctx, []Migration{second, first}).Return(nil)
+
+	q := &Qafoia{driver: driver, migrations: map[string]Migration{
+		first.name:  first,
+		second.name: second,
+		later.name:  later,
+	}}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	err := q.RollbackMatching(ctx, "^20240601")
+	assert.NoError(t, err)
+	driver.AssertExpectations(t)
+	assert.Contains(t, logs.String(), "20240602090000_create_orders stays applied after rolled back 20240601100000_alter_feature")
+
+	err = q.RollbackMatching(ctx, "(")
+	assert.ErrorIs(t, err, ErrInvalidRollbackPattern)
+}
+
+func TestQafoia_Rollback_CustomSortFunc(t *testing.T) {
+	ctx := context.TODO()
+	driver := new(mockDriver)
+
+	// Lexicographic descending order as returned by the drivers
+	driver.On("GetExecutedMigrations", ctx, true).Return([]ExecutedMigration{
+		{Name: "9_create_roles"},
+		{Name: "10_add_index"},
+	}, nil)
+
+	latest := dummyMigration{name: "10_add_index"}
+	driver.On("UnapplyMigrations", ctx, []Migration{latest}).Return(nil)
+
+	q := &Qafoia{
+		driver: driver,
+		migrations: map[string]Migration{
+			"9_create_roles": dummyMigration{name: "9_create_roles"},
+			"10_add_index":   latest,
+		},
+		sortFunc: func(a, b string) bool {
+			numericPrefix := func(name string) int {
+				n, _ := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+				return n
+			}
+			return numericPrefix(a) < numericPrefix(b)
+		},
+	}
+
+	err := q.Rollback(ctx, 1)
+	assert.NoError(t, err)
+	driver.AssertExpectations(t)
+}
+
+func TestQafoia_RedoOne(t *testing.T) {
+	ctx := context.TODO()
+	migration := dummyMigration{name: "001_create_users"}
+
+	driver := new(mockDriver)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{
+		{Name: "001_create_users"},
+		{Name: "002_create_roles"},
+	}, nil)
+	driver.On("UnapplyMigrations", ctx, []Migration{migration}).Return(nil).Once()
+	driver.On("ApplyMigrations", ctx, []Migration{migration}).Return(nil).Once()
+
+	q := &Qafoia{
+		driver: driver,
+		migrations: map[string]Migration{
+			"001_create_users": migration,
+			"002_create_roles": dummyMigration{name: "002_create_roles"},
+		},
+	}
+
+	err := q.RedoOne(ctx, "001_create_users")
+	assert.NoError(t, err)
+	driver.AssertExpectations(t)
+}
+
+func TestQafoia_RedoOne_NotRegistered(t *testing.T) {
+	q := &Qafoia{driver: new(mockDriver), migrations: map[string]Migration{}}
+
+	err := q.RedoOne(context.TODO(), "001_create_users")
+	assert.ErrorIs(t, err, ErrMigrationNotRegistered)
+}
+
+func TestQafoia_RedoOne_NotExecuted(t *testing.T) {
+	ctx := context.TODO()
+	driver := new(mockDriver)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+
+	q := &Qafoia{
+		driver:     driver,
+		migrations: map[string]Migration{"001_create_users": dummyMigration{name: "001_create_users"}},
+	}
+
+	err := q.RedoOne(ctx, "001_create_users")
+	assert.ErrorIs(t, err, ErrMigrationNotExecuted)
+}
+
+func TestQafoia_Clean_Error(t *testing.T) {
+	ctx := context.TODO()
+	driver := new(mockDriver)
+	driver.On("CleanDatabase", ctx).Return(nil, errors.New("clean error"))
+
+	q := &Qafoia{
+		driver: driver,
+	}
+
+	err := q.Clean(ctx)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to clean database")
+	driver.AssertExpectations(t)
+}
+
+func TestQafoia_List(t *testing.T) {
+	ctx := context.TODO()
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{{Name: "001_create_users", ExecutedAt: time.Now()}}, nil)
+
+	migration := dummyMigration{name: "001_create_users"}
+	q := &Qafoia{
+		driver:     driver,
+		migrations: map[string]Migration{"001_create_users": migration},
+	}
+
+	list, err := q.List(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	assert.True(t, list[0].IsExecuted)
+	driver.AssertExpectations(t)
+}
+
+func TestQafoia_InProgressMigration(t *testing.T) {
+	ctx := context.TODO()
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{{Name: "001_create_users", InProgress: true}}, nil)
+
+	q := &Qafoia{
+		driver:     driver,
+		migrations: map[string]Migration{"001_create_users": dummyMigration{name: "001_create_users"}},
+	}
+
+	list, err := q.List(ctx)
+	assert.NoError(t, err)
+	assert.False(t, list[0].IsExecuted)
+	assert.True(t, list[0].IsInProgress)
+	assert.Nil(t, list[0].ExecutedAt)
+	assert.Equal(t, "in progress", list[0].executionStatus())
+
+	err = q.Migrate(ctx)
+	assert.ErrorIs(t, err, ErrMigrationInProgress)
+	driver.AssertNotCalled(t, "ApplyMigrations", mock.Anything, mock.Anything)
+}
+
+func TestQafoia_Init(t *testing.T) {
+	ctx := context.TODO()
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+
+	q := &Qafoia{driver: driver, skipCreateTable: true}
+
+	err := q.Init(ctx)
+	assert.NoError(t, err)
+	driver.AssertExpectations(t)
+}
+
+func TestQafoia_New_ErrorMigrationDir(t *testing.T) {
+	dir := t.TempDir()
+	_, err := New(&Config{Driver: new(mockDriver), MigrationFilesDir: filepath.Join(dir, "missing")})
+	assert.ErrorIs(t, err, ErrMigrationDirNotExists)
+
+	file := filepath.Join(dir, "migrations")
+	assert.NoError(t, os.WriteFile(file, []byte{}, 0644))
+	_, err = New(&Config{Driver: new(mockDriver), MigrationFilesDir: file})
+	assert.ErrorIs(t, err, ErrMigrationDirNotDirectory)
+}
+
+func TestQafoia_New_ErrorSameSuffixes(t *testing.T) {
+	_, err := New(&Config{Driver: new(mockDriver), MigrationFilesDir: t.TempDir(), UpSuffix: ".pgsql", DownSuffix: ".pgsql"})
+	assert.ErrorIs(t, err, ErrInvalidMigrationSuffix)
+}
+
+func TestQafoia_New_DriverWithoutSettings(t *testing.T) {
+	driver := new(mockDriver)
+	driver.On("SetMigrationTableName", "migrations")
+
+	_, err := New(&Config{Driver: driver, MigrationFilesDir: t.TempDir()})
+	assert.NoError(t, err)
+
+	_, err = New(&Config{Driver: driver, MigrationFilesDir: t.TempDir(), Namespace: "billing"})
+	assert.ErrorIs(t, err, ErrDriverSettingsNotSupported)
+}
+
+func TestQafoia_New_SharedDriverKeepsTablesIndependent(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	users, err := New(&Config{Driver: driver, MigrationFilesDir: t.TempDir(), MigrationTableName: "users_migrations"})
+	assert.NoError(t, err)
+	billing, err := New(&Config{Driver: driver, MigrationFilesDir: t.TempDir(), MigrationTableName: "billing_migrations"})
+	assert.NoError(t, err)
+
+	mock.ExpectQuery("SELECT name, executed_at FROM users_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "executed_at"}))
+	mock.ExpectQuery("SELECT name, executed_at FROM billing_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "executed_at"}))
+
+	_, err = users.driver.GetExecutedMigrations(context.TODO(), false)
+	assert.NoError(t, err)
+	_, err = billing.driver.GetExecutedMigrations(context.TODO(), false)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQafoia_PreserveRegistrationOrder(t *testing.T) {
+	ctx := context.TODO()
+	second := dummyMigration{name: "b_create_users"}
+	first := dummyMigration{name: "z_create_roles"}
+
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+	driver.On("ApplyMigrations", ctx, []Migration{first, second}).Return(nil)
+
+	q := &Qafoia{driver: driver, preserveOrder: true, migrations: make(map[string]Migration)}
+	assert.NoError(t, q.Register(first, second))
+
+	err := q.Migrate(ctx)
+	assert.NoError(t, err)
+	driver.AssertExpectations(t)
+
+	list, err := q.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "z_create_roles", list[0].Name)
+	assert.Equal(t, "b_create_users", list[1].Name)
+}
+
+func TestQafoia_GetMigration(t *testing.T) {
+	migration := dummyMigration{name: "001_create_users"}
+	q := &Qafoia{migrations: map[string]Migration{"001_create_users": migration}}
+
+	found, ok := q.GetMigration("001_create_users")
+	assert.True(t, ok)
+	assert.Equal(t, migration, found)
+
+	_, ok = q.GetMigration("002_missing")
+	assert.False(t, ok)
+}
+
+func TestQafoia_Orphans(t *testing.T) {
+	ctx := context.TODO()
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{
+		{Name: "001_create_users"},
+		{Name: "002_deleted_migration"},
+	}, nil)
+
+	q := &Qafoia{
+		driver:     driver,
+		migrations: map[string]Migration{"001_create_users": dummyMigration{name: "001_create_users"}},
+	}
+
+	orphans, err := q.Orphans(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"002_deleted_migration"}, orphans)
+	driver.AssertExpectations(t)
+}
+
+func TestQafoia_Validate(t *testing.T) {
+	dir := t.TempDir()
+	valid, err := migrationFileTemplate("migrations", "20250418220011_create_users_table", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "20250418220011_create_users_table.go"), []byte(valid), 0644))
+	copied, err := migrationFileTemplate("migrations", "20250418220011_create_users_table", nil)
+	assert.NoError(t, err)
+	copied = strings.ReplaceAll(copied, "CreateUsersTable", "CreateOrdersTable")
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "20250419090000_create_orders_table.go"), []byte(copied), 0644))
+
+	q := &Qafoia{migrationFilesDir: dir, migrations: map[string]Migration{
+		"20250418220011_create_users_table": dummyMigration{name: "20250418220011_create_users_table"},
+		"create_roles":                      dummyMigration{name: "create_roles"},
+	}}
+
+	err = q.Validate()
+	assert.Error(t, err)
+	assert.ErrorContains(t, err, "migration create_roles: name must start with a 14-digit timestamp")
+	assert.ErrorContains(t, err, `migration file 20250419090000_create_orders_table.go: Name() returns "20250418220011_create_users_table", expected "20250419090000_create_orders_table"`)
+	assert.NotContains(t, err.Error(), "20250418220011_create_users_table.go")
+}
+
+func TestQafoia_RunSQLFile(t *testing.T) {
+	ctx := context.TODO()
+	path := filepath.Join(t.TempDir(), "fix.sql")
+	assert.NoError(t, os.WriteFile(path, []byte("UPDATE users SET active = 1;"), 0644))
+
+	driver := new(mockDriver)
+	driver.On("ExecuteSQL", ctx, "UPDATE users SET active = 1;").Return(nil)
+
+	err := (&Qafoia{driver: driver}).RunSQLFile(ctx, path)
+	assert.NoError(t, err)
+	driver.AssertExpectations(t)
+}
+
+func TestQafoia_RunSQLFile_Errors(t *testing.T) {
+	ctx := context.TODO()
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.sql")
+	assert.NoError(t, os.WriteFile(empty, []byte("  \n"), 0644))
+	failing := filepath.Join(dir, "failing.sql")
+	assert.NoError(t, os.WriteFile(failing, []byte("DROP TABLE missing;"), 0644))
+
+	driver := new(mockDriver)
+	driver.On("ExecuteSQL", ctx, "DROP TABLE missing;").Return(errors.New("unknown table"))
+	q := &Qafoia{driver: driver}
+
+	assert.ErrorContains(t, q.RunSQLFile(ctx, filepath.Join(dir, "missing.sql")), "failed to read SQL file")
+	assert.ErrorContains(t, q.RunSQLFile(ctx, empty), "is empty")
+
+	var sqlErr *MigrationSQLError
+	assert.ErrorAs(t, q.RunSQLFile(ctx, failing), &sqlErr)
+	assert.Equal(t, "DROP TABLE missing;", sqlErr.SQL)
+}
+
+func TestQafoia_History_FallsBackToExecutedMigrations(t *testing.T) {
+	ctx := context.TODO()
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{{Name: "001_create_users"}}, nil)
+
+	history, err := (&Qafoia{driver: driver}).History(ctx)
+	assert.NoError(t, err)
+
+	m, found := history.Find("001_create_users")
+	assert.True(t, found)
+	assert.Equal(t, "001_create_users", m.Name)
+	_, found = history.Find("002_missing")
+	assert.False(t, found)
+}
+
+func TestQafoia_ExportImportHistory(t *testing.T) {
+	ctx := context.TODO()
+	executedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	source := new(mockDriver)
+	source.On("CreateMigrationsTable", ctx).Return(nil)
+	source.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{
+		{Name: "001_create_users", ExecutedAt: executedAt},
+		{Name: "002_create_orders", ExecutedAt: executedAt},
+	}, nil)
+
+	data, err := (&Qafoia{driver: source}).ExportHistory(ctx)
+	assert.NoError(t, err)
+
+	target := &recordingMockDriver{mockDriver: new(mockDriver)}
+	target.On("CreateMigrationsTable", ctx).Return(nil)
+	target.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{
+		{Name: "001_create_users", ExecutedAt: executedAt},
+	}, nil)
+
+	err = (&Qafoia{driver: target}).ImportHistory(ctx, data)
+	assert.NoError(t, err)
+	assert.Equal(t, []ExecutedMigration{{Name: "002_create_orders", ExecutedAt: executedAt}}, target.recorded)
+}
+
+func TestQafoia_ImportHistory_NotSupported(t *testing.T) {
+	err := (&Qafoia{driver: new(mockDriver)}).ImportHistory(context.TODO(), []byte("[]"))
+	assert.ErrorIs(t, err, ErrRecordingNotSupported)
+}
+
+func TestQafoia_MarkApplied(t *testing.T) {
+	ctx := context.TODO()
+	driver := &recordingMockDriver{mockDriver: new(mockDriver)}
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{
+		{Name: "001_create_users"},
+		{Name: "002_create_orders", InProgress: true},
+	}, nil)
+
+	q := &Qafoia{driver: driver, migrations: map[string]Migration{
+		"001_create_users":  dummyMigration{name: "001_create_users"},
+		"002_create_orders": dummyMigration{name: "002_create_orders"},
+		"003_create_items":  dummyMigration{name: "003_create_items"},
+	}}
+
+	err := q.MarkApplied(ctx, "001_create_users", "002_create_orders", "003_create_items")
+	assert.NoError(t, err)
+	assert.Empty(t, driver.forgotten)
+	assert.Len(t, driver.corrected, 1)
+	assert.Equal(t, "002_create_orders", driver.corrected[0].Name)
+	assert.Len(t, driver.recorded, 1)
+	assert.Equal(t, "003_create_items", driver.recorded[0].Name)
+
+	err = q.MarkApplied(ctx, "004_unknown")
+	assert.ErrorIs(t, err, ErrMigrationNotRegistered)
+}
+
+type renamingMockDriver struct {
+	*mockDriver
+	renamed map[string]string
+}
+
+func (d *renamingMockDriver) RenameExecutedMigration(ctx context.Context, oldName string, newName string) error {
+	d.renamed[oldName] = newName
+	return nil
+}
+
+func TestQafoia_Rename(t *testing.T) {
+	ctx := context.TODO()
+	driver := &renamingMockDriver{mockDriver: new(mockDriver), renamed: map[string]string{}}
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{
+		{Name: "001_create_user"},
+		{Name: "002_create_orders"},
+	}, nil)
+
+	q := &Qafoia{driver: driver, migrations: map[string]Migration{
+		"001_create_users":  dummyMigration{name: "001_create_users"},
+		"002_create_orders": dummyMigration{name: "002_create_orders"},
+	}}
+
+	assert.NoError(t, q.Rename(ctx, "001_create_user", "001_create_users"))
+	assert.Equal(t, map[string]string{"001_create_user": "001_create_users"}, driver.renamed)
+
+	assert.ErrorIs(t, q.Rename(ctx, "001_create_user", "003_unknown"), ErrMigrationNotRegistered)
+	assert.ErrorIs(t, q.Rename(ctx, "001_missing", "001_create_users"), ErrMigrationNotExecuted)
+	assert.ErrorIs(t, q.Rename(ctx, "001_create_user", "002_create_orders"), ErrMigrationAlreadyExecuted)
+
+	err := (&Qafoia{driver: new(mockDriver)}).Rename(ctx, "001_create_user", "001_create_users")
+	assert.ErrorIs(t, err, ErrRenameNotSupported)
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func TestQafoia_Clock(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	driver := &recordingMockDriver{mockDriver: new(mockDriver)}
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+
+	dir := filepath.Join(t.TempDir(), "migrations")
+	assert.NoError(t, os.Mkdir(dir, 0755))
+	q := &Qafoia{
+		driver:            driver,
+		migrationFilesDir: dir,
+		clock:             fixedClock(now),
+		migrations:        map[string]Migration{"001_create_users": dummyMigration{name: "001_create_users"}},
+	}
+
+	assert.NoError(t, q.MarkApplied(ctx, "001_create_users"))
+	assert.Equal(t, []ExecutedMigration{{Name: "001_create_users", ExecutedAt: now}}, driver.recorded)
+
+	assert.NoError(t, q.Create("create_orders"))
+	assert.FileExists(t, filepath.Join(dir, "20240506070809_create_orders.go"))
+}
+
+func TestQafoia_OnMissingRollbackMigration(t *testing.T) {
+	ctx := context.TODO()
+	users := dummyMigration{name: "001_create_users"}
+	permissions := dummyMigration{name: "003_create_permissions"}
+
+	newQafoia := func(action MissingMigrationAction) (*Qafoia, *recordingMockDriver) {
+		driver := &recordingMockDriver{mockDriver: new(mockDriver)}
+		driver.On("GetExecutedMigrations", ctx, true).Return([]ExecutedMigration{
+			{Name: "003_create_permissions"}, {Name: "002_create_roles"}, {Name: "001_create_users"},
+		}, nil)
+		return &Qafoia{driver: driver, onMissing: action, migrations: map[string]Migration{
+			"001_create_users":       users,
+			"003_create_permissions": permissions,
+		}}, driver
+	}
+
+	q, driver := newQafoia(MissingMigrationSkip)
+	driver.On("UnapplyMigrations", ctx, []Migration{permissions, users}).Return(nil)
+	summary, err := q.rollback(ctx, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, summary.Skipped)
+	driver.AssertExpectations(t)
+
+	q, driver = newQafoia(MissingMigrationError)
+	err = q.Rollback(ctx, 3)
+	assert.ErrorIs(t, err, ErrMigrationNotRegistered)
+	assert.ErrorContains(t, err, "002_create_roles")
+	driver.AssertNotCalled(t, "UnapplyMigrations", mock.Anything, mock.Anything)
+
+	q, driver = newQafoia(MissingMigrationRemoveRecord)
+	driver.On("UnapplyMigrations", ctx, []Migration{permissions}).Return(nil).Once()
+	driver.On("UnapplyMigrations", ctx, []Migration{users}).Return(nil).Once()
+	assert.NoError(t, q.Rollback(ctx, 3))
+	assert.Equal(t, []string{"002_create_roles"}, driver.forgotten)
+	driver.AssertExpectations(t)
+
+	q = &Qafoia{driver: new(mockDriver), onMissing: MissingMigrationRemoveRecord}
+	q.driver.(*mockDriver).On("GetExecutedMigrations", ctx, true).Return([]ExecutedMigration{{Name: "002_create_roles"}}, nil)
+	assert.ErrorIs(t, q.Rollback(ctx, 1), ErrRecordingNotSupported)
+}
+
+func TestQafoia_Repair(t *testing.T) {
+	ctx := context.TODO()
+	earlier := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	later := time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	newDriver := func() *recordingMockDriver {
+		driver := &recordingMockDriver{mockDriver: new(mockDriver)}
+		driver.On("CreateMigrationsTable", ctx).Return(nil)
+		driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{
+			{Name: "20250101000000_create_users", ExecutedAt: later},
+			{Name: "20250101000000_create_users", ExecutedAt: earlier},
+			{Name: "20250102000000_create_orders"},
+			{Name: "20250103000000_create_items", ExecutedAt: later},
+			{Name: "20250104000000_create_roles", InProgress: true},
+		}, nil)
+		return driver
+	}
+
+	driver := newDriver()
+	q := &Qafoia{driver: driver, twoPhaseRecording: true}
+	assert.NoError(t, q.Repair(ctx, true))
+	assert.Empty(t, driver.replaced)
+	assert.Empty(t, driver.corrected)
+
+	driver = newDriver()
+	q = &Qafoia{driver: driver, twoPhaseRecording: true}
+	assert.NoError(t, q.Repair(ctx, false))
+	assert.Empty(t, driver.forgotten)
+	assert.Empty(t, driver.recorded)
+	assert.Equal(t, []ExecutedMigration{{Name: "20250101000000_create_users", ExecutedAt: earlier}}, driver.replaced)
+	assert.Equal(t, []ExecutedMigration{
+		{Name: "20250102000000_create_orders", ExecutedAt: time.Date(2025, 1, 2, 0, 0, 0, 0, time.Local)},
+	}, driver.corrected)
+
+	// Without two-phase recording, a null execution time is a missing one and is backfilled
+	driver = newDriver()
+	q = &Qafoia{driver: driver}
+	assert.NoError(t, q.Repair(ctx, false))
+	assert.Equal(t, []ExecutedMigration{
+		{Name: "20250102000000_create_orders", ExecutedAt: time.Date(2025, 1, 2, 0, 0, 0, 0, time.Local)},
+		{Name: "20250104000000_create_roles", ExecutedAt: time.Date(2025, 1, 4, 0, 0, 0, 0, time.Local)},
+	}, driver.corrected)
+
+	err := (&Qafoia{driver: new(mockDriver)}).Repair(ctx, false)
+	assert.ErrorIs(t, err, ErrRecordingNotSupported)
+}
+
+func TestQafoia_Capabilities(t *testing.T) {
+	db, mock, driver := setupMockDBPostgres(t)
+	defer db.Close()
+
+	q := &Qafoia{driver: driver, migrations: map[string]Migration{
+		"001_create_users":  &mockMigrationPostgresDriver{name: "001_create_users", up: "CREATE TABLE users (id INT);"},
+		"002_create_events": &databaseMigrationPostgresDriver{mockMigrationPostgresDriver{name: "002_create_events", up: "CREATE TABLE events (id INT);"}},
+	}}
+	assert.True(t, q.Capabilities().TransactionalDDL)
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT name, executed_at FROM migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "executed_at"}))
+
+	err := q.Migrate(context.TODO())
+	assert.ErrorIs(t, err, ErrDatabaseNotSupported)
+	assert.ErrorContains(t, err, "002_create_events")
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Equal(t, DriverCapabilities{}, (&Qafoia{driver: new(mockDriver)}).Capabilities())
+}
+
+func TestQafoia_Preflight(t *testing.T) {
+	ctx := context.TODO()
+	scratch := mock.MatchedBy(func(sql string) bool { return strings.Contains(sql, "qafoia_preflight_") })
+
+	driver := new(mockDriver)
+	driver.On("ExecuteSQL", mock.Anything, scratch).Return(nil)
+	q := &Qafoia{driver: driver}
+	assert.NoError(t, q.Preflight(ctx))
+	driver.AssertNumberOfCalls(t, "ExecuteSQL", 4)
+
+	driver = new(mockDriver)
+	driver.On("ExecuteSQL", mock.Anything, mock.MatchedBy(func(sql string) bool { return strings.HasPrefix(sql, "DELETE") })).
+		Return(errors.New("DELETE command denied"))
+	driver.On("ExecuteSQL", mock.Anything, scratch).Return(nil)
+	q = &Qafoia{driver: driver}
+	err := q.Preflight(ctx)
+	assert.ErrorIs(t, err, ErrPreflightFailed)
+	assert.ErrorContains(t, err, "delete: DELETE command denied")
+	driver.AssertCalled(t, "ExecuteSQL", mock.Anything, mock.MatchedBy(func(sql string) bool { return strings.HasPrefix(sql, "DROP TABLE qafoia_preflight_") }))
+}
+
+func TestQafoia_GenerateDiffMigration_NotSupported(t *testing.T) {
+	q := &Qafoia{driver: new(mockDriver)}
+
+	up, down, err := q.GenerateDiffMigration(context.TODO(), "postgres://localhost/target")
+	assert.Empty(t, up)
+	assert.Empty(t, down)
+	assert.Equal(t, ErrDiffNotSupported, err)
+}
+
+func TestQafoia_VerifyReversible(t *testing.T) {
+	ctx := context.TODO()
+	migration := dummyMigration{name: "001_create_users"}
+
+	driver := &snapshotMockDriver{mockDriver: new(mockDriver), snapshots: []SchemaSnapshot{
+		{"roles": {{Name: "id", Type: "integer"}}},
+		{"roles": {{Name: "id", Type: "integer"}}},
+	}}
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+	driver.On("ApplyMigrations", ctx, []Migration{migration}).Return(nil)
+	driver.On("UnapplyMigrations", ctx, []Migration{migration}).Return(nil)
+
+	q := &Qafoia{driver: driver, migrations: map[string]Migration{"001_create_users": migration}}
+
+	err := q.VerifyReversible(ctx, "001_create_users")
+	assert.NoError(t, err)
+	driver.AssertExpectations(t)
+}
+
+func TestQafoia_VerifyReversible_SchemaChanged(t *testing.T) {
+	ctx := context.TODO()
+	migration := dummyMigration{name: "001_create_users"}
+
+	driver := &snapshotMockDriver{mockDriver: new(mockDriver), snapshots: []SchemaSnapshot{
+		{},
+		{"dummy": {{Name: "id", Type: "integer"}}},
+	}}
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+	driver.On("ApplyMigrations", ctx, []Migration{migration}).Return(nil)
+	driver.On("UnapplyMigrations", ctx, []Migration{migration}).Return(nil)
+
+	q := &Qafoia{driver: driver, migrations: map[string]Migration{"001_create_users": migration}}
+
+	err := q.VerifyReversible(ctx, "001_create_users")
+	assert.ErrorIs(t, err, ErrMigrationNotReversible)
+	assert.ErrorContains(t, err, `CREATE TABLE "dummy"`)
+}
+
+func TestQafoia_VerifyReversible_NotSupported(t *testing.T) {
+	ctx := context.TODO()
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+
+	q := &Qafoia{
+		driver:     driver,
+		migrations: map[string]Migration{"001_create_users": dummyMigration{name: "001_create_users"}},
+	}
+
+	err := q.VerifyReversible(ctx, "001_create_users")
+	assert.Equal(t, ErrSnapshotNotSupported, err)
+}
+
+// snapshotMockDriver is a mockDriver that returns the given schema snapshots in order.
+type snapshotMockDriver struct {
+	*mockDriver
+	snapshots []SchemaSnapshot
+}
+
+func (d *snapshotMockDriver) SnapshotCurrentSchema(ctx context.Context) (SchemaSnapshot, error) {
+	snapshot := d.snapshots[0]
+	d.snapshots = d.snapshots[1:]
+	return snapshot, nil
+}
+
+// recordingMockDriver is a mockDriver that keeps the migrations recorded without running them.
+type recordingMockDriver struct {
+	*mockDriver
+	recorded  []ExecutedMigration
+	forgotten []string
+	corrected []ExecutedMigration
+	replaced  []ExecutedMigration
+}
+
+func (d *recordingMockDriver) ReplaceExecutedMigration(ctx context.Context, name string, executedAt time.Time) error {
+	d.replaced = append(d.replaced, ExecutedMigration{Name: name, ExecutedAt: executedAt})
+	return nil
+}
+
+func (d *recordingMockDriver) RecordExecutedMigration(ctx context.Context, name string, executedAt time.Time) error {
+	d.recorded = append(d.recorded, ExecutedMigration{Name: name, ExecutedAt: executedAt})
+	return nil
+}
+
+func (d *recordingMockDriver) ForgetExecutedMigration(ctx context.Context, name string) error {
+	d.forgotten = append(d.forgotten, name)
+	return nil
+}
+
+func (d *recordingMockDriver) SetExecutedAt(ctx context.Context, name string, executedAt time.Time) error {
+	d.corrected = append(d.corrected, ExecutedMigration{Name: name, ExecutedAt: executedAt})
+	return nil
+}
+
+// destructiveMigration is a migration that can acknowledge being destructive.
+type destructiveMigration struct {
+	mockMigrationMySqlDriver
+	acknowledged bool
+}
+
+func (m *destructiveMigration) Destructive() bool {
+	return m.acknowledged
+}
+
+// historyMockDriver is a mockDriver that returns the given migration history.
+type historyMockDriver struct {
+	*mockDriver
+	history MigrationHistory
+}
+
+func (d *historyMockDriver) ReadHistory(ctx context.Context) (MigrationHistory, error) {
+	return d.history, nil
+}
+
+// dummyMigration is a simple implementation of the Migration interface for testing.
+type dummyMigration struct {
+	name string
+}
+
+func (d dummyMigration) Name() string {
+	return d.name
+}
+
+func (d dummyMigration) UpScript() string {
+	return "CREATE TABLE dummy (id INT);"
+}
+
+func (d dummyMigration) DownScript() string {
+	return "DROP TABLE dummy;"
+}
+
+func TestQafoia_LockTimeout(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	q := &Qafoia{driver: driver, lockTimeout: time.Second, migrations: map[string]Migration{
+		"001_create_users": &mockMigrationMySqlDriver{name: "001_create_users", up: "CREATE TABLE users (id INT);"},
+	}}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT DATABASE()")).
+		WillReturnRows(sqlmock.NewRows([]string{"database"}).AddRow("app"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT GET_LOCK(?, ?)")).
+		WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(0))
+
+	err := q.Migrate(context.Background())
+	assert.ErrorIs(t, err, ErrMigrationLocked)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT DATABASE()")).
+		WillReturnRows(sqlmock.NewRows([]string{"database"}).AddRow("app"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT GET_LOCK(?, ?)")).
+		WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(1))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT name, executed_at FROM migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "executed_at"}))
+	mock.ExpectExec("CREATE TABLE users").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO migrations").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DO RELEASE_LOCK(?)")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, q.Migrate(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQafoia_LockTimeoutNotSupported(t *testing.T) {
+	driver := new(mockDriver)
+	q := &Qafoia{driver: driver, lockTimeout: time.Second, migrations: make(map[string]Migration)}
+
+	err := q.Migrate(context.Background())
+	assert.ErrorIs(t, err, ErrLockingNotSupported)
+	driver.AssertNotCalled(t, "CreateMigrationsTable", mock.Anything)
+}
+
+func TestQafoia_Quiet(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	for _, quiet := range []bool{false, true} {
+		logs.Reset()
+		q := &Qafoia{driver: driver, quiet: quiet, migrations: make(map[string]Migration)}
+
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT name, executed_at FROM migrations").
+			WillReturnRows(sqlmock.NewRows([]string{"name", "executed_at"}))
+
+		assert.NoError(t, q.Migrate(context.Background()))
+		assert.Equal(t, !quiet, strings.Contains(logs.String(), "No migrations to run"))
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQafoia_Migrate_HookScripts(t *testing.T) {
+	ctx := context.TODO()
+	users := dummyMigration{name: "001_create_users"}
+	backfill := &fileMigration{file: MigrationFile{
+		Name:      "002_backfill",
+		UpSql:     []byte("UPDATE users SET active = true;"),
+		BeforeSql: []byte("ALTER TABLE users DISABLE TRIGGER ALL;"),
+		AfterSql:  []byte("ALTER TABLE users ENABLE TRIGGER ALL;"),
+	}}
+
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+	driver.On("ApplyMigrations", ctx, []Migration{users}).Return(nil).Once()
+	driver.On("ExecuteSQL", ctx, "ALTER TABLE users DISABLE TRIGGER ALL;").Return(nil).Once()
+	driver.On("ApplyMigrations", ctx, []Migration{backfill}).Return(nil).Once()
+	driver.On("ExecuteSQL", ctx, "ALTER TABLE users ENABLE TRIGGER ALL;").Return(nil).Once()
+
+	q := &Qafoia{driver: driver, migrations: map[string]Migration{
+		"001_create_users": users,
+		"002_backfill":     backfill,
+	}}
+
+	assert.NoError(t, q.Migrate(ctx))
+	driver.AssertExpectations(t)
+}
+
+func TestQafoia_Migrate_HookScriptsKeepGroups(t *testing.T) {
+	ctx := context.TODO()
+	backfill := &fileMigration{file: MigrationFile{
+		Name:      "001_backfill",
+		UpSql:     []byte("UPDATE users SET active = true;"),
+		BeforeSql: []byte("ALTER TABLE users DISABLE TRIGGER ALL;"),
+	}}
+	posts := dummyMigration{name: "002_create_posts"}
+	comments := dummyMigration{name: "003_create_comments"}
+
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+	driver.On("ExecuteSQL", ctx, "ALTER TABLE users DISABLE TRIGGER ALL;").Return(nil).Once()
+	driver.On("ApplyMigrations", ctx, []Migration{backfill}).Return(nil).Once()
+	driver.On("ApplyMigrations", ctx, []Migration{posts, comments}).Return(nil).Once()
+
+	q := &Qafoia{driver: driver, migrations: map[string]Migration{
+		"001_backfill":        backfill,
+		"002_create_posts":    posts,
+		"003_create_comments": comments,
+	}}
+
+	assert.NoError(t, q.Migrate(ctx))
+	driver.AssertExpectations(t)
+}
+
+func TestQafoia_Migrate_HookScriptsTransformed(t *testing.T) {
+	ctx := context.TODO()
+	backfill := &fileMigration{file: MigrationFile{
+		Name:      "001_backfill",
+		UpSql:     []byte("UPDATE {{schema}}.users SET active = true;"),
+		BeforeSql: []byte("ALTER TABLE {{schema}}.users DISABLE TRIGGER ALL;"),
+		AfterSql:  []byte("ALTER TABLE {{schema}}.users ENABLE TRIGGER ALL;"),
+	}}
+
+	driver := new(mockDriver)
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{}, nil)
+	driver.On("ExecuteSQL", ctx, "ALTER TABLE app.users DISABLE TRIGGER ALL;").Return(nil).Once()
+	driver.On("ApplyMigrations", ctx, []Migration{backfill}).Return(nil).Once()
+	driver.On("ExecuteSQL", ctx, "ALTER TABLE app.users ENABLE TRIGGER ALL;").Return(nil).Once()
+
+	q := &Qafoia{
+		driver:     driver,
+		migrations: map[string]Migration{"001_backfill": backfill},
+		sqlTransform: func(name, sql string) (string, error) {
+			return strings.ReplaceAll(sql, "{{schema}}", "app"), nil
+		},
+	}
+
+	assert.NoError(t, q.Migrate(ctx))
+	driver.AssertExpectations(t)
 }
@@ -0,0 +1,61 @@
+package qafoia
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// DriverFactory creates a Driver connected to the database at dsn.
+type DriverFactory func(dsn string) (Driver, error)
+
+var (
+	driverFactoriesMu sync.RWMutex
+	driverFactories   = map[string]DriverFactory{
+		"mysql":    newMySqlDriverFromDSN,
+		"postgres": newPostgresDriverFromDSN,
+	}
+)
+
+// RegisterDriver makes a driver available to NewDriver under the given kind, so drivers
+// maintained outside qafoia can be selected by name. Like sql.Register, it panics if the
+// factory is nil or a driver of that kind is already registered.
+func RegisterDriver(kind string, factory DriverFactory) {
+	driverFactoriesMu.Lock()
+	defer driverFactoriesMu.Unlock()
+
+	if factory == nil {
+		panic("qafoia: RegisterDriver factory is nil")
+	}
+	if _, exists := driverFactories[kind]; exists {
+		panic("qafoia: RegisterDriver called twice for driver " + kind)
+	}
+	driverFactories[kind] = factory
+}
+
+// NewDriver creates a driver of the given kind connected to the database at dsn. The
+// built-in kinds are "mysql" and "postgres"; more can be added with RegisterDriver.
+func NewDriver(kind string, dsn string) (Driver, error) {
+	driverFactoriesMu.RLock()
+	factory, found := driverFactories[kind]
+	driverFactoriesMu.RUnlock()
+
+	if !found {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownDriver, kind)
+	}
+
+	return factory(dsn)
+}
+
+// Drivers returns the sorted kinds of the drivers available to NewDriver.
+func Drivers() []string {
+	driverFactoriesMu.RLock()
+	defer driverFactoriesMu.RUnlock()
+
+	kinds := make([]string, 0, len(driverFactories))
+	for kind := range driverFactories {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
@@ -0,0 +1,39 @@
+package qafoia
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterDriver(t *testing.T) {
+	driver := new(mockDriver)
+	RegisterDriver("test-registry", func(dsn string) (Driver, error) {
+		assert.Equal(t, "test://localhost", dsn)
+		return driver, nil
+	})
+
+	created, err := NewDriver("test-registry", "test://localhost")
+	assert.NoError(t, err)
+	assert.Same(t, driver, created)
+	assert.Contains(t, Drivers(), "test-registry")
+	assert.Contains(t, Drivers(), "mysql")
+	assert.Contains(t, Drivers(), "postgres")
+
+	assert.Panics(t, func() {
+		RegisterDriver("test-registry", func(dsn string) (Driver, error) { return nil, nil })
+	})
+	assert.Panics(t, func() {
+		RegisterDriver("test-nil", nil)
+	})
+}
+
+func TestNewDriver_Unknown(t *testing.T) {
+	_, err := NewDriver("oracle", "oracle://localhost")
+	assert.ErrorIs(t, err, ErrUnknownDriver)
+}
+
+func TestNewDriver_InvalidMySqlDSN(t *testing.T) {
+	_, err := NewDriver("mysql", "not a dsn")
+	assert.Error(t, err)
+}
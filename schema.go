@@ -0,0 +1,168 @@
+package qafoia
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SchemaColumn describes a single table column in a schema snapshot.
+type SchemaColumn struct {
+	Name     string
+	Type     string
+	Nullable bool
+}
+
+// definition returns the column definition as used in CREATE TABLE and ADD COLUMN statements.
+func (c SchemaColumn) definition(quote func(string) string) string {
+	definition := fmt.Sprintf("%s %s", quote(c.Name), c.Type)
+	if !c.Nullable {
+		definition += " NOT NULL"
+	}
+	return definition
+}
+
+// SchemaSnapshot maps table names to their columns in ordinal order.
+type SchemaSnapshot map[string][]SchemaColumn
+
+// sortedTableNames returns the table names of the snapshot in lexicographic order.
+func (s SchemaSnapshot) sortedTableNames() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// diffSchemas generates the up and down SQL that turns the current schema into the
+// target schema and back. Only added or dropped tables and columns are detected.
+func diffSchemas(current, target SchemaSnapshot, quote func(string) string) (string, string) {
+	var up, down []string
+
+	createTable := func(table string, columns []SchemaColumn) string {
+		definitions := make([]string, 0, len(columns))
+		for _, column := range columns {
+			definitions = append(definitions, "\t"+column.definition(quote))
+		}
+		return fmt.Sprintf("CREATE TABLE %s (\n%s\n);", quote(table), strings.Join(definitions, ",\n"))
+	}
+	dropTable := func(table string) string {
+		return fmt.Sprintf("DROP TABLE %s;", quote(table))
+	}
+	addColumn := func(table string, column SchemaColumn) string {
+		return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s;", quote(table), column.definition(quote))
+	}
+	dropColumn := func(table string, column SchemaColumn) string {
+		return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", quote(table), quote(column.Name))
+	}
+
+	for _, table := range target.sortedTableNames() {
+		targetColumns := target[table]
+		currentColumns, exists := current[table]
+		if !exists {
+			up = append(up, createTable(table, targetColumns))
+			down = append(down, dropTable(table))
+			continue
+		}
+
+		currentByName := make(map[string]struct{}, len(currentColumns))
+		for _, column := range currentColumns {
+			currentByName[column.Name] = struct{}{}
+		}
+		targetByName := make(map[string]struct{}, len(targetColumns))
+		for _, column := range targetColumns {
+			targetByName[column.Name] = struct{}{}
+		}
+
+		for _, column := range targetColumns {
+			if _, found := currentByName[column.Name]; !found {
+				up = append(up, addColumn(table, column))
+				down = append(down, dropColumn(table, column))
+			}
+		}
+		for _, column := range currentColumns {
+			if _, found := targetByName[column.Name]; !found {
+				up = append(up, dropColumn(table, column))
+				down = append(down, addColumn(table, column))
+			}
+		}
+	}
+
+	for _, table := range current.sortedTableNames() {
+		if _, exists := target[table]; !exists {
+			up = append(up, dropTable(table))
+			down = append(down, createTable(table, current[table]))
+		}
+	}
+
+	// The down script undoes the up script, so it runs in reverse order
+	for i, j := 0, len(down)-1; i < j; i, j = i+1, j-1 {
+		down[i], down[j] = down[j], down[i]
+	}
+
+	return strings.Join(up, "\n"), strings.Join(down, "\n")
+}
+
+// fingerprintSchema hashes the rows returned by queries, which describe the schema in a
+// deterministic order with the table name in their first column. Rows of skipTable, the
+// migration tracking table, are left out so recording migrations does not change the hash.
+func fingerprintSchema(ctx context.Context, db *sql.DB, skipTable string, queries ...string) (string, error) {
+	hash := sha256.New()
+
+	for i, query := range queries {
+		fmt.Fprintf(hash, "-- %d\n", i)
+
+		if err := fingerprintRows(ctx, db, skipTable, query, func(row []string) {
+			fmt.Fprintln(hash, strings.Join(row, "\t"))
+		}); err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// fingerprintRows runs query and calls fn with the values of each row as strings, NULL
+// values included, except for rows whose first column is skipTable.
+func fingerprintRows(ctx context.Context, db *sql.DB, skipTable string, query string, fn func(row []string)) error {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		if values[0].String == skipTable {
+			continue
+		}
+
+		row := make([]string, len(values))
+		for i, value := range values {
+			row[i] = "NULL"
+			if value.Valid {
+				row[i] = fmt.Sprintf("%q", value.String)
+			}
+		}
+		fn(row)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,98 @@
+package qafoia
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSchemas(t *testing.T) {
+	current := SchemaSnapshot{
+		"users": {
+			{Name: "id", Type: "integer"},
+			{Name: "legacy_flag", Type: "boolean", Nullable: true},
+		},
+		"sessions": {
+			{Name: "id", Type: "integer"},
+		},
+	}
+	target := SchemaSnapshot{
+		"users": {
+			{Name: "id", Type: "integer"},
+			{Name: "email", Type: "character varying(255)"},
+		},
+		"roles": {
+			{Name: "id", Type: "integer"},
+			{Name: "name", Type: "text", Nullable: true},
+		},
+	}
+
+	up, down := diffSchemas(current, target, quotePostgresIdentifier)
+
+	assert.Equal(t, `CREATE TABLE "roles" (
+	"id" integer NOT NULL,
+	"name" text
+);
+ALTER TABLE "users" ADD COLUMN "email" character varying(255) NOT NULL;
+ALTER TABLE "users" DROP COLUMN "legacy_flag";
+DROP TABLE "sessions";`, up)
+
+	assert.Equal(t, `CREATE TABLE "sessions" (
+	"id" integer NOT NULL
+);
+ALTER TABLE "users" ADD COLUMN "legacy_flag" boolean;
+ALTER TABLE "users" DROP COLUMN "email";
+DROP TABLE "roles";`, down)
+}
+
+func TestDiffSchemas_NoChanges(t *testing.T) {
+	snapshot := SchemaSnapshot{"users": {{Name: "id", Type: "integer"}}}
+
+	up, down := diffSchemas(snapshot, snapshot, quotePostgresIdentifier)
+
+	assert.Empty(t, up)
+	assert.Empty(t, down)
+}
+
+func TestFingerprintSchema(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	fingerprint := func(columns *sqlmock.Rows) string {
+		mock.ExpectQuery("SELECT table_name, column_name").WillReturnRows(columns)
+		mock.ExpectQuery("SELECT tablename, indexname").WillReturnRows(
+			sqlmock.NewRows([]string{"tablename", "indexname", "indexdef"}).
+				AddRow("users", "users_pkey", "CREATE UNIQUE INDEX users_pkey ON public.users USING btree (id)"),
+		)
+
+		hash, err := fingerprintSchema(context.Background(), db, "migrations",
+			"SELECT table_name, column_name, column_default FROM columns",
+			"SELECT tablename, indexname, indexdef FROM indexes",
+		)
+		assert.NoError(t, err)
+		return hash
+	}
+	columns := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"table_name", "column_name", "column_default"}).
+			AddRow("users", "id", nil).
+			AddRow("users", "active", "true")
+	}
+
+	base := fingerprint(columns())
+	assert.Len(t, base, 64)
+	assert.Equal(t, base, fingerprint(columns()))
+	assert.Equal(t, base, fingerprint(columns().AddRow("migrations", "name", nil)))
+	assert.NotEqual(t, base, fingerprint(columns().AddRow("users", "email", nil)))
+	assert.NotEqual(t, base, fingerprint(
+		sqlmock.NewRows([]string{"table_name", "column_name", "column_default"}).
+			AddRow("users", "id", nil).
+			AddRow("users", "active", "false"),
+	))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = (&Qafoia{driver: new(mockDriver)}).SchemaFingerprint(context.Background())
+	assert.ErrorIs(t, err, ErrSnapshotNotSupported)
+}
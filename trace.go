@@ -0,0 +1,117 @@
+package qafoia
+
+import (
+	"context"
+	"time"
+)
+
+// Tracer starts tracing spans around migration runs. It is the subset of an OpenTelemetry
+// trace.Tracer that qafoia needs, so qafoia has no tracing dependency and an adapter for
+// OpenTelemetry or any other tracing library takes a few lines.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a tracing span started by a Tracer.
+type Span interface {
+	SetAttribute(key string, value any)
+	RecordError(err error)
+	End()
+}
+
+// noopSpan is the Span used when no Tracer is configured.
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, any) {}
+func (noopSpan) RecordError(error)        {}
+func (noopSpan) End()                     {}
+
+// startSpan starts a span with the configured Tracer, or a no-op span without one.
+func (q *Qafoia) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	if q.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return q.tracer.Start(ctx, name)
+}
+
+// endRunSpan ends the span of a migrate or rollback run with the outcome of the run.
+func endRunSpan(span Span, summary runSummary, err error) {
+	span.SetAttribute("qafoia.applied", summary.Applied)
+	span.SetAttribute("qafoia.skipped", summary.Skipped)
+	span.SetAttribute("qafoia.failed", summary.Failed)
+	endSpan(span, err)
+}
+
+// endSpan records the outcome of the span and ends it.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.SetAttribute("qafoia.success", err == nil)
+	span.End()
+}
+
+// migrationSpans tracks the span of each migration between the driver callbacks.
+type migrationSpans struct {
+	q       *Qafoia
+	ctx     context.Context
+	name    string
+	action  AuditAction
+	spans   map[string]Span
+	started map[string]time.Time
+	// sharded holds the migrations audited per shard by a MultiDriver, which get no audit
+	// record of their own.
+	sharded map[string]bool
+}
+
+// newMigrationSpans creates per-migration spans named name, as children of the span in ctx.
+// Each migration is also recorded in the audit log as action when it ends.
+func (q *Qafoia) newMigrationSpans(ctx context.Context, name string, action AuditAction) *migrationSpans {
+	return &migrationSpans{
+		q:       q,
+		ctx:     ctx,
+		name:    name,
+		action:  action,
+		spans:   make(map[string]Span),
+		started: make(map[string]time.Time),
+		sharded: make(map[string]bool),
+	}
+}
+
+// withShardAudit returns ctx asking a MultiDriver to report the outcome of each migration on
+// each shard, so the audit log gets a record per shard. ctx is unchanged without an audit log.
+func (s *migrationSpans) withShardAudit(ctx context.Context) context.Context {
+	if s.q.audit == nil {
+		return ctx
+	}
+	return withShardResults(ctx, func(shard string, m Migration, started time.Time, err error) {
+		s.sharded[m.Name()] = true
+		s.q.recordAudit(AuditRecord{Action: s.action, Migration: m.Name(), Shard: shard}, started, err)
+	})
+}
+
+// start starts the span of the migration.
+func (s *migrationSpans) start(m Migration) {
+	_, span := s.q.startSpan(s.ctx, s.name)
+	span.SetAttribute("qafoia.migration", m.Name())
+	s.spans[m.Name()] = span
+	s.started[m.Name()] = time.Now()
+}
+
+// end ends the span of the migration with its duration and outcome, and records it in the
+// audit log.
+func (s *migrationSpans) end(m Migration, err error) {
+	span, found := s.spans[m.Name()]
+	if !found {
+		return
+	}
+	started := s.started[m.Name()]
+	span.SetAttribute("qafoia.duration_ms", time.Since(started).Milliseconds())
+	endSpan(span, err)
+	if !s.sharded[m.Name()] {
+		s.q.recordAudit(AuditRecord{Action: s.action, Migration: m.Name()}, started, err)
+	}
+	delete(s.spans, m.Name())
+	delete(s.started, m.Name())
+	delete(s.sharded, m.Name())
+}
@@ -0,0 +1,187 @@
+package qafoia
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// recordingTracer keeps the spans it starts.
+type recordingTracer struct {
+	spans []*recordingSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	span := &recordingSpan{name: name, attributes: make(map[string]any)}
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+type recordingSpan struct {
+	name       string
+	attributes map[string]any
+	err        error
+	ended      bool
+}
+
+func (s *recordingSpan) SetAttribute(key string, value any) { s.attributes[key] = value }
+func (s *recordingSpan) RecordError(err error)              { s.err = err }
+func (s *recordingSpan) End()                               { s.ended = true }
+
+func TestQafoia_Tracer(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	tracer := &recordingTracer{}
+	q := &Qafoia{driver: driver, tracer: tracer, migrations: map[string]Migration{
+		"001_create_users":  &mockMigrationMySqlDriver{name: "001_create_users", up: "CREATE TABLE users (id INT);"},
+		"002_create_orders": &mockMigrationMySqlDriver{name: "002_create_orders", up: "CREATE TABLE orders (id INT);"},
+	}}
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT name, executed_at FROM migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "executed_at"}))
+	mock.ExpectExec("CREATE TABLE users").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO migrations").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("CREATE TABLE orders").WillReturnError(errors.New("table exists"))
+
+	err := q.Migrate(context.Background())
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Len(t, tracer.spans, 3)
+	run, users, orders := tracer.spans[0], tracer.spans[1], tracer.spans[2]
+
+	assert.Equal(t, "qafoia.migrate", run.name)
+	assert.True(t, run.ended)
+	assert.Equal(t, 1, run.attributes["qafoia.applied"])
+	assert.Equal(t, 1, run.attributes["qafoia.failed"])
+	assert.Equal(t, false, run.attributes["qafoia.success"])
+
+	assert.Equal(t, "qafoia.migration.up", users.name)
+	assert.Equal(t, "001_create_users", users.attributes["qafoia.migration"])
+	assert.Equal(t, true, users.attributes["qafoia.success"])
+	assert.Contains(t, users.attributes, "qafoia.duration_ms")
+	assert.True(t, users.ended)
+
+	assert.Equal(t, "002_create_orders", orders.attributes["qafoia.migration"])
+	assert.Equal(t, false, orders.attributes["qafoia.success"])
+	assert.ErrorContains(t, orders.err, "table exists")
+	assert.True(t, orders.ended)
+}
+
+func TestQafoia_AuditLog(t *testing.T) {
+	db, mock, driver := setupMockDBMySql(t)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	at := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	q := &Qafoia{driver: driver, clock: fixedClock(at), audit: newAuditLog(&buf), migrations: map[string]Migration{
+		"001_create_users":  &mockMigrationMySqlDriver{name: "001_create_users", up: "CREATE TABLE users (id INT);"},
+		"002_create_orders": &mockMigrationMySqlDriver{name: "002_create_orders", up: "CREATE TABLE orders (id INT);"},
+	}}
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT name, executed_at FROM migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "executed_at"}))
+	mock.ExpectExec("CREATE TABLE users").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO migrations").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("CREATE TABLE orders").WillReturnError(errors.New("table exists"))
+
+	err := q.Migrate(context.Background())
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+
+	var users, orders AuditRecord
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &users))
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &orders))
+
+	assert.Equal(t, AuditActionApply, users.Action)
+	assert.Equal(t, "001_create_users", users.Migration)
+	assert.True(t, users.Success)
+	assert.Empty(t, users.Error)
+	assert.True(t, users.Time.Equal(at))
+
+	assert.Equal(t, AuditActionApply, orders.Action)
+	assert.Equal(t, "002_create_orders", orders.Migration)
+	assert.False(t, orders.Success)
+	assert.Contains(t, orders.Error, "table exists")
+}
+
+func TestQafoia_AuditLogShards(t *testing.T) {
+	ctx := context.TODO()
+	eu := reportingDriver{mockDriver: new(mockDriver)}
+	us := reportingDriver{mockDriver: new(mockDriver), fail: map[string]error{"001": errors.New("syntax error")}}
+	for _, shard := range []reportingDriver{eu, us} {
+		shard.On("CreateMigrationsTable", mock.Anything).Return(nil)
+		shard.On("GetExecutedMigrations", mock.Anything, false).Return([]ExecutedMigration{}, nil)
+	}
+
+	d, err := NewMultiDriver(1, Shard{Name: "eu", Driver: eu}, Shard{Name: "us", Driver: us})
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	q := &Qafoia{driver: d, audit: newAuditLog(&buf), migrations: map[string]Migration{
+		"001": dummyMigration{name: "001"},
+	}}
+
+	_, err = q.migrate(ctx)
+	assert.ErrorContains(t, err, "syntax error")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+
+	records := make(map[string]AuditRecord)
+	for _, line := range lines {
+		var record AuditRecord
+		assert.NoError(t, json.Unmarshal([]byte(line), &record))
+		records[record.Shard] = record
+	}
+	assert.Equal(t, "001", records["eu"].Migration)
+	assert.True(t, records["eu"].Success)
+	assert.Equal(t, "001", records["us"].Migration)
+	assert.False(t, records["us"].Success)
+	assert.Equal(t, "syntax error", records["us"].Error)
+}
+
+func TestQafoia_AuditLogHistoryChanges(t *testing.T) {
+	ctx := context.TODO()
+	driver := &recordingMockDriver{mockDriver: new(mockDriver)}
+	driver.On("CreateMigrationsTable", ctx).Return(nil)
+	driver.On("GetExecutedMigrations", ctx, false).Return([]ExecutedMigration{{Name: "001_create_user"}}, nil)
+
+	var buf bytes.Buffer
+	renamer := &renamingMockDriver{mockDriver: driver.mockDriver, renamed: map[string]string{}}
+	q := &Qafoia{driver: driver, audit: newAuditLog(&buf), migrations: map[string]Migration{
+		"001_create_users":  dummyMigration{name: "001_create_users"},
+		"002_create_orders": dummyMigration{name: "002_create_orders"},
+	}}
+
+	assert.NoError(t, q.MarkApplied(ctx, "002_create_orders"))
+	q.driver = renamer
+	assert.NoError(t, q.Rename(ctx, "001_create_user", "001_create_users"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+
+	var marked, renamed AuditRecord
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &marked))
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &renamed))
+	assert.Equal(t, AuditActionMarkApplied, marked.Action)
+	assert.Equal(t, "002_create_orders", marked.Migration)
+	assert.True(t, marked.Success)
+	assert.Equal(t, AuditActionRename, renamed.Action)
+	assert.Equal(t, "001_create_users", renamed.Migration)
+	assert.Equal(t, "001_create_user", renamed.PreviousName)
+}
@@ -1,20 +1,220 @@
 package qafoia
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
 	"time"
 )
 
 type ExecutedMigration struct {
 	Name       string    `json:"name"`
 	ExecutedAt time.Time `json:"executed_at"`
+	// InProgress is set for a migration recorded as started but never finished, which
+	// can only happen with Config.TwoPhaseRecording.
+	InProgress bool `json:"in_progress,omitempty"`
+	// Duration is how long the migration took to apply, if recorded with Config.RecordDurations.
+	Duration time.Duration `json:"duration,omitempty"`
+	// Metadata holds the values of any additional columns of the migration table, such as
+	// batch or checksum columns, keyed by column name. It is only filled by Qafoia.History.
+	Metadata map[string]any `json:"metadata,omitempty"`
 }
 
+// MigrationHistory is the content of the migration table, in ascending name order.
+type MigrationHistory []ExecutedMigration
+
+// Find returns the executed migration with the given name, and whether it was found.
+func (h MigrationHistory) Find(name string) (ExecutedMigration, bool) {
+	for _, m := range h {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return ExecutedMigration{}, false
+}
+
+// Clock tells the current time. It is used for migration timestamps and recorded execution
+// times, so tests can make them deterministic.
+type Clock interface {
+	Now() time.Time
+}
+
+// SQLTransformFunc rewrites the SQL of the named migration before it is executed.
+type SQLTransformFunc func(name, sql string) (string, error)
+
+// RecordMigrationFunc records the named migration as executed at executedAt. exec runs
+// statements in the same transaction as the migration when the driver uses one.
+type RecordMigrationFunc func(ctx context.Context, exec SQLExecutor, name string, executedAt time.Time) error
+
+// RemoveMigrationFunc removes the record of the named migration after it is rolled back.
+type RemoveMigrationFunc func(ctx context.Context, exec SQLExecutor, name string) error
+
+// MissingMigrationAction is what a rollback does with an executed migration that is not
+// registered, set with Config.OnMissingRollbackMigration.
+type MissingMigrationAction int
+
+const (
+	// MissingMigrationSkip logs a warning and leaves the migration record in place.
+	MissingMigrationSkip MissingMigrationAction = iota
+	// MissingMigrationError makes the rollback fail with ErrMigrationNotRegistered before
+	// anything is rolled back.
+	MissingMigrationError
+	// MissingMigrationRemoveRecord removes the migration record without running any SQL, for
+	// migrations whose objects are already gone.
+	MissingMigrationRemoveRecord
+)
+
 type Config struct {
 	Driver             Driver
 	MigrationFilesDir  string
 	MigrationTableName string
 	DebugSql           bool
+	SQLTransform       SQLTransformFunc
+	SortFunc           func(a, b string) bool
+	PreMigrateSQL      []string
+	PostMigrateSQL     []string
+	StructNamer        func(migrationName string) (string, error)
+
+	// Namespace tracks migrations under the given namespace so the same migration table can
+	// record independent histories for several logical databases.
+	Namespace string
+
+	// Baseline is the name of a migration at or before which all migrations are treated as
+	// already applied without being recorded in the migration table.
+	Baseline string
+
+	// MigrationFS and MigrationFSDir, when set, are the source of SQL file migrations that
+	// Load reads and registers. MigrationFSDir defaults to MigrationFilesDir.
+	MigrationFS    fs.FS
+	MigrationFSDir string
+
+	// UpSuffix and DownSuffix are the file name suffixes of the up and down scripts of SQL
+	// file migrations, read by Load and RegisterFS. They default to .up.sql and .down.sql.
+	UpSuffix   string
+	DownSuffix string
+
+	// HooksInTransaction makes the .before.sql and .after.sql hook scripts of SQL file
+	// migrations part of the up script, so they run in the same statement batch, and on
+	// Postgres the same transaction, as the up script. By default they run on their own right
+	// before and after the migration, which applies migrations with hooks one at a time.
+	HooksInTransaction bool
+
+	// StrictReversibility makes Migrate verify each pending migration with VerifyReversible
+	// before applying it. Intended for test and CI databases.
+	StrictReversibility bool
+
+	// DisableAutoCreateTable skips creating the migration table before operations,
+	// for databases where the table is provisioned separately.
+	DisableAutoCreateTable bool
+
+	// PreserveRegistrationOrder applies and lists migrations in the order they were
+	// registered instead of sorting them by name, for names that do not encode order.
+	PreserveRegistrationOrder bool
+
+	// TwoPhaseRecording records each migration that runs outside a transaction with a null
+	// executed_at before running it, and sets executed_at once it succeeds. A migration that
+	// was interrupted is then listed as in progress, and Migrate refuses to continue until
+	// it is resolved.
+	TwoPhaseRecording bool
+
+	// DelayBetweenMigrations pauses between migrations while applying them, to let replicas
+	// catch up during large rollouts. Migrations in a Postgres transaction group run without
+	// pauses. Zero means no delay.
+	DelayBetweenMigrations time.Duration
+
+	// Tracer, when set, wraps each migrate and rollback run in a span, with a child span per
+	// migration carrying its name, duration and outcome.
+	Tracer Tracer
+
+	// RollbackFromStored saves the down script of each migration in the down_sql column of the
+	// migration table when it is applied, and makes rollbacks run that stored script instead
+	// of the registered migration's current DownScript.
+	RollbackFromStored bool
+
+	// SafeMode refuses to apply migrations whose up script matches one of DestructivePatterns
+	// unless they implement DestructiveMigration and acknowledge it.
+	SafeMode bool
+
+	// DestructivePatterns are the case-insensitive regular expressions SafeMode checks up
+	// scripts against. Defaults to DROP TABLE, DROP DATABASE and TRUNCATE statements.
+	DestructivePatterns []string
+
+	// Clock provides the time used for the timestamp of created migration files and the
+	// recorded execution time of migrations. Defaults to the system clock.
+	Clock Clock
+
+	// RecordMigration, when set, is called by the built-in drivers instead of inserting the
+	// migration record into the migration table, for example to fill extra columns. It disables
+	// TwoPhaseRecording and does not receive the Namespace.
+	RecordMigration RecordMigrationFunc
+
+	// RemoveMigration, when set, is called by the built-in drivers instead of deleting the
+	// migration record when a migration is rolled back. It disables TwoPhaseRecording.
+	RemoveMigration RemoveMigrationFunc
+
+	// RecordDurations makes the built-in drivers save how long each migration took to apply
+	// in the duration_ms column of the migration table, shown by List.
+	RecordDurations bool
+
+	// DisallowEmptyUp makes Migrate return ErrEmptyMigration, without applying anything, when
+	// a pending migration has an empty up script, catching generated migrations that were never
+	// filled in. By default an empty up script is applied as a no-op and recorded. Migrations
+	// implementing RunnableMigration, CopyMigration or StreamedMigration are not checked.
+	DisallowEmptyUp bool
+
+	// RequireReversible makes Migrate refuse to apply a migration whose down script is empty
+	// or does not parse. The down script is validated by the driver without running it;
+	// drivers that cannot do so make Migrate return ErrValidationNotSupported.
+	RequireReversible bool
+
+	// FailOnOrphans makes Migrate return ErrOrphanedMigrations, without applying anything, when
+	// the migration table records migrations that are not registered, which usually means the
+	// database was migrated by a newer version of the application.
+	FailOnOrphans bool
+
+	// Environment is the name of the environment migrations run in. Migrations implementing
+	// EnvironmentMigration are only applied when it is one of their environments.
+	Environment string
+
+	// OnMissingRollbackMigration is what Rollback does with an executed migration that is not
+	// registered. The default, MissingMigrationSkip, skips it with a warning.
+	OnMissingRollbackMigration MissingMigrationAction
+
+	// LockTimeout, when set, makes migrations and rollbacks take a database lock first, so
+	// concurrent runs against the same migration table, such as several application instances
+	// starting at once, run one after another. A run that cannot take the lock within the
+	// timeout returns ErrMigrationLocked instead of waiting for a wedged run forever. With a
+	// driver that does not support locks, runs fail with ErrLockingNotSupported.
+	LockTimeout time.Duration
+
+	// CleanPrefix, when set, makes Clean and Fresh only drop the tables whose names start
+	// with it, such as "myapp_", so they are safe to use in a database shared with other
+	// applications. The migration table is dropped as well, unless a Namespace is set, in
+	// which case only the records of the namespace are deleted from it.
+	CleanPrefix string
+
+	// RollbackOnBatchFailure makes Migrate roll back, most recent first, the migrations it
+	// applied before one of them failed, so a run applies all of its pending migrations or
+	// none of them, even without transactional DDL. Migrations applied by earlier runs are
+	// left in place. Migrations are rolled back with their down scripts, so they must be
+	// reversible.
+	RollbackOnBatchFailure bool
+
+	// AuditLogWriter, when set, receives a JSON object per line for every migration applied
+	// or rolled back, every clean and every change to the migration table that runs no
+	// migration, with its time, outcome and duration, as described by AuditRecord. It is an out-of-band record of schema changes that outlives the database,
+	// such as an append-only file.
+	AuditLogWriter io.Writer
+
+	// Quiet suppresses the messages logged when there is nothing to do, such as "No migrations
+	// to run", and when an operation completes as usual. Migrations being applied or rolled
+	// back, warnings and failures are still logged.
+	Quiet bool
 }
 
 type Migration interface {
@@ -23,32 +223,423 @@ type Migration interface {
 	DownScript() string
 }
 
+// RunnableMigration is an optional interface a Migration can implement to run Go code
+// instead of its SQL scripts. When implemented, Run is called in place of executing
+// UpScript and Rollback is called in place of executing DownScript.
+type RunnableMigration interface {
+	Run(ctx context.Context, db *sql.DB) error
+	Rollback(ctx context.Context, db *sql.DB) error
+}
+
+// ConditionalMigration is an optional interface a Migration can implement to decide at
+// runtime whether it should be applied. When ShouldRun returns false the migration is
+// not executed but is still recorded as applied.
+type ConditionalMigration interface {
+	ShouldRun(ctx context.Context, db *sql.DB) (bool, error)
+}
+
+// ParameterizedMigration is an optional interface a Migration can implement to pass query
+// arguments along with its scripts instead of concatenating values into the SQL.
+type ParameterizedMigration interface {
+	UpArgs() []any
+	DownArgs() []any
+}
+
+// CopyMigration is an optional interface a Migration can implement to bulk-load rows into a
+// table with the Postgres COPY protocol, inside the same transaction as its up script.
+// Drivers without COPY support ignore it.
+type CopyMigration interface {
+	CopyData() (table string, columns []string, rows [][]any)
+}
+
+// StreamedMigration is an optional interface a Migration can implement to provide its scripts
+// as readers instead of strings, for scripts too large to hold in memory such as bulk seed
+// dumps. The built-in drivers read and execute them one statement at a time, splitting on
+// semicolons outside quotes, comments and compound statements, and close readers
+// implementing io.Closer. The SQL transform is applied to each statement; UpScript and
+// DownScript are not used, so SafeMode refuses them unless they implement
+// DestructiveMigration.
+type StreamedMigration interface {
+	UpReader() (io.Reader, error)
+	DownReader() (io.Reader, error)
+}
+
+// GroupedMigration is an optional interface a Migration can implement to be applied in the
+// same transaction as the adjacent migrations that return the same group id. Drivers without
+// transactional DDL support ignore it.
+type GroupedMigration interface {
+	TransactionGroup() string
+}
+
+// DestructiveMigration is an optional interface a Migration can implement to acknowledge that
+// its up script is destructive. With Config.SafeMode, a migration whose up script matches a
+// destructive pattern is only applied if Destructive returns true.
+type DestructiveMigration interface {
+	Destructive() bool
+}
+
+// DatabaseMigration is an optional interface a Migration can implement to run its scripts
+// against another database than the one the driver is connected to. The MySQL driver switches
+// to it with USE for the duration of the migration; the migration is still recorded in the
+// migration table of the configured database.
+type DatabaseMigration interface {
+	Database() string
+}
+
+// EnvironmentMigration is an optional interface a Migration can implement to only be applied
+// in some environments, such as test-only fixtures. It is skipped unless Config.Environment
+// is one of the returned environments. An empty list applies it everywhere.
+type EnvironmentMigration interface {
+	Environments() []string
+}
+
+// DescribedMigration is an optional interface a Migration can implement to provide a short
+// description shown by List. Migrations loaded from SQL files implement it with the
+// description comment of their up script.
+type DescribedMigration interface {
+	Description() string
+}
+
+// NonTransactionalMigration is an optional interface a Migration can implement to have its
+// script run one statement at a time when NoTransaction returns true. The Postgres driver
+// otherwise runs a script in one implicit transaction, in which statements such as
+// CREATE INDEX CONCURRENTLY are not allowed. Such a migration cannot be part of a transaction
+// group. The MySQL driver commits each DDL statement on its own anyway and ignores it.
+type NonTransactionalMigration interface {
+	NoTransaction() bool
+}
+
+// TaggedMigration is an optional interface a Migration can implement to label itself, such as
+// with the feature or release it belongs to. The tags are reported by List.
+type TaggedMigration interface {
+	Tags() []string
+}
+
+// TimeoutMigration is an optional interface a Migration can implement to limit how long its up
+// or down script may run. When the timeout elapses the migration fails. On Postgres the running
+// statement is canceled on the server. On MySQL the timeout is client-side only: the driver
+// abandons the connection, but the server keeps running the statement until it finishes or is
+// stopped with KILL QUERY. A zero timeout means no limit.
+type TimeoutMigration interface {
+	Timeout() time.Duration
+}
+
 type RegisteredMigration struct {
-	Name       string
-	UpScript   string
-	DownScript string
-	IsExecuted bool
-	ExecutedAt *time.Time
+	Name        string
+	Description string
+	UpScript    string
+	DownScript  string
+	IsExecuted  bool
+	IsBaselined bool
+	// IsInProgress is set for a migration recorded as started but never finished.
+	IsInProgress bool
+	// IsSkippedForEnvironment is set for a pending migration excluded by Config.Environment.
+	IsSkippedForEnvironment bool
+	ExecutedAt              *time.Time
+	// Duration is how long the migration took to apply, if recorded with Config.RecordDurations.
+	Duration time.Duration
+	// Tags are the tags of a migration implementing TaggedMigration.
+	Tags []string
+}
+
+// executionStatus describes whether the migration is executed, as shown in the list table.
+func (m RegisteredMigration) executionStatus() string {
+	if m.IsBaselined {
+		return "baselined"
+	}
+	if m.IsInProgress {
+		return "in progress"
+	}
+	if m.IsSkippedForEnvironment {
+		return "skipped: env"
+	}
+	return fmt.Sprintf("%t", m.IsExecuted)
 }
 
 type RegisteredMigrationList []RegisteredMigration
 
+// Print prints the migrations as a table to standard output.
 func (m RegisteredMigrationList) Print() {
-	var tableData [][]string
-	tableData = append(tableData, []string{"Migration Name", "Is Executed", "Executed At"})
+	m.Fprint(os.Stdout)
+}
 
-	for _, migration := range m {
-		executedAt := "N/A"
-		if migration.ExecutedAt != nil {
-			executedAt = migration.ExecutedAt.Format(time.RFC3339)
+// ListColumn is a column of the migration table printed by PrintColumns.
+type ListColumn string
+
+const (
+	ColumnName        ListColumn = "name"
+	ColumnStatus      ListColumn = "status"
+	ColumnExecutedAt  ListColumn = "executed_at"
+	ColumnDuration    ListColumn = "duration"
+	ColumnDescription ListColumn = "description"
+)
+
+// listColumns holds the header and the cell value of each ListColumn.
+var listColumns = map[ListColumn]struct {
+	header string
+	value  func(migration RegisteredMigration) string
+}{
+	ColumnName: {"Migration Name", func(m RegisteredMigration) string {
+		return m.Name
+	}},
+	ColumnStatus: {"Is Executed", RegisteredMigration.executionStatus},
+	ColumnExecutedAt: {"Executed At", func(m RegisteredMigration) string {
+		if m.ExecutedAt == nil {
+			return "N/A"
 		}
-		row := []string{
-			migration.Name,
-			fmt.Sprintf("%t", migration.IsExecuted),
-			executedAt,
+		return m.ExecutedAt.Format(time.RFC3339)
+	}},
+	ColumnDuration: {"Duration", func(m RegisteredMigration) string {
+		if m.Duration <= 0 {
+			return "N/A"
+		}
+		return m.Duration.String()
+	}},
+	ColumnDescription: {"Description", func(m RegisteredMigration) string {
+		return m.Description
+	}},
+}
+
+// Fprint writes the migrations as a table to w, with the name, status and execution time
+// columns. Duration and Description columns are included when any migration has a recorded
+// duration or a description.
+func (m RegisteredMigrationList) Fprint(w io.Writer) {
+	m.FprintColumns(w, m.defaultColumns()...)
+}
+
+// defaultColumns returns the columns printed by Fprint.
+func (m RegisteredMigrationList) defaultColumns() []ListColumn {
+	columns := []ListColumn{ColumnName, ColumnStatus, ColumnExecutedAt}
+	if slices.ContainsFunc(m, func(migration RegisteredMigration) bool { return migration.Duration > 0 }) {
+		columns = append(columns, ColumnDuration)
+	}
+	if slices.ContainsFunc(m, func(migration RegisteredMigration) bool { return migration.Description != "" }) {
+		columns = append(columns, ColumnDescription)
+	}
+	return columns
+}
+
+// PrintColumns prints the migrations as a table with the given columns, in the given order,
+// to standard output. Unknown columns are left out.
+func (m RegisteredMigrationList) PrintColumns(columns ...ListColumn) {
+	m.FprintColumns(os.Stdout, columns...)
+}
+
+// FprintColumns writes the output of PrintColumns to w.
+func (m RegisteredMigrationList) FprintColumns(w io.Writer, columns ...ListColumn) {
+	var header []string
+	var values []func(migration RegisteredMigration) string
+	for _, column := range columns {
+		if c, ok := listColumns[column]; ok {
+			header = append(header, c.header)
+			values = append(values, c.value)
+		}
+	}
+
+	tableData := [][]string{header}
+	for _, migration := range m {
+		row := make([]string, 0, len(values))
+		for _, value := range values {
+			row = append(row, value(migration))
 		}
 		tableData = append(tableData, row)
 	}
 
-	printTable(tableData)
+	printTable(w, tableData)
+}
+
+// PrintGroupedByStatus prints the migrations in separate tables for applied, pending and
+// other migrations, each under a heading with its count, to standard output. With no
+// columns, the columns of Print are used.
+func (m RegisteredMigrationList) PrintGroupedByStatus(columns ...ListColumn) {
+	m.FprintGroupedByStatus(os.Stdout, columns...)
+}
+
+// FprintGroupedByStatus writes the output of PrintGroupedByStatus to w. Applied migrations
+// include baselined ones; the other group, holding migrations in progress or skipped for the
+// environment, is only written when it is not empty.
+func (m RegisteredMigrationList) FprintGroupedByStatus(w io.Writer, columns ...ListColumn) {
+	if len(columns) == 0 {
+		columns = m.defaultColumns()
+	}
+
+	var applied, pending, other RegisteredMigrationList
+	for _, migration := range m {
+		switch {
+		case migration.isPending():
+			pending = append(pending, migration)
+		case migration.IsExecuted && !migration.IsInProgress, migration.IsBaselined:
+			applied = append(applied, migration)
+		default:
+			other = append(other, migration)
+		}
+	}
+
+	type statusGroup struct {
+		heading    string
+		migrations RegisteredMigrationList
+	}
+	groups := []statusGroup{{"✅ Applied", applied}, {"⏳ Pending", pending}}
+	if len(other) > 0 {
+		groups = append(groups, statusGroup{"⚠️  Other", other})
+	}
+
+	for i, group := range groups {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s (%d)\n", group.heading, len(group.migrations))
+		if len(group.migrations) > 0 {
+			group.migrations.FprintColumns(w, columns...)
+		}
+	}
+}
+
+// ShardedMigrationList is the status of the registered migrations on each shard of a
+// MultiDriver, as returned by Qafoia.ListSharded.
+type ShardedMigrationList struct {
+	// Shards are the shard names, in the order of the MultiDriver.
+	Shards     []string
+	Migrations []ShardedMigration
+}
+
+// ShardedMigration is the status of a registered migration on each shard.
+type ShardedMigration struct {
+	Name string
+	// Applied reports whether the migration is executed on each shard, in the order of
+	// ShardedMigrationList.Shards.
+	Applied []bool
+}
+
+// appliedByMajority reports whether the migration is applied on at least half of the shards.
+// A tie counts as applied, so the shards that are behind are the ones flagged.
+func (m ShardedMigration) appliedByMajority() bool {
+	count := 0
+	for _, applied := range m.Applied {
+		if applied {
+			count++
+		}
+	}
+	return count*2 >= len(m.Applied)
+}
+
+// OutOfSync returns the names of the shards whose status differs from the majority for at
+// least one migration, in shard order.
+func (l ShardedMigrationList) OutOfSync() []string {
+	differs := make([]bool, len(l.Shards))
+	for _, migration := range l.Migrations {
+		majority := migration.appliedByMajority()
+		for i, applied := range migration.Applied {
+			if applied != majority {
+				differs[i] = true
+			}
+		}
+	}
+
+	var shards []string
+	for i, shard := range l.Shards {
+		if differs[i] {
+			shards = append(shards, shard)
+		}
+	}
+	return shards
+}
+
+// Print prints the migrations by shard as a table to standard output.
+func (l ShardedMigrationList) Print() {
+	l.Fprint(os.Stdout)
+}
+
+// Fprint writes a table with a row per migration and a column per shard to w. Cells that
+// differ from the majority of the shards are marked with "!", and the shards with such cells
+// are listed after the table.
+func (l ShardedMigrationList) Fprint(w io.Writer) {
+	data := [][]string{append([]string{"Migration"}, l.Shards...)}
+	for _, migration := range l.Migrations {
+		majority := migration.appliedByMajority()
+		row := []string{migration.Name}
+		for _, applied := range migration.Applied {
+			cell := "pending"
+			if applied {
+				cell = "applied"
+			}
+			if applied != majority {
+				cell += " !"
+			}
+			row = append(row, cell)
+		}
+		data = append(data, row)
+	}
+	printTable(w, data)
+
+	if outOfSync := l.OutOfSync(); len(outOfSync) > 0 {
+		fmt.Fprintf(w, "⚠️  Shards out of sync with the majority: %s\n", strings.Join(outOfSync, ", "))
+	}
+}
+
+// isPending reports whether the migration would be applied by the next migrate.
+func (m RegisteredMigration) isPending() bool {
+	return !m.IsExecuted && !m.IsBaselined && !m.IsInProgress && !m.IsSkippedForEnvironment
+}
+
+// PrintVerbose prints the migration table followed by the up script of each pending
+// migration, for reviewing everything the next migrate will run.
+func (m RegisteredMigrationList) PrintVerbose() {
+	m.FprintVerbose(os.Stdout)
+}
+
+// FprintVerbose writes the output of PrintVerbose to w.
+func (m RegisteredMigrationList) FprintVerbose(w io.Writer) {
+	m.Fprint(w)
+	m.fprintPendingScripts(w)
+}
+
+// fprintPendingScripts writes the up script of each pending migration to w.
+func (m RegisteredMigrationList) fprintPendingScripts(w io.Writer) {
+	for _, migration := range m {
+		if !migration.isPending() {
+			continue
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "📦 %s\n", migration.Name)
+		fmt.Fprintln(w, "================================================")
+		fmt.Fprintln(w, migration.UpScript)
+		fmt.Fprintln(w, "================================================")
+	}
+}
+
+// runSummary counts the outcome of a migrate or rollback run. Applied counts migrations
+// that were applied or rolled back, depending on the direction of the run.
+type runSummary struct {
+	Applied  int
+	Skipped  int
+	Failed   int
+	Duration time.Duration
+}
+
+// succeeded records a successfully applied or rolled back migration. It is a no-op on a nil summary.
+func (s *runSummary) succeeded() {
+	if s != nil {
+		s.Applied++
+	}
+}
+
+// failed records a failed migration. It is a no-op on a nil summary.
+func (s *runSummary) failed() {
+	if s != nil {
+		s.Failed++
+	}
+}
+
+// track records the time elapsed since start as the run duration.
+func (s *runSummary) track(start time.Time) {
+	s.Duration = time.Since(start)
+}
+
+// String formats the summary as a single machine-readable line with stable key=value pairs.
+func (s runSummary) String() string {
+	return fmt.Sprintf(
+		"QAFOIA_SUMMARY applied=%d skipped=%d failed=%d duration=%.1fs",
+		s.Applied, s.Skipped, s.Failed, s.Duration.Seconds(),
+	)
 }
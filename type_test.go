@@ -3,6 +3,7 @@ package qafoia
 import (
 	"bytes"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -49,3 +50,151 @@ func TestRegisteredMigrationList_Print(t *testing.T) {
 	assert.Contains(t, output, "add_customer_id")
 	assert.Contains(t, output, "N/A") // Check for non-executed migration's "Executed At" field
 }
+
+func TestRegisteredMigrationList_PrintDescription(t *testing.T) {
+	output := captureOutput(func() {
+		RegisteredMigrationList{{Name: "create_orders"}}.Print()
+	})
+	assert.NotContains(t, output, "Description")
+
+	output = captureOutput(func() {
+		RegisteredMigrationList{
+			{Name: "create_orders", Description: "Create the orders table"},
+			{Name: "add_customer_id"},
+		}.Print()
+	})
+	assert.Contains(t, output, "Description")
+	assert.Contains(t, output, "Create the orders table")
+}
+
+func TestRegisteredMigrationList_PrintDuration(t *testing.T) {
+	executedAt := time.Now()
+	output := captureOutput(func() {
+		RegisteredMigrationList{
+			{Name: "create_orders", IsExecuted: true, ExecutedAt: &executedAt, Duration: 1500 * time.Millisecond},
+			{Name: "add_customer_id"},
+		}.Print()
+	})
+
+	assert.Contains(t, output, "Duration")
+	assert.Contains(t, output, "1.5s")
+}
+
+func TestRegisteredMigrationList_Fprint(t *testing.T) {
+	migrations := RegisteredMigrationList{
+		{Name: "001_create_users", IsExecuted: true},
+		{Name: "002_create_orders", UpScript: "CREATE TABLE orders (id INT);"},
+	}
+
+	var buf bytes.Buffer
+	migrations.Fprint(&buf)
+	assert.Contains(t, buf.String(), "| Migration Name")
+	assert.Contains(t, buf.String(), "002_create_orders")
+	assert.NotContains(t, buf.String(), "CREATE TABLE orders")
+
+	buf.Reset()
+	migrations.FprintVerbose(&buf)
+	assert.Contains(t, buf.String(), "📦 002_create_orders")
+	assert.Contains(t, buf.String(), "CREATE TABLE orders (id INT);")
+}
+
+func TestRegisteredMigrationList_FprintColumns(t *testing.T) {
+	executedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	migrations := RegisteredMigrationList{
+		{Name: "001_create_users", IsExecuted: true, ExecutedAt: &executedAt, Duration: 2 * time.Second},
+	}
+
+	var buf bytes.Buffer
+	migrations.FprintColumns(&buf, ColumnDuration, ColumnName, ListColumn("unknown"))
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, "| Duration | Migration Name   |", lines[1])
+	assert.Equal(t, "| 2s       | 001_create_users |", lines[3])
+	assert.NotContains(t, buf.String(), "Executed At")
+}
+
+func TestRegisteredMigrationList_FprintGroupedByStatus(t *testing.T) {
+	executedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	migrations := RegisteredMigrationList{
+		{Name: "001_create_users", IsExecuted: true, ExecutedAt: &executedAt},
+		{Name: "002_create_orders"},
+		{Name: "003_create_items", IsBaselined: true},
+		{Name: "004_create_carts"},
+	}
+
+	var buf bytes.Buffer
+	migrations.FprintGroupedByStatus(&buf, ColumnName)
+	output := buf.String()
+
+	applied := strings.Index(output, "✅ Applied (2)")
+	pending := strings.Index(output, "⏳ Pending (2)")
+	assert.GreaterOrEqual(t, applied, 0)
+	assert.Greater(t, pending, applied)
+	assert.Less(t, strings.Index(output, "003_create_items"), pending)
+	assert.Greater(t, strings.Index(output, "002_create_orders"), pending)
+	assert.NotContains(t, output, "Other")
+
+	buf.Reset()
+	RegisteredMigrationList{{Name: "001_create_users", IsInProgress: true}}.FprintGroupedByStatus(&buf)
+	assert.Contains(t, buf.String(), "✅ Applied (0)")
+	assert.Contains(t, buf.String(), "⚠️  Other (1)")
+	assert.Contains(t, buf.String(), "in progress")
+}
+
+func TestRegisteredMigrationList_PrintBaselined(t *testing.T) {
+	migrations := RegisteredMigrationList{
+		{Name: "create_orders", IsBaselined: true},
+	}
+
+	output := captureOutput(func() {
+		migrations.Print()
+	})
+
+	assert.Contains(t, output, "baselined")
+}
+
+func TestRegisteredMigrationList_PrintVerbose(t *testing.T) {
+	executedAt := time.Now()
+	migrations := RegisteredMigrationList{
+		{Name: "001_create_users", UpScript: "CREATE TABLE users (id INT);", IsExecuted: true, ExecutedAt: &executedAt},
+		{Name: "002_create_orders", UpScript: "CREATE TABLE orders (id INT);"},
+	}
+
+	output := captureOutput(func() {
+		migrations.PrintVerbose()
+	})
+
+	assert.Contains(t, output, "📦 002_create_orders")
+	assert.Contains(t, output, "CREATE TABLE orders (id INT);")
+	assert.NotContains(t, output, "CREATE TABLE users (id INT);")
+}
+
+func TestRunSummary_String(t *testing.T) {
+	summary := runSummary{Applied: 3, Skipped: 10, Failed: 0, Duration: 4200 * time.Millisecond}
+
+	assert.Equal(t, "QAFOIA_SUMMARY applied=3 skipped=10 failed=0 duration=4.2s", summary.String())
+}
+
+func TestProgressBar(t *testing.T) {
+	var out bytes.Buffer
+	bar := newProgressBar(&out, 4)
+
+	bar.render()
+	bar.advance()
+	bar.advance()
+	bar.finish()
+
+	assert.Contains(t, out.String(), "0/4 migrations")
+	assert.Contains(t, out.String(), "\r[===============               ] 2/4 migrations")
+	assert.True(t, bytes.HasSuffix(out.Bytes(), []byte("\n")))
+
+	// Advancing past the total keeps the bar full instead of panicking
+	bar = newProgressBar(&out, 1)
+	bar.advance()
+	bar.advance()
+	assert.Contains(t, out.String(), "\r[==============================] 2/1 migrations")
+
+	// A nil bar is a no-op
+	var nilBar *progressBar
+	nilBar.advance()
+	nilBar.finish()
+}
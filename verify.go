@@ -0,0 +1,177 @@
+package qafoia
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrationMethods are the methods a Go migration type must declare, each taking no
+// arguments and returning a string.
+var migrationMethods = []string{"Name", "UpScript", "DownScript"}
+
+// VerifyMigrationFiles parses every Go file in dir, excluding tests, and checks that each
+// type declaring any of the Migration methods declares all of Name, UpScript and DownScript
+// with the right signatures. Syntax errors and signature problems of all files are reported
+// together, so they are caught before the migrations package is compiled.
+func VerifyMigrationFiles(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read migration directory %q: %w", dir, err)
+	}
+
+	var errs []error
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(fileName, ".go") || strings.HasSuffix(fileName, "_test.go") {
+			continue
+		}
+
+		file, err := parser.ParseFile(fset, filepath.Join(dir, fileName), nil, 0)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, problem := range verifyMigrationFile(file) {
+			errs = append(errs, fmt.Errorf("%s: %s", fileName, problem))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// verifyMigrationFile returns the problems found with the migration types declared in file.
+func verifyMigrationFile(file *ast.File) []string {
+	methods := make(map[string]map[string]*ast.FuncDecl)
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil || len(fn.Recv.List) != 1 {
+			continue
+		}
+
+		receiver := receiverTypeName(fn.Recv.List[0].Type)
+		if receiver == "" {
+			continue
+		}
+		if methods[receiver] == nil {
+			methods[receiver] = make(map[string]*ast.FuncDecl)
+		}
+		methods[receiver][fn.Name.Name] = fn
+	}
+
+	receivers := make([]string, 0, len(methods))
+	for receiver := range methods {
+		receivers = append(receivers, receiver)
+	}
+	sort.Strings(receivers)
+
+	var problems []string
+	for _, receiver := range receivers {
+		declared := 0
+		for _, method := range migrationMethods {
+			if _, found := methods[receiver][method]; found {
+				declared++
+			}
+		}
+		if declared == 0 {
+			continue
+		}
+
+		for _, method := range migrationMethods {
+			fn, found := methods[receiver][method]
+			switch {
+			case !found:
+				problems = append(problems, fmt.Sprintf("type %s is missing method %s() string", receiver, method))
+			case !isStringGetter(fn.Type):
+				problems = append(problems, fmt.Sprintf("method %s.%s must have signature %s() string", receiver, method, method))
+			}
+		}
+	}
+
+	return problems
+}
+
+// receiverTypeName returns the name of the type of a method receiver, such as T or *T.
+func receiverTypeName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// isStringGetter reports whether fn takes no parameters and returns a single string.
+func isStringGetter(fn *ast.FuncType) bool {
+	if fn.Params.NumFields() != 0 || fn.Results.NumFields() != 1 {
+		return false
+	}
+	ident, ok := fn.Results.List[0].Type.(*ast.Ident)
+	return ok && ident.Name == "string"
+}
+
+// declaredMigrationNames returns, for each Go file in dir excluding tests, the migration
+// names returned as string literals by the Name methods declared in the file.
+func declaredMigrationNames(dir string) (map[string][]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration directory %q: %w", dir, err)
+	}
+
+	names := make(map[string][]string)
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(fileName, ".go") || strings.HasSuffix(fileName, "_test.go") {
+			continue
+		}
+
+		file, err := parser.ParseFile(fset, filepath.Join(dir, fileName), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil || fn.Name.Name != "Name" || fn.Body == nil || !isStringGetter(fn.Type) {
+				continue
+			}
+			if name, ok := returnedStringLiteral(fn.Body); ok {
+				names[fileName] = append(names[fileName], name)
+			}
+		}
+	}
+
+	return names, nil
+}
+
+// returnedStringLiteral returns the string literal returned by a function body consisting of
+// a single return statement, such as the Name method of a generated migration.
+func returnedStringLiteral(body *ast.BlockStmt) (string, bool) {
+	if len(body.List) != 1 {
+		return "", false
+	}
+	ret, ok := body.List[0].(*ast.ReturnStmt)
+	if !ok || len(ret.Results) != 1 {
+		return "", false
+	}
+	lit, ok := ret.Results[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	value, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return "", false
+	}
+	return value, true
+}
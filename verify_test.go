@@ -0,0 +1,38 @@
+package qafoia
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyMigrationFiles(t *testing.T) {
+	dir := t.TempDir()
+	content, err := migrationFileTemplate("migrations", "20250418220011_create_users_table", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "20250418220011_create_users_table.go"), []byte(content), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "registry.go"), []byte("package migrations\n\nvar All = []any{}\n"), 0644))
+
+	assert.NoError(t, VerifyMigrationFiles(dir))
+}
+
+func TestVerifyMigrationFiles_Problems(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "broken.go"), []byte("package migrations\n\nfunc (m *Broken Name() string {\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "incomplete.go"), []byte(`package migrations
+
+type Incomplete struct{}
+
+func (m *Incomplete) Name() string { return "incomplete" }
+
+func (m *Incomplete) UpScript() (string, error) { return "", nil }
+`), 0644))
+
+	err := VerifyMigrationFiles(dir)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "broken.go")
+	assert.Contains(t, err.Error(), "incomplete.go: method Incomplete.UpScript must have signature UpScript() string")
+	assert.Contains(t, err.Error(), "incomplete.go: type Incomplete is missing method DownScript() string")
+}